@@ -0,0 +1,164 @@
+package admin
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/gojek/kafqa/config"
+	"github.com/gojek/kafqa/logger"
+	"github.com/hashicorp/go-multierror"
+	"gopkg.in/confluentinc/confluent-kafka-go.v1/kafka"
+)
+
+type adminClient interface {
+	CreateTopics(context.Context, []kafka.TopicSpecification, ...kafka.CreateTopicsAdminOption) ([]kafka.TopicResult, error)
+	DeleteTopics(context.Context, []string, ...kafka.DeleteTopicsAdminOption) ([]kafka.TopicResult, error)
+	DescribeConfigs(context.Context, []kafka.ConfigResource, ...kafka.DescribeConfigsAdminOption) ([]kafka.ConfigResourceResult, error)
+	GetMetadata(*string, bool, int) (*kafka.Metadata, error)
+	Close()
+}
+
+type Admin struct {
+	client adminClient
+	config config.Admin
+	topics []string
+}
+
+// Provision creates the missing topics and validates they match the configured expectations
+func (a *Admin) Provision(ctx context.Context) error {
+	if a.config.CreateTopics {
+		if err := a.create(ctx); err != nil {
+			return err
+		}
+	}
+	if a.config.ValidateTopics {
+		return a.Validate(ctx)
+	}
+	return nil
+}
+
+func (a *Admin) create(ctx context.Context) error {
+	specs := make([]kafka.TopicSpecification, 0, len(a.topics))
+	for _, t := range a.topics {
+		specs = append(specs, kafka.TopicSpecification{
+			Topic:             t,
+			NumPartitions:     a.config.Partitions,
+			ReplicationFactor: a.config.ReplicationFactor,
+			Config:            a.config.TopicConfigs,
+		})
+	}
+	results, err := a.client.CreateTopics(ctx, specs, kafka.SetAdminOperationTimeout(a.config.Timeout()))
+	if err != nil {
+		return fmt.Errorf("error creating topics: %v", err)
+	}
+	var errs multierror.Error
+	for _, res := range results {
+		switch res.Error.Code() {
+		case kafka.ErrNoError:
+			logger.Infof("created topic %s", res.Topic)
+		case kafka.ErrTopicAlreadyExists:
+			logger.Infof("topic %s already exists", res.Topic)
+		default:
+			errs.Errors = append(errs.Errors, fmt.Errorf("error creating topic %s: %v", res.Topic, res.Error))
+		}
+	}
+	return errs.ErrorOrNil()
+}
+
+// Validate checks partitions, replication factor and configs of the existing topics
+func (a *Admin) Validate(ctx context.Context) error {
+	var errs multierror.Error
+	for _, t := range a.topics {
+		if err := a.validateMetadata(t); err != nil {
+			errs.Errors = append(errs.Errors, err)
+		}
+	}
+	if len(a.config.TopicConfigs) > 0 {
+		if err := a.validateConfigs(ctx); err != nil {
+			errs.Errors = append(errs.Errors, err)
+		}
+	}
+	return errs.ErrorOrNil()
+}
+
+func (a *Admin) validateMetadata(topic string) error {
+	md, err := a.client.GetMetadata(&topic, false, a.config.TimeoutMs)
+	if err != nil {
+		return fmt.Errorf("error fetching metadata for topic %s: %v", topic, err)
+	}
+	tm, ok := md.Topics[topic]
+	if !ok || tm.Error.Code() != kafka.ErrNoError {
+		return fmt.Errorf("topic %s doesn't exist: %v", topic, tm.Error)
+	}
+	if a.config.Partitions > 0 && len(tm.Partitions) != a.config.Partitions {
+		return fmt.Errorf("topic %s has %d partitions, expected %d", topic, len(tm.Partitions), a.config.Partitions)
+	}
+	if a.config.ReplicationFactor > 0 {
+		for _, p := range tm.Partitions {
+			if len(p.Replicas) != a.config.ReplicationFactor {
+				return fmt.Errorf("topic %s partition %d has replication factor %d, expected %d",
+					topic, p.ID, len(p.Replicas), a.config.ReplicationFactor)
+			}
+		}
+	}
+	return nil
+}
+
+func (a *Admin) validateConfigs(ctx context.Context) error {
+	resources := make([]kafka.ConfigResource, 0, len(a.topics))
+	for _, t := range a.topics {
+		resources = append(resources, kafka.ConfigResource{Type: kafka.ResourceTopic, Name: t})
+	}
+	results, err := a.client.DescribeConfigs(ctx, resources, kafka.SetAdminRequestTimeout(a.config.Timeout()))
+	if err != nil {
+		return fmt.Errorf("error describing topic configs: %v", err)
+	}
+	var errs multierror.Error
+	for _, res := range results {
+		if res.Error.Code() != kafka.ErrNoError {
+			errs.Errors = append(errs.Errors, fmt.Errorf("error describing configs of topic %s: %v", res.Name, res.Error))
+			continue
+		}
+		for name, expected := range a.config.TopicConfigs {
+			if actual := res.Config[name].Value; actual != expected {
+				errs.Errors = append(errs.Errors, fmt.Errorf("topic %s has %s=%s, expected %s", res.Name, name, actual, expected))
+			}
+		}
+	}
+	return errs.ErrorOrNil()
+}
+
+// Teardown deletes the topics when configured to
+func (a *Admin) Teardown(ctx context.Context) error {
+	if !a.config.DeleteTopics {
+		return nil
+	}
+	results, err := a.client.DeleteTopics(ctx, a.topics, kafka.SetAdminOperationTimeout(a.config.Timeout()))
+	if err != nil {
+		return fmt.Errorf("error deleting topics: %v", err)
+	}
+	var errs multierror.Error
+	for _, res := range results {
+		if res.Error.Code() != kafka.ErrNoError {
+			errs.Errors = append(errs.Errors, fmt.Errorf("error deleting topic %s: %v", res.Topic, res.Error))
+			continue
+		}
+		logger.Infof("deleted topic %s", res.Topic)
+	}
+	return errs.ErrorOrNil()
+}
+
+func (a *Admin) Close() {
+	a.client.Close()
+}
+
+func New(cfg config.Admin, kafkaCfg *kafka.ConfigMap, topics []string) (*Admin, error) {
+	if cfg.CreateTopics && (cfg.Partitions <= 0 || cfg.ReplicationFactor <= 0) {
+		return nil, fmt.Errorf("partitions and replication factor are required to create topics")
+	}
+	client, err := kafka.NewAdminClient(kafkaCfg)
+	if err != nil {
+		return nil, fmt.Errorf("error creating admin client: %v", err)
+	}
+	return &Admin{client: client, config: cfg, topics: topics}, nil
+}
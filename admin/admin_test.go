@@ -0,0 +1,135 @@
+package admin
+
+import (
+	"context"
+	"testing"
+
+	"github.com/gojek/kafqa/config"
+	"github.com/gojek/kafqa/logger"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"gopkg.in/confluentinc/confluent-kafka-go.v1/kafka"
+)
+
+func init() {
+	logger.Setup("none")
+}
+
+func metadata(topic string, partitions, replicas int) *kafka.Metadata {
+	tm := kafka.TopicMetadata{Topic: topic}
+	for i := 0; i < partitions; i++ {
+		tm.Partitions = append(tm.Partitions, kafka.PartitionMetadata{ID: int32(i), Replicas: make([]int32, replicas)})
+	}
+	return &kafka.Metadata{Topics: map[string]kafka.TopicMetadata{topic: tm}}
+}
+
+func TestShouldCreateTopicsAndIgnoreExisting(t *testing.T) {
+	client := new(adminClientMock)
+	cfg := config.Admin{CreateTopics: true, Partitions: 3, ReplicationFactor: 2,
+		TopicConfigs: map[string]string{"min.insync.replicas": "2"}}
+	adm := &Admin{client: client, config: cfg, topics: []string{"new", "existing"}}
+	specs := []kafka.TopicSpecification{
+		{Topic: "new", NumPartitions: 3, ReplicationFactor: 2, Config: cfg.TopicConfigs},
+		{Topic: "existing", NumPartitions: 3, ReplicationFactor: 2, Config: cfg.TopicConfigs},
+	}
+	client.On("CreateTopics", specs).Return([]kafka.TopicResult{
+		{Topic: "new"},
+		{Topic: "existing", Error: kafka.NewError(kafka.ErrTopicAlreadyExists, "exists", false)},
+	}, nil)
+
+	err := adm.Provision(context.Background())
+
+	require.NoError(t, err)
+	client.AssertExpectations(t)
+}
+
+func TestShouldFailProvisionWhenTopicCreationFails(t *testing.T) {
+	client := new(adminClientMock)
+	adm := &Admin{client: client, config: config.Admin{CreateTopics: true, Partitions: 1, ReplicationFactor: 5}, topics: []string{"t"}}
+	client.On("CreateTopics", mock.Anything).Return([]kafka.TopicResult{
+		{Topic: "t", Error: kafka.NewError(kafka.ErrInvalidReplicationFactor, "replication factor larger than brokers", false)},
+	}, nil)
+
+	err := adm.Provision(context.Background())
+
+	assert.Contains(t, err.Error(), "error creating topic t: replication factor larger than brokers")
+}
+
+func TestShouldValidateTopicPartitionsAndReplication(t *testing.T) {
+	client := new(adminClientMock)
+	adm := &Admin{client: client, config: config.Admin{ValidateTopics: true, Partitions: 3, ReplicationFactor: 3},
+		topics: []string{"valid", "fewer_partitions", "under_replicated"}}
+	client.On("GetMetadata", "valid").Return(metadata("valid", 3, 3), nil)
+	client.On("GetMetadata", "fewer_partitions").Return(metadata("fewer_partitions", 1, 3), nil)
+	client.On("GetMetadata", "under_replicated").Return(metadata("under_replicated", 3, 1), nil)
+
+	err := adm.Provision(context.Background())
+
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "topic fewer_partitions has 1 partitions, expected 3")
+	assert.Contains(t, err.Error(), "topic under_replicated partition 0 has replication factor 1, expected 3")
+	assert.NotContains(t, err.Error(), "topic valid")
+}
+
+func TestShouldValidateTopicConfigs(t *testing.T) {
+	client := new(adminClientMock)
+	adm := &Admin{client: client, topics: []string{"t"},
+		config: config.Admin{ValidateTopics: true, TopicConfigs: map[string]string{"min.insync.replicas": "2"}}}
+	client.On("GetMetadata", "t").Return(metadata("t", 1, 1), nil)
+	client.On("DescribeConfigs", []kafka.ConfigResource{{Type: kafka.ResourceTopic, Name: "t"}}).Return([]kafka.ConfigResourceResult{
+		{Name: "t", Config: map[string]kafka.ConfigEntryResult{"min.insync.replicas": {Value: "1"}}},
+	}, nil)
+
+	err := adm.Validate(context.Background())
+
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "topic t has min.insync.replicas=1, expected 2")
+}
+
+func TestShouldDeleteTopicsOnTeardownOnlyWhenConfigured(t *testing.T) {
+	client := new(adminClientMock)
+	adm := &Admin{client: client, topics: []string{"t"}}
+
+	require.NoError(t, adm.Teardown(context.Background()))
+	client.AssertNotCalled(t, "DeleteTopics", mock.Anything)
+
+	adm.config.DeleteTopics = true
+	client.On("DeleteTopics", []string{"t"}).Return([]kafka.TopicResult{{Topic: "t"}}, nil)
+
+	require.NoError(t, adm.Teardown(context.Background()))
+	client.AssertExpectations(t)
+}
+
+func TestNewShouldRequirePartitionsToCreateTopics(t *testing.T) {
+	_, err := New(config.Admin{CreateTopics: true}, &kafka.ConfigMap{}, []string{"t"})
+
+	assert.EqualError(t, err, "partitions and replication factor are required to create topics")
+}
+
+type adminClientMock struct{ mock.Mock }
+
+func (m *adminClientMock) CreateTopics(ctx context.Context, specs []kafka.TopicSpecification,
+	opts ...kafka.CreateTopicsAdminOption) ([]kafka.TopicResult, error) {
+	args := m.Called(specs)
+	return args.Get(0).([]kafka.TopicResult), args.Error(1)
+}
+
+func (m *adminClientMock) DeleteTopics(ctx context.Context, topics []string,
+	opts ...kafka.DeleteTopicsAdminOption) ([]kafka.TopicResult, error) {
+	args := m.Called(topics)
+	return args.Get(0).([]kafka.TopicResult), args.Error(1)
+}
+
+func (m *adminClientMock) DescribeConfigs(ctx context.Context, resources []kafka.ConfigResource,
+	opts ...kafka.DescribeConfigsAdminOption) ([]kafka.ConfigResourceResult, error) {
+	args := m.Called(resources)
+	return args.Get(0).([]kafka.ConfigResourceResult), args.Error(1)
+}
+
+func (m *adminClientMock) GetMetadata(topic *string, allTopics bool, timeoutMs int) (*kafka.Metadata, error) {
+	args := m.Called(*topic)
+	return args.Get(0).(*kafka.Metadata), args.Error(1)
+}
+
+func (m *adminClientMock) Close() { m.Called() }
@@ -5,6 +5,8 @@ import (
 
 	"github.com/gojek/kafqa/serde"
 
+	"github.com/gojek/kafqa/checksum"
+	"github.com/gojek/kafqa/headers"
 	"github.com/gojek/kafqa/logger"
 	"github.com/gojek/kafqa/reporter"
 	"github.com/gojek/kafqa/reporter/metrics"
@@ -29,7 +31,7 @@ func Acker(ack acknowledger, decoder serde.Decoder) Callback {
 				logger.Debugf("Unable to acknowledge message: %s", message)
 			}
 			metrics.AcknowledgedMessage(message, *msg.TopicPartition.Topic)
-			metrics.ConsumerLatency(time.Since(message.CreatedTime))
+			metrics.ConsumerLatency(time.Since(message.CreatedTime), *msg.TopicPartition.Topic)
 		}
 	}
 }
@@ -40,21 +42,58 @@ func Reporter(decoder serde.Decoder) Callback {
 		if err != nil {
 			logger.Debugf("Unable to decode message during message sent callback")
 		} else {
-			metrics.SentMessage(message)
-			metrics.ProduceLatency(time.Since(message.CreatedTime))
+			metrics.SentMessage(message, *msg.TopicPartition.Topic)
+			metrics.ProduceLatency(time.Since(message.CreatedTime), *msg.TopicPartition.Topic)
 		}
 	}
 }
 
 func LatencyTracker(decoder serde.Decoder) Callback {
+	return latencyTracker(decoder, func(*kafka.Message) time.Time { return time.Now() })
+}
+
+// ReplayLatencyTracker measures the latency until the message timestamp, when reading
+// a historical window the consumption time has no relation to when the message was produced
+func ReplayLatencyTracker(decoder serde.Decoder) Callback {
+	return latencyTracker(decoder, func(msg *kafka.Message) time.Time { return msg.Timestamp })
+}
+
+func latencyTracker(decoder serde.Decoder, receivedAt func(*kafka.Message) time.Time) Callback {
 	return func(msg *kafka.Message) {
 		message, err := decoder.FromBytes(msg.Value)
 		if err != nil {
 			logger.Debugf("Unable to decode message during consumer ack")
 			return
 		}
-		latency := time.Since(message.CreatedTime)
-		reporter.ConsumptionDelay(latency)
+		latency := receivedAt(msg).Sub(message.CreatedTime)
+		reporter.ConsumptionDelay(latency, *msg.TopicPartition.Topic)
+	}
+}
+
+func ChecksumVerifier() Callback {
+	return func(msg *kafka.Message) {
+		ok, err := checksum.Verify(msg)
+		if err != nil {
+			logger.Debugf("Unable to verify checksum of message on %s: %v", msg.TopicPartition, err)
+			return
+		}
+		if !ok {
+			logger.Errorf("Checksum mismatch, corrupted message received on %s", msg.TopicPartition)
+			metrics.CorruptedMessage(*msg.TopicPartition.Topic)
+			reporter.CorruptedMessage()
+		}
+	}
+}
+
+func HeaderValidator(expectHeaders bool) Callback {
+	return func(msg *kafka.Message) {
+		err := headers.Verify(msg)
+		if err == nil || (err == headers.ErrNotFound && !expectHeaders) {
+			return
+		}
+		logger.Errorf("Headers mismatch for message received on %s: %v", msg.TopicPartition, err)
+		metrics.HeaderMismatch(*msg.TopicPartition.Topic)
+		reporter.HeaderMismatch()
 	}
 }
 
@@ -0,0 +1,41 @@
+package checksum
+
+import (
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"strconv"
+
+	"gopkg.in/confluentinc/confluent-kafka-go.v1/kafka"
+)
+
+const HeaderKey = "kafqa-crc32c"
+
+var ErrNotFound = errors.New("checksum header not found")
+
+var table = crc32.MakeTable(crc32.Castagnoli)
+
+func Sum(data []byte) uint32 {
+	return crc32.Checksum(data, table)
+}
+
+// Headers appends the crc32c checksum of value to the message headers
+func Headers(value []byte, msgHeaders []kafka.Header) []kafka.Header {
+	sum := strconv.FormatUint(uint64(Sum(value)), 10)
+	return append(msgHeaders, kafka.Header{Key: HeaderKey, Value: []byte(sum)})
+}
+
+// Verify recomputes the checksum of the message value and compares it with the one sent in headers
+func Verify(msg *kafka.Message) (bool, error) {
+	for _, h := range msg.Headers {
+		if h.Key != HeaderKey {
+			continue
+		}
+		expected, err := strconv.ParseUint(string(h.Value), 10, 32)
+		if err != nil {
+			return false, fmt.Errorf("invalid checksum header %q: %v", h.Value, err)
+		}
+		return uint32(expected) == Sum(msg.Value), nil
+	}
+	return false, ErrNotFound
+}
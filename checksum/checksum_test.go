@@ -0,0 +1,53 @@
+package checksum
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gopkg.in/confluentinc/confluent-kafka-go.v1/kafka"
+)
+
+func TestShouldVerifyUnmodifiedMessage(t *testing.T) {
+	value := []byte("kafqa payload")
+	msg := &kafka.Message{Value: value, Headers: Headers(value, nil)}
+
+	ok, err := Verify(msg)
+
+	require.NoError(t, err)
+	assert.True(t, ok)
+}
+
+func TestShouldDetectCorruptedMessage(t *testing.T) {
+	value := []byte("kafqa payload")
+	msg := &kafka.Message{Value: []byte("kafqa paylaod"), Headers: Headers(value, nil)}
+
+	ok, err := Verify(msg)
+
+	require.NoError(t, err)
+	assert.False(t, ok)
+}
+
+func TestShouldKeepExistingHeaders(t *testing.T) {
+	existing := []kafka.Header{{Key: "uber-trace-id", Value: []byte("id")}}
+
+	headers := Headers([]byte("data"), existing)
+
+	require.Len(t, headers, 2)
+	assert.Equal(t, "uber-trace-id", headers[0].Key)
+	assert.Equal(t, HeaderKey, headers[1].Key)
+}
+
+func TestShouldReturnErrorWhenHeaderIsMissing(t *testing.T) {
+	_, err := Verify(&kafka.Message{Value: []byte("data")})
+
+	assert.Equal(t, ErrNotFound, err)
+}
+
+func TestShouldReturnErrorWhenHeaderIsInvalid(t *testing.T) {
+	msg := &kafka.Message{Value: []byte("data"), Headers: []kafka.Header{{Key: HeaderKey, Value: []byte("abc")}}}
+
+	_, err := Verify(msg)
+
+	assert.Error(t, err)
+}
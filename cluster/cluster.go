@@ -0,0 +1,74 @@
+package cluster
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/gojek/kafqa/logger"
+	"github.com/gojek/kafqa/reporter/metrics"
+	"gopkg.in/confluentinc/confluent-kafka-go.v1/kafka"
+)
+
+type metadataClient interface {
+	GetMetadata(*string, bool, int) (*kafka.Metadata, error)
+	Close()
+}
+
+type Cluster struct {
+	client    metadataClient
+	topics    []string
+	timeoutMs int
+}
+
+// Snapshot fetches brokers and partition leaders, replicas and ISRs of the topics
+func (c *Cluster) Snapshot() (Snapshot, error) {
+	snapshot := NewSnapshot(time.Now())
+	for i := range c.topics {
+		md, err := c.client.GetMetadata(&c.topics[i], false, c.timeoutMs)
+		if err != nil {
+			return snapshot, fmt.Errorf("error fetching metadata for topic %s: %v", c.topics[i], err)
+		}
+		snapshot.add(md)
+	}
+	return snapshot, nil
+}
+
+// Monitor samples the topic metadata every interval and exports partition state as metrics until ctx is done
+func (c *Cluster) Monitor(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	for {
+		select {
+		case <-ticker.C:
+			snapshot, err := c.Snapshot()
+			if err != nil {
+				logger.Errorf("error sampling cluster metadata: %v", err)
+				continue
+			}
+			export(snapshot)
+		case <-ctx.Done():
+			ticker.Stop()
+			return
+		}
+	}
+}
+
+func export(s Snapshot) {
+	for topic, partitions := range s.Partitions {
+		for id, p := range partitions {
+			metrics.PartitionState(topic, id, p.Leader, len(p.Isrs), p.UnderReplicated(), p.Offline())
+		}
+	}
+}
+
+func (c *Cluster) Close() {
+	c.client.Close()
+}
+
+func New(kafkaCfg *kafka.ConfigMap, topics []string, timeoutMs int) (*Cluster, error) {
+	client, err := kafka.NewAdminClient(kafkaCfg)
+	if err != nil {
+		return nil, fmt.Errorf("error creating metadata client: %v", err)
+	}
+	return &Cluster{client: client, topics: topics, timeoutMs: timeoutMs}, nil
+}
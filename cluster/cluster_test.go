@@ -0,0 +1,72 @@
+package cluster
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/gojek/kafqa/logger"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"gopkg.in/confluentinc/confluent-kafka-go.v1/kafka"
+)
+
+func init() {
+	logger.Setup("none")
+}
+
+func metadata(topic string, leader int32) *kafka.Metadata {
+	return &kafka.Metadata{
+		Brokers: []kafka.BrokerMetadata{{ID: 1, Host: "b1", Port: 9092}},
+		Topics: map[string]kafka.TopicMetadata{topic: {Topic: topic, Partitions: []kafka.PartitionMetadata{
+			{ID: 0, Leader: leader, Replicas: []int32{1}, Isrs: []int32{1}},
+		}}},
+	}
+}
+
+func TestShouldSnapshotAllTopics(t *testing.T) {
+	client := new(metadataClientMock)
+	cl := &Cluster{client: client, topics: []string{"t1", "t2"}}
+	client.On("GetMetadata", "t1").Return(metadata("t1", 1), nil)
+	client.On("GetMetadata", "t2").Return(metadata("t2", -1), nil)
+
+	snapshot, err := cl.Snapshot()
+
+	require.NoError(t, err)
+	assert.Equal(t, map[int32]string{1: "b1:9092"}, snapshot.Brokers)
+	assert.Equal(t, int32(1), snapshot.Partitions["t1"][0].Leader)
+	assert.True(t, snapshot.Partitions["t2"][0].Offline())
+}
+
+func TestShouldFailSnapshotWhenMetadataIsUnavailable(t *testing.T) {
+	client := new(metadataClientMock)
+	cl := &Cluster{client: client, topics: []string{"t1"}}
+	client.On("GetMetadata", "t1").Return((*kafka.Metadata)(nil), errors.New("timed out"))
+
+	_, err := cl.Snapshot()
+
+	assert.EqualError(t, err, "error fetching metadata for topic t1: timed out")
+}
+
+func TestShouldSampleMetadataPeriodicallyUntilDone(t *testing.T) {
+	client := new(metadataClientMock)
+	cl := &Cluster{client: client, topics: []string{"t1"}}
+	client.On("GetMetadata", "t1").Return(metadata("t1", 1), nil)
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	cl.Monitor(ctx, 10*time.Millisecond)
+
+	assert.True(t, len(client.Calls) > 1)
+}
+
+type metadataClientMock struct{ mock.Mock }
+
+func (m *metadataClientMock) GetMetadata(topic *string, allTopics bool, timeoutMs int) (*kafka.Metadata, error) {
+	args := m.Called(*topic)
+	return args.Get(0).(*kafka.Metadata), args.Error(1)
+}
+
+func (m *metadataClientMock) Close() { m.Called() }
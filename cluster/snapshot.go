@@ -0,0 +1,197 @@
+package cluster
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"gopkg.in/confluentinc/confluent-kafka-go.v1/kafka"
+)
+
+type ChangeKind string
+
+const (
+	LeaderChange    ChangeKind = "leader"
+	ISRChange       ChangeKind = "isr"
+	BrokerChange    ChangeKind = "broker"
+	PartitionChange ChangeKind = "partition"
+	noLeader        int32      = -1
+)
+
+type PartitionState struct {
+	Leader   int32
+	Replicas []int32
+	Isrs     []int32
+}
+
+func (p PartitionState) Offline() bool {
+	return p.Leader == noLeader
+}
+
+func (p PartitionState) UnderReplicated() bool {
+	return len(p.Isrs) < len(p.Replicas)
+}
+
+type Snapshot struct {
+	Taken      time.Time
+	Brokers    map[int32]string
+	Partitions map[string]map[int32]PartitionState
+}
+
+// OfflineReplicas returns the replicas hosted on brokers which aren't alive
+func (s Snapshot) OfflineReplicas() int {
+	var offline int
+	for _, partitions := range s.Partitions {
+		for _, p := range partitions {
+			for _, r := range p.Replicas {
+				if _, ok := s.Brokers[r]; !ok {
+					offline++
+				}
+			}
+		}
+	}
+	return offline
+}
+
+func (s Snapshot) add(md *kafka.Metadata) {
+	for _, b := range md.Brokers {
+		s.Brokers[b.ID] = fmt.Sprintf("%s:%d", b.Host, b.Port)
+	}
+	for topic, tm := range md.Topics {
+		partitions := make(map[int32]PartitionState, len(tm.Partitions))
+		for _, p := range tm.Partitions {
+			partitions[p.ID] = PartitionState{Leader: p.Leader, Replicas: p.Replicas, Isrs: p.Isrs}
+		}
+		s.Partitions[topic] = partitions
+	}
+}
+
+func NewSnapshot(taken time.Time) Snapshot {
+	return Snapshot{
+		Taken:      taken,
+		Brokers:    make(map[int32]string),
+		Partitions: make(map[string]map[int32]PartitionState),
+	}
+}
+
+type Change struct {
+	Kind      ChangeKind `json:"kind"`
+	Topic     string     `json:"topic,omitempty"`
+	Partition int32      `json:"partition"`
+	Broker    int32      `json:"broker,omitempty"`
+	Before    string     `json:"before"`
+	After     string     `json:"after"`
+}
+
+func (c Change) Subject() string {
+	if c.Kind == BrokerChange {
+		return fmt.Sprintf("broker %d", c.Broker)
+	}
+	return fmt.Sprintf("%s[%d]", c.Topic, c.Partition)
+}
+
+// Diff lists the broker, leadership and ISR changes between two snapshots
+func Diff(before, after Snapshot) []Change {
+	changes := brokerChanges(before.Brokers, after.Brokers)
+	for _, topic := range topics(before, after) {
+		bp, ap := before.Partitions[topic], after.Partitions[topic]
+		for _, id := range partitionIDs(bp, ap) {
+			b, bok := bp[id]
+			a, aok := ap[id]
+			if !bok || !aok {
+				changes = append(changes, Change{Kind: PartitionChange, Topic: topic, Partition: id,
+					Before: existence(bok), After: existence(aok)})
+				continue
+			}
+			if b.Leader != a.Leader {
+				changes = append(changes, Change{Kind: LeaderChange, Topic: topic, Partition: id,
+					Before: fmt.Sprint(b.Leader), After: fmt.Sprint(a.Leader)})
+			}
+			if !sameSet(b.Isrs, a.Isrs) {
+				changes = append(changes, Change{Kind: ISRChange, Topic: topic, Partition: id,
+					Before: fmt.Sprint(sorted(b.Isrs)), After: fmt.Sprint(sorted(a.Isrs))})
+			}
+		}
+	}
+	return changes
+}
+
+func brokerChanges(before, after map[int32]string) []Change {
+	ids := make(map[int32]bool)
+	for id := range before {
+		ids[id] = true
+	}
+	for id := range after {
+		ids[id] = true
+	}
+	var changes []Change
+	for _, id := range sortedKeys(ids) {
+		b, a := before[id], after[id]
+		if b != a {
+			changes = append(changes, Change{Kind: BrokerChange, Broker: id, Before: b, After: a})
+		}
+	}
+	return changes
+}
+
+func topics(before, after Snapshot) []string {
+	names := make(map[string]bool)
+	for t := range before.Partitions {
+		names[t] = true
+	}
+	for t := range after.Partitions {
+		names[t] = true
+	}
+	var ts []string
+	for t := range names {
+		ts = append(ts, t)
+	}
+	sort.Strings(ts)
+	return ts
+}
+
+func partitionIDs(before, after map[int32]PartitionState) []int32 {
+	ids := make(map[int32]bool)
+	for id := range before {
+		ids[id] = true
+	}
+	for id := range after {
+		ids[id] = true
+	}
+	return sortedKeys(ids)
+}
+
+func sortedKeys(ids map[int32]bool) []int32 {
+	keys := make([]int32, 0, len(ids))
+	for id := range ids {
+		keys = append(keys, id)
+	}
+	sort.Slice(keys, func(i, j int) bool { return keys[i] < keys[j] })
+	return keys
+}
+
+func sorted(ids []int32) []int32 {
+	s := append([]int32(nil), ids...)
+	sort.Slice(s, func(i, j int) bool { return s[i] < s[j] })
+	return s
+}
+
+func sameSet(a, b []int32) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	sa, sb := sorted(a), sorted(b)
+	for i := range sa {
+		if sa[i] != sb[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func existence(exists bool) string {
+	if exists {
+		return "present"
+	}
+	return "absent"
+}
@@ -0,0 +1,60 @@
+package cluster
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func snapshot(brokers map[int32]string, partitions map[int32]PartitionState) Snapshot {
+	s := NewSnapshot(time.Now())
+	for id, host := range brokers {
+		s.Brokers[id] = host
+	}
+	s.Partitions["kafqa"] = partitions
+	return s
+}
+
+func TestShouldReturnNoChangesForSameSnapshot(t *testing.T) {
+	s := snapshot(map[int32]string{1: "b1:9092"}, map[int32]PartitionState{
+		0: {Leader: 1, Replicas: []int32{1}, Isrs: []int32{1}},
+	})
+
+	assert.Empty(t, Diff(s, s))
+}
+
+func TestShouldReportLeaderAndISRChanges(t *testing.T) {
+	brokers := map[int32]string{1: "b1:9092", 2: "b2:9092", 3: "b3:9092"}
+	before := snapshot(brokers, map[int32]PartitionState{
+		0: {Leader: 1, Replicas: []int32{1, 2, 3}, Isrs: []int32{1, 2, 3}},
+		1: {Leader: 2, Replicas: []int32{2, 3, 1}, Isrs: []int32{2, 3, 1}},
+	})
+	after := snapshot(brokers, map[int32]PartitionState{
+		0: {Leader: 2, Replicas: []int32{1, 2, 3}, Isrs: []int32{3, 2}},
+		1: {Leader: 2, Replicas: []int32{2, 3, 1}, Isrs: []int32{1, 2, 3}},
+	})
+
+	changes := Diff(before, after)
+
+	require.Len(t, changes, 2)
+	assert.Equal(t, Change{Kind: LeaderChange, Topic: "kafqa", Partition: 0, Before: "1", After: "2"}, changes[0])
+	assert.Equal(t, Change{Kind: ISRChange, Topic: "kafqa", Partition: 0, Before: "[1 2 3]", After: "[2 3]"}, changes[1])
+	assert.Equal(t, "kafqa[0]", changes[0].Subject())
+}
+
+func TestShouldReportBrokerChangesAndOfflineReplicas(t *testing.T) {
+	partitions := map[int32]PartitionState{0: {Leader: -1, Replicas: []int32{1, 2}, Isrs: []int32{}}}
+	before := snapshot(map[int32]string{1: "b1:9092", 2: "b2:9092"}, partitions)
+	after := snapshot(map[int32]string{1: "b1:9092"}, partitions)
+
+	changes := Diff(before, after)
+
+	require.Len(t, changes, 1)
+	assert.Equal(t, Change{Kind: BrokerChange, Broker: 2, Before: "b2:9092", After: ""}, changes[0])
+	assert.Equal(t, "broker 2", changes[0].Subject())
+	assert.Equal(t, 1, after.OfflineReplicas())
+	assert.True(t, after.Partitions["kafqa"][0].Offline())
+	assert.True(t, after.Partitions["kafqa"][0].UnderReplicated())
+}
@@ -5,9 +5,11 @@ import (
 	"fmt"
 	"io"
 	"log"
+	"net/http"
 	"os"
 	"os/signal"
 	"strconv"
+	"strings"
 	"sync"
 	"syscall"
 	"time"
@@ -15,12 +17,21 @@ import (
 	"github.com/gojek/kafqa/reporter/metrics"
 	"github.com/gojek/kafqa/serde"
 
+	"github.com/gojek/kafqa/admin"
 	"github.com/gojek/kafqa/callback"
+	"github.com/gojek/kafqa/cluster"
 	"github.com/gojek/kafqa/config"
 	"github.com/gojek/kafqa/consumer"
+	"github.com/gojek/kafqa/control"
+	"github.com/gojek/kafqa/coordinator"
 	"github.com/gojek/kafqa/creator"
+	"github.com/gojek/kafqa/fake"
+	"github.com/gojek/kafqa/headers"
 	"github.com/gojek/kafqa/logger"
+	"github.com/gojek/kafqa/mirror"
 	"github.com/gojek/kafqa/producer"
+	"github.com/gojek/kafqa/proxy"
+	"github.com/gojek/kafqa/reconcile"
 	"github.com/gojek/kafqa/reporter"
 	"github.com/gojek/kafqa/store"
 	"github.com/gojek/kafqa/tracer"
@@ -37,6 +48,13 @@ type application struct {
 	cancel      context.CancelFunc
 	consumerWg  *sync.WaitGroup
 	traceCloser io.Closer
+	admin       *admin.Admin
+	cluster     *cluster.Cluster
+	snapshot    cluster.Snapshot
+	reconciler  *reconcile.Reconciler
+	proxy       *proxy.Proxy
+	mirror      *mirror.Tracker
+	coordinator *coordinator.Coordinator
 }
 
 func main() {
@@ -44,31 +62,214 @@ func main() {
 		log.Fatalf("error loading config: %v", err)
 	}
 	appCfg := config.App()
+	if appCfg.Control.Enabled {
+		serveControl(appCfg)
+		return
+	}
 	app, err := setup(appCfg)
 	if err != nil {
 		log.Fatalf("error initializing app: %v", err)
 	}
+	app.run(appCfg)
+}
 
+func (app *application) run(appCfg config.Application) {
 	logger.Infof("running application against %s", appCfg.Producer.KafkaBrokers)
 
 	if app.Consumer != nil {
 		app.Consumer.Run(app.ctx)
+		go app.completeOnConsumerEnd()
 	}
 
 	// Introducing delay since consumers can consume quickly
 	time.Sleep(time.Millisecond * time.Duration(appCfg.Producer.DelayMs))
 
+	if app.cluster != nil && appCfg.Cluster.MonitorEnabled {
+		app.WaitGroup.Add(1)
+		go func() {
+			defer app.WaitGroup.Done()
+			app.cluster.Monitor(app.ctx, appCfg.Cluster.MonitorInterval())
+		}()
+	}
+
 	if app.Producer != nil {
 		app.Producer.Run(app.ctx)
 		app.WaitGroup.Add(1)
 		go app.Handler.Handle()
 	}
 
-	defer reporter.GenerateReport()
+	defer app.closeStore()
+	defer app.report()
 	app.Wait()
+	app.clusterChanges(appCfg.Cluster)
+	app.reconcile()
+	app.mirrorReport()
+	app.teardown()
+	app.closeProxy()
 	logger.Infof("Completed.")
 }
 
+// serveControl waits for runs to be started through the control api, until interrupted
+func serveControl(appCfg config.Application) {
+	logger.Setup(appCfg.LogLevel())
+	srv := control.New(appCfg, startRun)
+	server := &http.Server{Addr: fmt.Sprintf(":%d", appCfg.Control.Port), Handler: srv.Handler()}
+	go func() {
+		if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			log.Fatalf("error serving control api: %v", err)
+		}
+	}()
+	logger.Infof("serving control api on port %d", appCfg.Control.Port)
+
+	exit := make(chan os.Signal, 1)
+	signal.Notify(exit, syscall.SIGINT, syscall.SIGTERM)
+	<-exit
+	logger.Infof("Received interrupt, stopping the run in progress")
+	if err := server.Shutdown(context.Background()); err != nil {
+		logger.Errorf("error shutting down control api: %v", err)
+	}
+	srv.Stop()
+}
+
+// controlledRun is a run started through the control api
+type controlledRun struct {
+	app  *application
+	done chan struct{}
+}
+
+func (r *controlledRun) Producer() control.Producer {
+	if r.app.Producer == nil {
+		return nil
+	}
+	return r.app.Producer
+}
+
+func (r *controlledRun) Stop() {
+	r.app.cancel()
+}
+
+func (r *controlledRun) Done() <-chan struct{} {
+	return r.done
+}
+
+func startRun(appCfg config.Application) (control.Run, error) {
+	app, err := setup(appCfg)
+	if err != nil {
+		return nil, err
+	}
+	r := &controlledRun{app: app, done: make(chan struct{})}
+	go func() {
+		defer close(r.done)
+		app.run(appCfg)
+	}()
+	return r, nil
+}
+
+// completeOnConsumerEnd ends the run once a bounded consumer read all its partitions
+func (app *application) completeOnConsumerEnd() {
+	select {
+	case <-app.Consumer.Done():
+		logger.Infof("consumer reached the end offsets, completing the run")
+		app.cancel()
+	case <-app.ctx.Done():
+	}
+}
+
+func (app *application) clusterChanges(cfg config.Cluster) {
+	if app.cluster == nil {
+		return
+	}
+	defer app.cluster.Close()
+	if !cfg.SnapshotEnabled {
+		return
+	}
+	end, err := app.cluster.Snapshot()
+	if err != nil {
+		logger.Errorf("error taking cluster snapshot: %v", err)
+		return
+	}
+	reporter.ClusterChanges(app.snapshot, end)
+}
+
+func (app *application) reconcile() {
+	if app.reconciler == nil {
+		return
+	}
+	defer app.reconciler.Close()
+	traces, ok, err := reporter.LostTraces()
+	if err != nil {
+		logger.Errorf("error fetching unacknowledged messages: %v", err)
+		return
+	}
+	if !ok {
+		logger.Infof("store doesn't keep offsets of unacknowledged messages, skipping reconciliation")
+		return
+	}
+	if len(traces) > 0 {
+		reporter.Reconciliation(app.reconciler.Reconcile(traces))
+	}
+}
+
+func (app *application) mirrorReport() {
+	if app.mirror != nil {
+		reporter.Mirror(app.mirror.Report())
+	}
+}
+
+// report prints the report of the instance, or of the whole run when coordinated
+func (app *application) report() {
+	if app.coordinator == nil {
+		reporter.GenerateReport()
+		return
+	}
+	if err := app.coordinator.Push(reporter.Result(app.coordinator.ID())); err != nil {
+		logger.Errorf("error pushing results of the instance: %v", err)
+	}
+	if !app.coordinator.Aggregator() {
+		logger.Infof("results pushed, the run is reported by the aggregator")
+		return
+	}
+	defer func() {
+		if err := app.coordinator.Close(); err != nil {
+			logger.Errorf("error deleting coordination keys: %v", err)
+		}
+	}()
+	results, missing, err := app.coordinator.Results(context.Background())
+	if err != nil {
+		logger.Errorf("error fetching results of the instances, reporting this instance: %v", err)
+		reporter.GenerateReport()
+		return
+	}
+	if len(missing) > 0 {
+		logger.Errorf("instances %v didn't push their results", missing)
+	}
+	reporter.GenerateDistributedReport(results, missing)
+}
+
+func (app *application) closeStore() {
+	if closer, ok := app.msgStore.(io.Closer); ok {
+		if err := reporter.CloseStore(closer); err != nil {
+			logger.Errorf("error closing store: %v", err)
+		}
+	}
+}
+
+func (app *application) teardown() {
+	if app.admin == nil {
+		return
+	}
+	if err := app.admin.Teardown(context.Background()); err != nil {
+		logger.Errorf("error tearing down topics: %v", err)
+	}
+	app.admin.Close()
+}
+
+func (app *application) closeProxy() {
+	if app.proxy != nil {
+		app.proxy.Close()
+	}
+}
+
 func (app *application) Close() {
 	logger.Infof("closing application...")
 	app.cancel()
@@ -86,31 +287,200 @@ func (app *application) Wait() {
 	app.consumerWg.Wait()
 }
 
-func getProducer(cfg config.Producer, parser serde.Parser) (*producer.Producer, error) {
+// getProxy routes the producer and consumer connections through the proxy by replacing their brokers
+func getProxy(appCfg *config.Application) (*proxy.Proxy, error) {
+	if !appCfg.Proxy.Enabled {
+		return nil, nil
+	}
+	for _, protocol := range []string{appCfg.Producer.SecurityProtocol, appCfg.Consumer.SecurityProtocol} {
+		if protocol != "PLAINTEXT" && protocol != "SASL_PLAINTEXT" {
+			return nil, fmt.Errorf("proxy doesn't support security protocol %s", protocol)
+		}
+	}
+	prx, err := proxy.New(appCfg.Proxy)
+	if err != nil {
+		return nil, err
+	}
+	for _, brokers := range []*string{&appCfg.Producer.KafkaBrokers, &appCfg.Consumer.KafkaBrokers} {
+		if *brokers, err = prx.Bootstrap(*brokers); err != nil {
+			prx.Close()
+			return nil, fmt.Errorf("error proxying brokers: %v", err)
+		}
+	}
+	return prx, nil
+}
+
+// getFakeBroker replaces the cluster with an in-memory broker, components reading cluster metadata need a real one
+func getFakeBroker(appCfg config.Application) (*fake.Broker, error) {
+	if !appCfg.FakeBroker.Enabled {
+		return nil, nil
+	}
+	if appCfg.Admin.Enabled() || appCfg.Cluster.Enabled() || appCfg.Reconcile.Enabled || appCfg.Proxy.Enabled ||
+		appCfg.Consumer.AssignEnabled {
+		return nil, fmt.Errorf("admin, cluster, reconcile, proxy and assigned partitions need a kafka cluster, not supported with the fake broker")
+	}
+	logger.Infof("running against the fake broker with %d partitions per topic", appCfg.FakeBroker.Partitions)
+	return fake.NewBroker(appCfg.FakeBroker), nil
+}
+
+// getMirror consumes the mirrors of the produced topics instead of the topics themselves
+func getMirror(appCfg *config.Application, decoder serde.Decoder) (*mirror.Tracker, error) {
+	if !appCfg.Mirror.Enabled {
+		return nil, nil
+	}
+	if !appCfg.Producer.Enabled || !appCfg.Consumer.Enabled {
+		return nil, fmt.Errorf("mirror mode needs both producer and consumer enabled")
+	}
+	if appCfg.Consumer.AssignEnabled {
+		return nil, fmt.Errorf("mirror mode consumes with a consumer group, partitions can't be assigned")
+	}
+	tracker := mirror.New(appCfg.Mirror, appCfg.Producer.TopicNames(), decoder)
+	appCfg.Consumer.Topics = tracker.Targets()
+	logger.Infof("mirror mode producing to %v on %s, consuming %v on %s", appCfg.Producer.TopicNames(),
+		appCfg.Producer.KafkaBrokers, appCfg.Consumer.Topics, appCfg.Consumer.KafkaBrokers)
+	return tracker, nil
+}
+
+// getCoordinator joins the run of the instances sharing the redis store, once all of them registered
+func getCoordinator(appCfg config.Application, ms store.MsgStore) (*coordinator.Coordinator, error) {
+	if !appCfg.Coordinator.Enabled {
+		return nil, nil
+	}
+	rs, ok := ms.(*store.Redis)
+	if !ok || appCfg.Store.RunID == "" {
+		return nil, fmt.Errorf("coordinated runs need the redis store with a run id")
+	}
+	id := appCfg.Coordinator.ID
+	if id == "" {
+		var err error
+		if id, err = os.Hostname(); err != nil {
+			return nil, fmt.Errorf("error getting hostname for instance id: %v", err)
+		}
+	}
+	coord := coordinator.New(appCfg.Coordinator, id, rs)
+	if err := coord.Join(context.Background()); err != nil {
+		return nil, err
+	}
+	logger.Infof("%d instances registered for run %s", appCfg.Coordinator.Instances, appCfg.Store.RunID)
+	return coord, nil
+}
+
+func adminTarget(appCfg config.Application) (*kafka.ConfigMap, []string) {
+	if !appCfg.Producer.Enabled {
+		return appCfg.Consumer.AdminConfig(), appCfg.Consumer.TopicNames()
+	}
+	return appCfg.Producer.AdminConfig(), appCfg.Producer.TopicNames()
+}
+
+func getCluster(appCfg config.Application) (*cluster.Cluster, cluster.Snapshot, error) {
+	if !appCfg.Cluster.Enabled() {
+		return nil, cluster.Snapshot{}, nil
+	}
+	kafkaCfg, topics := adminTarget(appCfg)
+	cl, err := cluster.New(kafkaCfg, topics, appCfg.Cluster.MetadataTimeoutMs)
+	if err != nil {
+		return nil, cluster.Snapshot{}, err
+	}
+	if !appCfg.Cluster.SnapshotEnabled {
+		return cl, cluster.Snapshot{}, nil
+	}
+	snapshot, err := cl.Snapshot()
+	if err != nil {
+		cl.Close()
+		return nil, cluster.Snapshot{}, fmt.Errorf("error taking cluster snapshot: %v", err)
+	}
+	return cl, snapshot, nil
+}
+
+func getReconciler(appCfg config.Application, decoder serde.Decoder) (*reconcile.Reconciler, error) {
+	if !appCfg.Reconcile.Enabled {
+		return nil, nil
+	}
+	return reconcile.New(appCfg.Producer.ReaderConfig(), decoder, appCfg.Reconcile.Timeout(), appCfg.Reconcile.Limit)
+}
+
+func getAdmin(appCfg config.Application) (*admin.Admin, error) {
+	if !appCfg.Admin.Enabled() {
+		return nil, nil
+	}
+	kafkaCfg, topics := adminTarget(appCfg)
+	adm, err := admin.New(appCfg.Admin, kafkaCfg, topics)
+	if err != nil {
+		return nil, err
+	}
+	if err := adm.Provision(context.Background()); err != nil {
+		adm.Close()
+		return nil, fmt.Errorf("error provisioning topics: %v", err)
+	}
+	return adm, nil
+}
+
+func getProducer(appCfg config.Application, parser serde.Parser, broker *fake.Broker) (*producer.Producer, error) {
+	cfg := appCfg.Producer
 	if !cfg.Enabled {
 		logger.Infof("Producer is not enabled")
 		return nil, nil
 	}
-	var err error
-	kafkaProducer, err := producer.New(cfg, creator.New(), parser,
+	opts := []producer.Option{
 		producer.Register(callback.Reporter(parser)),
 		producer.Register(func(msg *kafka.Message) { time.Sleep(200) }),
-	)
+	}
+	if cfg.HeadersEnabled() {
+		opts = append(opts, producer.HeaderGenerator(
+			headers.NewGenerator(cfg.Headers, appCfg.Store.RunID, producerID(cfg), cfg.HeaderPaddingBytes)))
+	}
+	if broker != nil {
+		opts = append(opts, producer.KafkaProducer(broker.NewProducer(cfg)))
+	}
+	var err error
+	kafkaProducer, err := producer.New(cfg, creator.New(), parser, opts...)
 	if err != nil {
 		return nil, fmt.Errorf("error creating producer: %v", err)
 	}
 	return kafkaProducer, nil
 }
 
-func getConsumer(appCfg config.Application, ms store.MsgStore, wg *sync.WaitGroup, parser serde.Decoder) (*consumer.Consumer, error) {
+func producerID(cfg config.Producer) string {
+	if cfg.ID != "" {
+		return cfg.ID
+	}
+	hostname, err := os.Hostname()
+	if err != nil {
+		logger.Errorf("Unable to get hostname for producer id: %v", err)
+	}
+	return hostname
+}
+
+func getConsumer(appCfg config.Application, ms store.MsgStore, wg *sync.WaitGroup, parser serde.Decoder,
+	broker *fake.Broker, tracker *mirror.Tracker) (*consumer.Consumer, error) {
 	if !appCfg.Consumer.Enabled {
 		logger.Infof("Consumer is not enabled")
 		return nil, nil
 	}
-	kafkaConsumer, err := consumer.New(appCfg.Consumer,
-		consumer.Register(callback.Acker(ms, parser)),
-		consumer.Register(callback.LatencyTracker(parser)),
-		consumer.WaitGroup(wg))
+	latencyTracker := callback.LatencyTracker(parser)
+	if appCfg.Consumer.ReplayLatency {
+		latencyTracker = callback.ReplayLatencyTracker(parser)
+	}
+	acker := callback.Acker(ms, parser)
+	if tracker != nil {
+		acker = tracker.SourceTopic(acker)
+	}
+	opts := []consumer.Option{
+		consumer.Register(acker),
+		consumer.Register(latencyTracker),
+		consumer.Register(callback.ChecksumVerifier()),
+		consumer.Register(callback.HeaderValidator(appCfg.Consumer.ExpectHeaders)),
+		consumer.WaitGroup(wg),
+	}
+	if tracker != nil {
+		opts = append(opts, consumer.Register(tracker.Mirrored()))
+	}
+	if broker != nil {
+		opts = append(opts, consumer.Clients(func(cfg config.Consumer) (consumer.Client, error) {
+			return broker.NewConsumer(cfg)
+		}))
+	}
+	kafkaConsumer, err := consumer.New(appCfg.Consumer, opts...)
 	if err != nil {
 		return nil, fmt.Errorf("error creating consumer: %v", err)
 	}
@@ -120,30 +490,102 @@ func getConsumer(appCfg config.Application, ms store.MsgStore, wg *sync.WaitGrou
 	return kafkaConsumer, nil
 }
 
-func setup(appCfg config.Application) (*application, error) {
+// setup creates the components of a run, the ones already created are closed when a later one fails
+// as the control api keeps serving after a run failed to start
+func setup(appCfg config.Application) (_ *application, err error) {
 	logger.Setup(appCfg.LogLevel())
 	metrics.SetupStatsD(appCfg.Reporter.Statsd)
 	closer, err := tracer.Setup(appCfg.Jaeger)
 	if err != nil {
 		logger.Errorf("Error initializing tracer: %v", err)
 	}
+	var cleanups []func()
+	defer func() {
+		if err == nil {
+			return
+		}
+		for i := len(cleanups) - 1; i >= 0; i-- {
+			cleanups[i]()
+		}
+	}()
+	if closer != nil {
+		cleanups = append(cleanups, func() { closer.Close() })
+	}
 
 	parser := serde.New(appCfg.ProtoParser)
 
+	prx, err := getProxy(&appCfg)
+	if err != nil {
+		return nil, err
+	}
+	if prx != nil {
+		cleanups = append(cleanups, prx.Close)
+	}
+	broker, err := getFakeBroker(appCfg)
+	if err != nil {
+		return nil, err
+	}
+	tracker, err := getMirror(&appCfg, parser)
+	if err != nil {
+		return nil, err
+	}
+
+	adm, err := getAdmin(appCfg)
+	if err != nil {
+		return nil, err
+	}
+	if adm != nil {
+		cleanups = append(cleanups, func() {
+			if err := adm.Teardown(context.Background()); err != nil {
+				logger.Errorf("error tearing down topics: %v", err)
+			}
+			adm.Close()
+		})
+	}
+	cl, snapshot, err := getCluster(appCfg)
+	if err != nil {
+		return nil, err
+	}
+	if cl != nil {
+		cleanups = append(cleanups, cl.Close)
+	}
+
+	reconciler, err := getReconciler(appCfg, parser)
+	if err != nil {
+		return nil, err
+	}
+	if reconciler != nil {
+		cleanups = append(cleanups, func() { reconciler.Close() })
+	}
+
 	var wg sync.WaitGroup
 
-	kafkaProducer, err := getProducer(appCfg.Producer, parser)
+	kafkaProducer, err := getProducer(appCfg, parser, broker)
 	if err != nil {
 		return nil, err
 	}
+	if kafkaProducer != nil {
+		cleanups = append(cleanups, func() { kafkaProducer.Close() })
+	}
 
 	traceID := func(t store.Trace) string { return t.Message.ID }
 	ms, err := store.New(appCfg, traceID)
 	if err != nil {
 		return nil, err
 	}
+	if msCloser, ok := ms.(io.Closer); ok {
+		cleanups = append(cleanups, func() { msCloser.Close() })
+	}
 	var consWg sync.WaitGroup
-	kafkaConsumer, err := getConsumer(appCfg, ms, &consWg, parser)
+	kafkaConsumer, err := getConsumer(appCfg, ms, &consWg, parser, broker, tracker)
+	if err != nil {
+		return nil, err
+	}
+	if kafkaConsumer != nil {
+		cleanups = append(cleanups, kafkaConsumer.Close)
+	}
+	// the run duration starts once all the instances are ready
+	coord, err := getCoordinator(appCfg, ms)
 	if err != nil {
 		return nil, err
 	}
@@ -167,12 +609,22 @@ func setup(appCfg config.Application) (*application, error) {
 		ctx:         ctx,
 		cancel:      cancel,
 		traceCloser: closer,
+		admin:       adm,
+		cluster:     cl,
+		snapshot:    snapshot,
+		reconciler:  reconciler,
+		proxy:       prx,
+		mirror:      tracker,
+		coordinator: coord,
 	}
 	if kafkaProducer != nil {
 		librdTags := reporter.LibrdTags{ClusterName: appCfg.Producer.ClusterName,
 			Ack:   strconv.Itoa(appCfg.Librdconfigs.RequestRequiredAcks),
-			Topic: appCfg.Producer.Topic}
+			Topic: strings.Join(appCfg.Producer.TopicNames(), ",")}
 		app.Handler = producer.NewHandler(kafkaProducer.Events(), &wg, ms, parser, librdTags, appCfg.Librdconfigs.Enabled)
+		if tracker != nil {
+			app.Handler.Register(tracker.Delivered())
+		}
 	}
 	go app.registerSignalHandler()
 	return app, nil
@@ -183,6 +635,8 @@ func (app *application) registerSignalHandler() {
 
 	exit := make(chan os.Signal, 1)
 	signal.Notify(exit, syscall.SIGINT, syscall.SIGTERM)
+	// runs started through the control api don't keep listening once done
+	defer signal.Stop(exit)
 	app.WaitGroup.Add(1)
 	select {
 	case <-app.ctx.Done():
@@ -2,6 +2,8 @@ package config
 
 import (
 	"fmt"
+	"sort"
+	"strings"
 	"time"
 
 	"gopkg.in/confluentinc/confluent-kafka-go.v1/kafka"
@@ -16,6 +18,14 @@ type Application struct {
 	LibrdConfigs
 	Jaeger
 	ProtoParser
+	Admin
+	Cluster
+	Reconcile
+	Proxy
+	FakeBroker
+	Mirror
+	Coordinator
+	Control
 }
 
 type Config struct {
@@ -33,8 +43,10 @@ type LibrdConfigs struct {
 }
 
 type Producer struct {
-	Enabled          bool   `default:"true"`
-	Topic            string `default:"kafqa_test" envconfig:"KAFKA_TOPIC"`
+	Enabled bool   `default:"true"`
+	Topic   string `default:"kafqa_test" envconfig:"KAFKA_TOPIC"`
+	// topics with their weights eg: kafqa_a:3,kafqa_b:1, overrides KAFKA_TOPIC
+	Topics           map[string]int
 	Concurrency      int    `default:"100"`
 	TotalMessages    int64  `split_words:"true" default:"10000"`
 	KafkaBrokers     string `split_words:"true"`
@@ -43,16 +55,33 @@ type Producer struct {
 	ssl              SSL
 	DelayMs          int `split_words:"true" default:"1000"`
 	WorkerDelayMs    int `split_words:"true" default:"50"`
+	Rate             int `default:"0"`
 	Acks             int `default:"1"`
 	Librdconfigs     LibrdConfigs
 	ClusterName      string `envconfig:"KAFKA_CLUSTER"`
 	CompressionType  string `default:"none"`
+	ChecksumEnabled  bool   `split_words:"true" default:"false"`
+	ID               string
+	// static or templated headers eg: env:staging,run:{run_id},producer:{producer_id},seq:{sequence},id:{message_id}
+	Headers            map[string]string
+	HeaderPaddingBytes int `split_words:"true" default:"0"`
+	// share of messages padded beyond message.max.bytes or produced to a non-existent partition
+	FaultOversizedRate        float64 `split_words:"true" default:"0"`
+	FaultOversizedBytes       int     `split_words:"true" default:"2000000"`
+	FaultInvalidPartitionRate float64 `split_words:"true" default:"0"`
+	// bursts produced at once to overflow queue.buffering.max.messages
+	FaultBurstIntervalMs int `split_words:"true" default:"0"`
+	FaultBurstSize       int `split_words:"true" default:"0"`
+	// short delivery timeout so messages to slow brokers expire, 0 keeps the librdkafka default
+	FaultMessageTimeoutMs int `split_words:"true" default:"0"`
 }
 
 type Consumer struct {
 	// TODO: remove tags and load with split words while processing
-	Enabled          bool   `default:"true"`
-	Topic            string `default:"kafqa_test" envconfig:"KAFKA_TOPIC"`
+	Enabled bool   `default:"true"`
+	Topic   string `default:"kafqa_test" envconfig:"KAFKA_TOPIC"`
+	// topics or regex subscriptions starting with ^ eg: kafqa_a,^kafqa-.*, overrides KAFKA_TOPIC
+	Topics           []string
 	Concurrency      int    `default:"20"`
 	KafkaBrokers     string `split_words:"true"`
 	GroupID          string `split_words:"true" default:"kafqa_test_consumer"`
@@ -61,8 +90,191 @@ type Consumer struct {
 	SecurityProtocol string `split_words:"true" default:"PLAINTEXT"`
 	EnableAutoCommit bool   `split_words:"true" default:"true"`
 	WorkerDelayMs    int    `split_words:"true" default:"0"`
-	ssl              SSL
-	LibrdConfigs     LibrdConfigs
+	ExpectHeaders    bool   `split_words:"true" default:"false"`
+	// callbacks of the consumed messages run on a fixed pool, consumption blocks once the queue is full
+	CallbackWorkers   int `split_words:"true" default:"20"`
+	CallbackQueueSize int `split_words:"true" default:"1000"`
+	// process the messages of a partition in order on the same worker
+	OrderedCallbacks bool `split_words:"true" default:"false"`
+	// poll batches of messages without the worker delay, committed by batch when auto commit is disabled
+	BatchEnabled   bool `split_words:"true" default:"false"`
+	BatchSize      int  `split_words:"true" default:"500"`
+	BatchTimeoutMs int  `split_words:"true" default:"100"`
+	// with auto commit disabled offsets are committed once the callbacks of the messages completed:
+	// sync on completion, async in the background, periodic by interval or count, or store for auto commit
+	CommitStrategy      string `split_words:"true" default:"sync"`
+	CommitIntervalMs    int    `split_words:"true" default:"5000"`
+	CommitEveryMessages int    `split_words:"true" default:"0"`
+	// fault injection: processing delay of every message from the distribution (fixed, uniform, normal or exponential)
+	FaultDelayMs           int     `split_words:"true" default:"0"`
+	FaultDelayJitterMs     int     `split_words:"true" default:"0"`
+	FaultDelayDistribution string  `split_words:"true" default:"fixed"`
+	FaultFailureRate       float64 `split_words:"true" default:"0"`
+	// consumers stop polling for the pause every interval, longer than max.poll.interval.ms to be kicked out of the group
+	FaultPauseIntervalMs int `split_words:"true" default:"0"`
+	FaultPauseMs         int `split_words:"true" default:"0"`
+	// consumers are closed and recreated every interval
+	FaultCrashIntervalMs int `split_words:"true" default:"0"`
+	// assign the partitions directly instead of subscribing with the consumer group
+	AssignEnabled bool `split_words:"true" default:"false"`
+	// partitions assigned of every topic eg: 0,1,2, all partitions when empty
+	AssignPartitions []int32 `split_words:"true"`
+	// offset the assigned partitions are read from: committed, earliest, latest, offset or timestamp
+	StartFrom        string `split_words:"true" default:"committed"`
+	StartOffset      int64  `split_words:"true" default:"0"`
+	StartTimestampMs int64  `split_words:"true" default:"0"`
+	// assigned partitions are read until the end offset (exclusive) or the offset of the end timestamp, -1 and 0 disable them
+	EndOffset      int64 `split_words:"true" default:"-1"`
+	EndTimestampMs int64 `split_words:"true" default:"0"`
+	// measure latency until the message timestamp rather than consumption, for replaying a historical window
+	ReplayLatency bool `split_words:"true" default:"false"`
+	ssl           SSL
+	LibrdConfigs  LibrdConfigs
+}
+
+type Admin struct {
+	CreateTopics      bool `split_words:"true" default:"false"`
+	ValidateTopics    bool `split_words:"true" default:"false"`
+	DeleteTopics      bool `split_words:"true" default:"false"`
+	Partitions        int  `default:"0"`
+	ReplicationFactor int  `split_words:"true" default:"0"`
+	// topic configs eg: min.insync.replicas:2,retention.ms:3600000,compression.type:lz4
+	TopicConfigs map[string]string `split_words:"true"`
+	TimeoutMs    int               `split_words:"true" default:"30000"`
+}
+
+type Cluster struct {
+	SnapshotEnabled   bool `split_words:"true" default:"false"`
+	MonitorEnabled    bool `split_words:"true" default:"false"`
+	MonitorIntervalMs int  `split_words:"true" default:"5000"`
+	MetadataTimeoutMs int  `split_words:"true" default:"10000"`
+}
+
+func (c Cluster) Enabled() bool {
+	return c.SnapshotEnabled || c.MonitorEnabled
+}
+
+func (c Cluster) MonitorInterval() time.Duration {
+	return time.Duration(c.MonitorIntervalMs) * time.Millisecond
+}
+
+type Reconcile struct {
+	Enabled   bool `default:"false"`
+	TimeoutMs int  `split_words:"true" default:"5000"`
+	// maximum unacknowledged messages re-read from the broker, -1 reads all of them
+	Limit int `default:"1000"`
+}
+
+func (r Reconcile) Timeout() time.Duration {
+	return time.Duration(r.TimeoutMs) * time.Millisecond
+}
+
+// Proxy forwards the kafka connections through local listeners degrading the network, plaintext only
+type Proxy struct {
+	Enabled bool   `default:"false"`
+	Host    string `default:"127.0.0.1"`
+	// added to every request and response, jitter is drawn uniformly in ± jitter
+	LatencyMs            int `split_words:"true" default:"0"`
+	JitterMs             int `split_words:"true" default:"0"`
+	BandwidthBytesPerSec int `split_words:"true" default:"0"`
+	// probability of resetting the connection on every request and response
+	ResetRate float64 `split_words:"true" default:"0"`
+	// all brokers are unreachable for the duration every interval
+	PartitionIntervalMs int `split_words:"true" default:"0"`
+	PartitionDurationMs int `split_words:"true" default:"0"`
+	DialTimeoutMs       int `split_words:"true" default:"5000"`
+}
+
+func (p Proxy) Latency() time.Duration {
+	return time.Duration(p.LatencyMs) * time.Millisecond
+}
+
+func (p Proxy) Jitter() time.Duration {
+	return time.Duration(p.JitterMs) * time.Millisecond
+}
+
+func (p Proxy) PartitionInterval() time.Duration {
+	return time.Duration(p.PartitionIntervalMs) * time.Millisecond
+}
+
+func (p Proxy) PartitionDuration() time.Duration {
+	return time.Duration(p.PartitionDurationMs) * time.Millisecond
+}
+
+func (p Proxy) DialTimeout() time.Duration {
+	return time.Duration(p.DialTimeoutMs) * time.Millisecond
+}
+
+// FakeBroker runs kafqa against an in-memory broker instead of a cluster, to test loss and duplicate detection
+type FakeBroker struct {
+	Enabled         bool `default:"false"`
+	Partitions      int  `default:"3"`
+	MaxMessageBytes int  `split_words:"true" default:"1000000"`
+	// share of the messages acknowledged but dropped, appended twice or appended after the next one
+	DropRate      float64 `split_words:"true" default:"0"`
+	DuplicateRate float64 `split_words:"true" default:"0"`
+	ReorderRate   float64 `split_words:"true" default:"0"`
+	DelayMs       int     `split_words:"true" default:"0"`
+	// faults drawn are reproducible with a seed, 0 draws a random one
+	Seed int64 `default:"0"`
+}
+
+func (f FakeBroker) Delay() time.Duration {
+	return time.Duration(f.DelayMs) * time.Millisecond
+}
+
+// Mirror consumes the produced topics from the cluster they're mirrored to, eg: by MirrorMaker 2
+type Mirror struct {
+	Enabled bool `default:"false"`
+	// prefix of the mirrored topics eg: source. for MirrorMaker 2 with the source cluster alias
+	TopicPrefix string `split_words:"true"`
+	// mirrored topic by source topic eg: kafqa_test:kafqa_test_mirror, overrides the prefix
+	Topics map[string]string
+	// messages consumed from the mirror without a delivery report from the source by then are duplicates
+	DeliveryTimeoutMs int64 `split_words:"true" default:"30000"`
+}
+
+func (m Mirror) DeliveryTimeout() time.Duration {
+	return time.Duration(m.DeliveryTimeoutMs) * time.Millisecond
+}
+
+func (m Mirror) Target(source string) string {
+	if target, ok := m.Topics[source]; ok {
+		return target
+	}
+	return m.TopicPrefix + source
+}
+
+// Coordinator runs the instances sharing the redis store of STORE_RUN_ID as a single run
+type Coordinator struct {
+	Enabled bool `default:"false"`
+	// defaults to the hostname
+	ID string
+	// instances waited for at the barrier before producing, and for their results before reporting
+	Instances int `default:"1"`
+	// the aggregator prints the report of the run, the others only push their results
+	Aggregator       bool  `default:"false"`
+	BarrierTimeoutMs int64 `split_words:"true" default:"300000"`
+	ReportTimeoutMs  int64 `split_words:"true" default:"60000"`
+	PollIntervalMs   int64 `split_words:"true" default:"500"`
+}
+
+func (c Coordinator) BarrierTimeout() time.Duration {
+	return time.Duration(c.BarrierTimeoutMs) * time.Millisecond
+}
+
+func (c Coordinator) ReportTimeout() time.Duration {
+	return time.Duration(c.ReportTimeoutMs) * time.Millisecond
+}
+
+func (c Coordinator) PollInterval() time.Duration {
+	return time.Duration(c.PollIntervalMs) * time.Millisecond
+}
+
+// Control serves the http api starting and driving the runs, instead of running once
+type Control struct {
+	Enabled bool `default:"false"`
+	Port    int  `default:"9997"`
 }
 
 type SSL struct {
@@ -94,9 +306,71 @@ type PProf struct {
 }
 
 type Store struct {
-	Type      string `default:"memory"`
-	RunID     string `split_words:"true"`
-	RedisHost string `split_words:"true"`
+	// memory, redis, windowed or file
+	Type  string `default:"memory"`
+	RunID string `split_words:"true"`
+	// memory store is sharded by trace id when more than 1, reduces lock contention at high throughput
+	Shards int `default:"1"`
+	// file store journal, reused across restarts of the run
+	FilePath           string `split_words:"true" default:"kafqa.store"`
+	FileSyncIntervalMs int64  `split_words:"true" default:"1000"`
+	// windowed store counts messages not acknowledged within the deadline as lost
+	LossDeadlineMs       int64  `split_words:"true" default:"60000"`
+	SweepIntervalMs      int64  `split_words:"true" default:"1000"`
+	RedisHost            string `split_words:"true"`
+	RedisBatchSize       int    `split_words:"true" default:"1"`
+	RedisFlushIntervalMs int64  `split_words:"true" default:"100"`
+	RedisKeyTTLMs        int64  `split_words:"true" default:"0"`
+	// ids buffered while redis can't be written to, the oldest are dropped and reported beyond it, 0 doesn't bound them
+	RedisMaxPending int `split_words:"true" default:"100000"`
+	// ids tracked before the window are removed from redis, 0 keeps them for the whole run
+	RedisExpireAfterMs int64 `split_words:"true" default:"0"`
+	RedisCleanup       bool  `split_words:"true" default:"false"`
+	// single, sentinel or cluster, STORE_REDIS_HOST takes comma separated sentinel or cluster node addresses
+	RedisMode           string `split_words:"true" default:"single"`
+	RedisSentinelMaster string `split_words:"true"`
+	RedisUser           string `split_words:"true"`
+	RedisPassword       string `split_words:"true"`
+	RedisDB             int    `split_words:"true" default:"0"`
+	RedisTLSEnabled     bool   `split_words:"true" default:"false"`
+	RedisTLSSkipVerify  bool   `split_words:"true" default:"false"`
+	RedisCALocation     string `split_words:"true"`
+	RedisCertLocation   string `split_words:"true"`
+	RedisKeyLocation    string `split_words:"true"`
+}
+
+func (s Store) RedisAddrs() []string {
+	var addrs []string
+	for _, addr := range strings.Split(s.RedisHost, ",") {
+		if addr = strings.TrimSpace(addr); addr != "" {
+			addrs = append(addrs, addr)
+		}
+	}
+	return addrs
+}
+
+func (s Store) FileSyncInterval() time.Duration {
+	return time.Duration(s.FileSyncIntervalMs) * time.Millisecond
+}
+
+func (s Store) LossDeadline() time.Duration {
+	return time.Duration(s.LossDeadlineMs) * time.Millisecond
+}
+
+func (s Store) SweepInterval() time.Duration {
+	return time.Duration(s.SweepIntervalMs) * time.Millisecond
+}
+
+func (s Store) RedisFlushInterval() time.Duration {
+	return time.Duration(s.RedisFlushIntervalMs) * time.Millisecond
+}
+
+func (s Store) RedisKeyTTL() time.Duration {
+	return time.Duration(s.RedisKeyTTLMs) * time.Millisecond
+}
+
+func (s Store) RedisExpireAfter() time.Duration {
+	return time.Duration(s.RedisExpireAfterMs) * time.Millisecond
 }
 
 type Jaeger struct {
@@ -124,6 +398,19 @@ type Reporter struct {
 	Prometheus
 	Statsd
 	PProf
+	Report
+}
+
+type Report struct {
+	// table or json
+	Format string `default:"table"`
+	// lost messages listed individually, ranges are always reported, -1 lists all of them.
+	// 0 with the redis store doesn't keep the offsets of the messages, so neither are reported unless reconciling
+	LostLimit int `split_words:"true" default:"100"`
+}
+
+func (r Report) JSON() bool {
+	return r.Format == "json"
 }
 
 func App() Application {
@@ -146,7 +433,7 @@ func (a Application) DevEnvironment() bool {
 }
 
 func (p Producer) KafkaConfig() *kafka.ConfigMap {
-	return &kafka.ConfigMap{
+	cfg := &kafka.ConfigMap{
 		KafkaBootstrapServerKey:           p.KafkaBrokers,
 		SecurityProtocol:                  p.SecurityProtocol,
 		SSLCALocation:                     p.ssl.CALocation,
@@ -159,10 +446,50 @@ func (p Producer) KafkaConfig() *kafka.ConfigMap {
 		LibrdStatisticsIntervalMs:         p.Librdconfigs.StatisticsIntervalMs,
 		CompressionType:                   p.CompressionType,
 	}
+	if p.FaultMessageTimeoutMs > 0 {
+		(*cfg)[ProducerMessageTimeoutMs] = p.FaultMessageTimeoutMs
+	}
+	return cfg
+}
+
+func (p Producer) TopicWeights() map[string]int {
+	if len(p.Topics) == 0 {
+		return map[string]int{p.Topic: 1}
+	}
+	return p.Topics
+}
+
+func (p Producer) TopicNames() []string {
+	var topics []string
+	for t := range p.TopicWeights() {
+		topics = append(topics, t)
+	}
+	sort.Strings(topics)
+	return topics
+}
+
+func (p Producer) AdminConfig() *kafka.ConfigMap {
+	return adminConfig(p.KafkaBrokers, p.SecurityProtocol, p.ssl)
+}
+
+// ReaderConfig is used to read back produced messages at their offsets without committing
+func (p Producer) ReaderConfig() *kafka.ConfigMap {
+	cfg := adminConfig(p.KafkaBrokers, p.SecurityProtocol, p.ssl)
+	(*cfg)[ConsumerGroupIDKey] = "kafqa_reconcile"
+	(*cfg)[EnableAutoCommit] = false
+	return cfg
+}
+
+func (p Producer) FaultBurstInterval() time.Duration {
+	return time.Duration(p.FaultBurstIntervalMs) * time.Millisecond
+}
+
+func (p Producer) HeadersEnabled() bool {
+	return len(p.Headers) > 0 || p.HeaderPaddingBytes > 0
 }
 
 func (c Consumer) KafkaConfig() *kafka.ConfigMap {
-	return &kafka.ConfigMap{
+	cfg := &kafka.ConfigMap{
 		KafkaBootstrapServerKey:   c.KafkaBrokers,
 		ConsumerOffsetResetKey:    c.OffsetReset,
 		ConsumerGroupIDKey:        c.GroupID,
@@ -175,16 +502,87 @@ func (c Consumer) KafkaConfig() *kafka.ConfigMap {
 		ConsumerQueuedMinMessages: c.LibrdConfigs.QueuedMinMessages,
 		LibrdStatisticsIntervalMs: c.LibrdConfigs.StatisticsIntervalMs,
 	}
+	// processed offsets are stored explicitly and committed by librdkafka
+	if !c.EnableAutoCommit && c.CommitStrategy == "store" {
+		(*cfg)[EnableAutoCommit] = true
+		(*cfg)[EnableAutoOffsetStore] = false
+	}
+	return cfg
+}
+
+func (c Consumer) Subscriptions() []string {
+	if len(c.Topics) == 0 {
+		return []string{c.Topic}
+	}
+	return c.Topics
+}
+
+func (c Consumer) TopicNames() []string {
+	var topics []string
+	for _, t := range c.Subscriptions() {
+		if !strings.HasPrefix(t, "^") {
+			topics = append(topics, t)
+		}
+	}
+	return topics
+}
+
+// Bounded is true when the assigned partitions are read until an end offset
+func (c Consumer) Bounded() bool {
+	return c.AssignEnabled && (c.EndOffset >= 0 || c.EndTimestampMs > 0)
+}
+
+func (c Consumer) AdminConfig() *kafka.ConfigMap {
+	return adminConfig(c.KafkaBrokers, c.SecurityProtocol, c.ssl)
 }
 
 func (c Consumer) PollTimeout() time.Duration {
 	return time.Duration(c.PollTimeoutMs) * time.Millisecond
 }
 
+func (c Consumer) FaultPauseInterval() time.Duration {
+	return time.Duration(c.FaultPauseIntervalMs) * time.Millisecond
+}
+
+func (c Consumer) FaultPause() time.Duration {
+	return time.Duration(c.FaultPauseMs) * time.Millisecond
+}
+
+func (c Consumer) FaultCrashInterval() time.Duration {
+	return time.Duration(c.FaultCrashIntervalMs) * time.Millisecond
+}
+
+func (c Consumer) CommitInterval() time.Duration {
+	return time.Duration(c.CommitIntervalMs) * time.Millisecond
+}
+
+func (c Consumer) BatchTimeout() time.Duration {
+	return time.Duration(c.BatchTimeoutMs) * time.Millisecond
+}
+
 func (c Consumer) MessageLoopDelay() time.Duration {
 	return time.Duration(c.WorkerDelayMs) * time.Millisecond
 }
 
+func adminConfig(brokers, securityProtocol string, ssl SSL) *kafka.ConfigMap {
+	return &kafka.ConfigMap{
+		KafkaBootstrapServerKey: brokers,
+		SecurityProtocol:        securityProtocol,
+		SSLCALocation:           ssl.CALocation,
+		SSLKeyLocation:          ssl.KeyLocation,
+		SSLKeyPassword:          ssl.KeyPassword,
+		SSLCertLocation:         ssl.CertificateLocation,
+	}
+}
+
+func (a Admin) Enabled() bool {
+	return a.CreateTopics || a.ValidateTopics || a.DeleteTopics
+}
+
+func (a Admin) Timeout() time.Duration {
+	return time.Duration(a.TimeoutMs) * time.Millisecond
+}
+
 func (j Jaeger) AgentHostPort() string {
 	return fmt.Sprintf("%s:%d", j.AgentHost, j.AgentPort)
 }
@@ -4,6 +4,7 @@ const KafkaBootstrapServerKey string = "bootstrap.servers"
 const ConsumerGroupIDKey string = "group.id"
 const ConsumerOffsetResetKey string = "auto.offset.reset"
 const EnableAutoCommit string = "enable.auto.commit"
+const EnableAutoOffsetStore string = "enable.auto.offset.store"
 
 const SecurityProtocol string = "security.protocol"
 const SSLCertificateLocation string = "ssl.certificate.location"
@@ -15,6 +16,7 @@ const SSLKeyPassword string = "ssl.key.password"
 const ProducerQueueBufferingMaxMessages string = "queue.buffering.max.messages"
 const ProducerBatchNumMessages string = "batch.num.messages"
 const ProduceRequestRequiredAcks string = "request.required.acks"
+const ProducerMessageTimeoutMs string = "message.timeout.ms"
 
 const ConsumerQueuedMinMessages string = "queued.min.messages"
 
@@ -1,6 +1,11 @@
 package config
 
 import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+
 	"github.com/hashicorp/go-multierror"
 	"github.com/kelseyhightower/envconfig"
 )
@@ -16,18 +21,13 @@ func Load() error {
 		"PRODUCER": &producerSslCfg,
 	}
 
-	configs := map[string]interface{}{
-		"STORE":        &application.Store,
-		"PRODUCER":     &application.Producer,
-		"CONSUMER":     &application.Consumer,
-		"LIBRD":        &librdConfigs,
-		"APP":          &application.Config,
-		"PROMETHEUS":   &application.Reporter.Prometheus,
-		"STATSD":       &application.Reporter.Statsd,
-		"JAEGER":       &application.Jaeger,
-		"PROTO_PARSER": &application.ProtoParser,
-		"PPROF":        &application.Reporter.PProf,
-	}
+	configs := runConfigs(&application)
+	configs["LIBRD"] = &librdConfigs
+	configs["PROMETHEUS"] = &application.Reporter.Prometheus
+	configs["STATSD"] = &application.Reporter.Statsd
+	configs["JAEGER"] = &application.Jaeger
+	configs["PPROF"] = &application.Reporter.PProf
+	configs["CONTROL"] = &application.Control
 	if err := loadConfigs(configs); err != nil {
 		return err
 	}
@@ -42,6 +42,89 @@ func Load() error {
 	return nil
 }
 
+// runConfigs are the configs of a run by env prefix, the others are set up once for the process
+func runConfigs(app *Application) map[string]interface{} {
+	return map[string]interface{}{
+		"STORE":        &app.Store,
+		"PRODUCER":     &app.Producer,
+		"CONSUMER":     &app.Consumer,
+		"APP":          &app.Config,
+		"PROTO_PARSER": &app.ProtoParser,
+		"REPORT":       &app.Reporter.Report,
+		"ADMIN":        &app.Admin,
+		"CLUSTER":      &app.Cluster,
+		"RECONCILE":    &app.Reconcile,
+		"PROXY":        &app.Proxy,
+		"FAKE_BROKER":  &app.FakeBroker,
+		"MIRROR":       &app.Mirror,
+		"COORDINATOR":  &app.Coordinator,
+	}
+}
+
+// Override sets the fields given in json on the run configs, keyed by their env prefix in lower case
+// eg: {"producer": {"TotalMessages": 1000, "Rate": 200}, "app": {"DurationMs": 60000}}
+func Override(app Application, data []byte) (Application, error) {
+	var sections map[string]json.RawMessage
+	if err := json.Unmarshal(data, &sections); err != nil {
+		return app, fmt.Errorf("invalid config: %v", err)
+	}
+	configs := runConfigs(&app)
+	for name, section := range sections {
+		cfg, ok := configs[strings.ToUpper(name)]
+		if !ok {
+			return app, fmt.Errorf("unknown config %s", name)
+		}
+		var fields map[string]json.RawMessage
+		if err := json.Unmarshal(section, &fields); err != nil {
+			return app, fmt.Errorf("invalid %s config: %v", name, err)
+		}
+		set := make(map[string]bool, len(fields))
+		for field := range fields {
+			set[strings.ToLower(field)] = true
+		}
+		copyCollections(reflect.ValueOf(cfg).Elem(), set)
+		if err := json.Unmarshal(section, cfg); err != nil {
+			return app, fmt.Errorf("invalid %s config: %v", name, err)
+		}
+	}
+	return app, nil
+}
+
+// copyCollections gives the config its own maps and slices so overriding it doesn't change the one it was
+// copied from, the ones set are emptied to be replaced rather than merged with
+func copyCollections(v reflect.Value, set map[string]bool) {
+	for i := 0; i < v.NumField(); i++ {
+		field, sf := v.Field(i), v.Type().Field(i)
+		if !field.CanSet() {
+			continue
+		}
+		switch field.Kind() {
+		case reflect.Struct:
+			if sf.Anonymous {
+				copyCollections(field, set)
+			} else {
+				copyCollections(field, nil)
+			}
+		case reflect.Map:
+			if field.IsNil() || set[strings.ToLower(sf.Name)] {
+				field.Set(reflect.Zero(sf.Type))
+				continue
+			}
+			copied := reflect.MakeMapWithSize(sf.Type, field.Len())
+			for _, key := range field.MapKeys() {
+				copied.SetMapIndex(key, field.MapIndex(key))
+			}
+			field.Set(copied)
+		case reflect.Slice:
+			if field.IsNil() || set[strings.ToLower(sf.Name)] {
+				field.Set(reflect.Zero(sf.Type))
+				continue
+			}
+			field.Set(reflect.AppendSlice(reflect.MakeSlice(sf.Type, 0, field.Len()), field))
+		}
+	}
+}
+
 func loadConfigs(configs map[string]interface{}) error {
 	var errs multierror.Error
 	for prefix, cfg := range configs {
@@ -49,6 +49,83 @@ func TestShouldLoadKafkaSSLConfig(t *testing.T) {
 	assert.Equal(t, "cons.key", kafkaCfg[SSLKeyLocation])
 }
 
+func TestShouldLoadProducerHeaders(t *testing.T) {
+	envs := map[string]string{
+		"PRODUCER_TOTAL_MESSAGES":       "0",
+		"PRODUCER_HEADERS":              "env:staging,run:{run_id}",
+		"PRODUCER_HEADER_PADDING_BYTES": "128",
+	}
+	older := setEnvs(envs)
+	defer setEnvs(older)
+
+	err := Load()
+
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{"env": "staging", "run": "{run_id}"}, application.Producer.Headers)
+	assert.Equal(t, 128, application.Producer.HeaderPaddingBytes)
+	assert.True(t, application.Producer.HeadersEnabled())
+}
+
+func TestShouldStoreOffsetsForAutoCommitWithStoreStrategy(t *testing.T) {
+	envs := map[string]string{
+		"PRODUCER_TOTAL_MESSAGES":     "0",
+		"CONSUMER_ENABLE_AUTO_COMMIT": "false",
+		"CONSUMER_COMMIT_STRATEGY":    "store",
+	}
+	older := setEnvs(envs)
+	defer setEnvs(older)
+
+	err := Load()
+
+	require.NoError(t, err)
+	kafkaCfg := *application.Consumer.KafkaConfig()
+	assert.Equal(t, true, kafkaCfg[EnableAutoCommit])
+	assert.Equal(t, false, kafkaCfg[EnableAutoOffsetStore])
+	assert.Equal(t, 5*time.Second, application.Consumer.CommitInterval())
+}
+
+func TestShouldLoadRedisStoreConfig(t *testing.T) {
+	envs := map[string]string{
+		"PRODUCER_TOTAL_MESSAGES":     "0",
+		"STORE_REDIS_BATCH_SIZE":      "500",
+		"STORE_REDIS_KEY_TTL_MS":      "60000",
+		"STORE_REDIS_EXPIRE_AFTER_MS": "30000",
+		"STORE_REDIS_CLEANUP":         "true",
+	}
+	older := setEnvs(envs)
+	defer setEnvs(older)
+
+	err := Load()
+
+	require.NoError(t, err)
+	assert.Equal(t, 500, application.Store.RedisBatchSize)
+	assert.Equal(t, 100*time.Millisecond, application.Store.RedisFlushInterval())
+	assert.Equal(t, time.Minute, application.Store.RedisKeyTTL())
+	assert.Equal(t, 30*time.Second, application.Store.RedisExpireAfter())
+	assert.True(t, application.Store.RedisCleanup)
+}
+
+func TestShouldLoadRedisSentinelConfig(t *testing.T) {
+	envs := map[string]string{
+		"PRODUCER_TOTAL_MESSAGES":     "0",
+		"STORE_REDIS_HOST":            "sentinel-1:26379, sentinel-2:26379",
+		"STORE_REDIS_MODE":            "sentinel",
+		"STORE_REDIS_SENTINEL_MASTER": "kafqa",
+		"STORE_REDIS_DB":              "3",
+		"STORE_REDIS_TLS_ENABLED":     "true",
+	}
+	older := setEnvs(envs)
+	defer setEnvs(older)
+
+	err := Load()
+
+	require.NoError(t, err)
+	assert.Equal(t, []string{"sentinel-1:26379", "sentinel-2:26379"}, application.Store.RedisAddrs())
+	assert.Equal(t, "kafqa", application.Store.RedisSentinelMaster)
+	assert.Equal(t, 3, application.Store.RedisDB)
+	assert.True(t, application.Store.RedisTLSEnabled)
+}
+
 func TestShouldLoadAgentConfig(t *testing.T) {
 	envs := map[string]string{
 		"AGENT_SCHEDULE_MS": "5",
@@ -68,7 +145,56 @@ func setEnvs(envs map[string]string) map[string]string {
 	backup := make(map[string]string)
 	for k, v := range envs {
 		backup[k] = os.Getenv(k)
+		if v == "" {
+			os.Unsetenv(k)
+			continue
+		}
 		os.Setenv(k, v)
 	}
 	return backup
 }
+
+func TestShouldSetMessageTimeoutForProducerFaults(t *testing.T) {
+	envs := map[string]string{
+		"PRODUCER_TOTAL_MESSAGES":           "0",
+		"PRODUCER_FAULT_MESSAGE_TIMEOUT_MS": "500",
+	}
+	older := setEnvs(envs)
+	defer setEnvs(older)
+
+	err := Load()
+
+	require.NoError(t, err)
+	assert.Equal(t, 500, (*application.Producer.KafkaConfig())[ProducerMessageTimeoutMs])
+	assert.Equal(t, 2000000, application.Producer.FaultOversizedBytes)
+}
+
+func TestShouldOverrideRunConfigsFromJSON(t *testing.T) {
+	app := Application{
+		Producer: Producer{Topic: "kafqa_test", TotalMessages: 10, Topics: map[string]int{"kafqa_a": 1}, Headers: map[string]string{"env": "staging"}},
+		Consumer: Consumer{Topics: []string{"kafqa_a", "kafqa_b"}},
+		Config:   Config{DurationMs: 1000},
+	}
+
+	overridden, err := Override(app, []byte(`{"producer": {"TotalMessages": 500, "Rate": 50, "Topics": {"kafqa_c": 2}},
+		"consumer": {"Topics": ["kafqa_c"]}, "app": {"DurationMs": 60000}}`))
+
+	require.NoError(t, err)
+	assert.Equal(t, "kafqa_test", overridden.Producer.Topic)
+	assert.Equal(t, int64(500), overridden.Producer.TotalMessages)
+	assert.Equal(t, 50, overridden.Producer.Rate)
+	assert.Equal(t, int64(60000), overridden.Config.DurationMs)
+	assert.Equal(t, map[string]int{"kafqa_c": 2}, overridden.Producer.Topics)
+	assert.Equal(t, []string{"kafqa_c"}, overridden.Consumer.Topics)
+	overridden.Producer.Headers["run"] = "1"
+	assert.Equal(t, int64(10), app.Producer.TotalMessages)
+	assert.Equal(t, map[string]int{"kafqa_a": 1}, app.Producer.Topics)
+	assert.Equal(t, map[string]string{"env": "staging"}, app.Producer.Headers)
+	assert.Equal(t, []string{"kafqa_a", "kafqa_b"}, app.Consumer.Topics)
+}
+
+func TestShouldNotOverrideProcessConfigs(t *testing.T) {
+	_, err := Override(Application{}, []byte(`{"prometheus": {"Port": 9000}}`))
+
+	assert.EqualError(t, err, "unknown config prometheus")
+}
@@ -0,0 +1,176 @@
+package consumer
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/gojek/kafqa/config"
+	"gopkg.in/confluentinc/confluent-kafka-go.v1/kafka"
+)
+
+const (
+	startCommitted = "committed"
+	startEarliest  = "earliest"
+	startLatest    = "latest"
+	startOffset    = "offset"
+	startTimestamp = "timestamp"
+
+	offsetsTimeoutMs = 10000
+)
+
+type offsetClient interface {
+	GetMetadata(topic *string, allTopics bool, timeoutMs int) (*kafka.Metadata, error)
+	OffsetsForTimes(times []kafka.TopicPartition, timeoutMs int) ([]kafka.TopicPartition, error)
+	QueryWatermarkOffsets(topic string, partition int32, timeoutMs int) (low, high int64, err error)
+}
+
+// assignment resolves the partitions to assign along with the offsets they're read from
+func assignment(cfg config.Consumer, client offsetClient) ([]kafka.TopicPartition, error) {
+	var tps []kafka.TopicPartition
+	for _, topic := range cfg.Subscriptions() {
+		if strings.HasPrefix(topic, "^") {
+			return nil, fmt.Errorf("regex subscription %s can't be assigned", topic)
+		}
+		ids := cfg.AssignPartitions
+		if len(ids) == 0 {
+			var err error
+			if ids, err = partitionIDs(client, topic); err != nil {
+				return nil, err
+			}
+		}
+		for _, id := range ids {
+			t := topic
+			tps = append(tps, kafka.TopicPartition{Topic: &t, Partition: id})
+		}
+	}
+
+	switch cfg.StartFrom {
+	case startCommitted:
+		return withOffset(tps, kafka.OffsetStored), nil
+	case startEarliest:
+		return withOffset(tps, kafka.OffsetBeginning), nil
+	case startLatest:
+		return withOffset(tps, kafka.OffsetEnd), nil
+	case startOffset:
+		return withOffset(tps, kafka.Offset(cfg.StartOffset)), nil
+	case startTimestamp:
+		return offsetsForTime(client, tps, cfg.StartTimestampMs)
+	}
+	return nil, fmt.Errorf("invalid start %s, expected one of committed, earliest, latest, offset or timestamp", cfg.StartFrom)
+}
+
+// endOffsets resolves the offset each assigned partition is read until, partitions without
+// messages to read between the start and end offsets are left out
+func endOffsets(cfg config.Consumer, client offsetClient, tps []kafka.TopicPartition) (map[partition]int64, error) {
+	var ends []kafka.TopicPartition
+	if cfg.EndTimestampMs > 0 {
+		var err error
+		if ends, err = offsetsForTime(client, tps, cfg.EndTimestampMs); err != nil {
+			return nil, err
+		}
+	} else {
+		ends = withOffset(tps, kafka.Offset(cfg.EndOffset))
+	}
+
+	starts := make(map[partition]kafka.Offset, len(tps))
+	for _, tp := range tps {
+		starts[partitionKey(tp)] = tp.Offset
+	}
+	offsets := make(map[partition]int64, len(ends))
+	for _, end := range ends {
+		low, high, err := client.QueryWatermarkOffsets(*end.Topic, end.Partition, offsetsTimeoutMs)
+		if err != nil {
+			return nil, fmt.Errorf("error querying offsets of %s[%d]: %v", *end.Topic, end.Partition, err)
+		}
+		last := int64(end.Offset)
+		// no message at or after the end timestamp, the partition is read until its current end
+		if last < 0 {
+			last = high
+		}
+		var first int64
+		switch start := starts[partitionKey(end)]; start {
+		case kafka.OffsetBeginning:
+			first = low
+		case kafka.OffsetEnd:
+			first = high
+		case kafka.OffsetStored:
+			// unknown until the committed offset is fetched, read at least once
+			first = low
+		default:
+			first = int64(start)
+			if first < 0 {
+				first = high
+			}
+		}
+		if last > first {
+			offsets[partitionKey(end)] = last
+		}
+	}
+	return offsets, nil
+}
+
+func partitionIDs(client offsetClient, topic string) ([]int32, error) {
+	md, err := client.GetMetadata(&topic, false, offsetsTimeoutMs)
+	if err != nil {
+		return nil, fmt.Errorf("error fetching metadata of %s: %v", topic, err)
+	}
+	tm, ok := md.Topics[topic]
+	if !ok || len(tm.Partitions) == 0 {
+		return nil, fmt.Errorf("topic %s has no partitions", topic)
+	}
+	ids := make([]int32, 0, len(tm.Partitions))
+	for _, p := range tm.Partitions {
+		ids = append(ids, p.ID)
+	}
+	return ids, nil
+}
+
+func offsetsForTime(client offsetClient, tps []kafka.TopicPartition, timestampMs int64) ([]kafka.TopicPartition, error) {
+	offsets, err := client.OffsetsForTimes(withOffset(tps, kafka.Offset(timestampMs)), offsetsTimeoutMs)
+	if err != nil {
+		return nil, fmt.Errorf("error fetching offsets for timestamp %d: %v", timestampMs, err)
+	}
+	return offsets, nil
+}
+
+func withOffset(tps []kafka.TopicPartition, offset kafka.Offset) []kafka.TopicPartition {
+	res := make([]kafka.TopicPartition, len(tps))
+	for i, tp := range tps {
+		tp.Offset = offset
+		res[i] = tp
+	}
+	return res
+}
+
+// partitionEnds tracks the partitions a consumer reads until their end offsets
+type partitionEnds map[partition]int64
+
+// consume reports whether the message is within the end offset, the partition is completed
+// with its last message
+func (p partitionEnds) consume(tp kafka.TopicPartition) bool {
+	key := partitionKey(tp)
+	end, ok := p[key]
+	if !ok {
+		return false
+	}
+	if int64(tp.Offset) >= end-1 {
+		delete(p, key)
+	}
+	return int64(tp.Offset) < end
+}
+
+func (p partitionEnds) done() bool {
+	return len(p) == 0
+}
+
+// split distributes the partitions round robin across at most n consumers
+func split(tps []kafka.TopicPartition, n int) [][]kafka.TopicPartition {
+	if n > len(tps) {
+		n = len(tps)
+	}
+	groups := make([][]kafka.TopicPartition, n)
+	for i, tp := range tps {
+		groups[i%n] = append(groups[i%n], tp)
+	}
+	return groups
+}
@@ -0,0 +1,150 @@
+package consumer
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/gojek/kafqa/config"
+	"github.com/gojek/kafqa/logger"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"gopkg.in/confluentinc/confluent-kafka-go.v1/kafka"
+)
+
+func offsetPartitions(topic string, offset kafka.Offset, ids ...int32) []kafka.TopicPartition {
+	return withOffset(topicPartitions(topic, ids...), offset)
+}
+
+func TestShouldAssignConfiguredPartitionsFromEarliest(t *testing.T) {
+	cfg := config.Consumer{Topic: "kafqa", AssignPartitions: []int32{1, 3}, StartFrom: "earliest"}
+
+	tps, err := assignment(cfg, new(offsetClientMock))
+
+	require.NoError(t, err)
+	assert.Equal(t, offsetPartitions("kafqa", kafka.OffsetBeginning, 1, 3), tps)
+}
+
+func TestShouldAssignAllPartitionsFromOffset(t *testing.T) {
+	client := new(offsetClientMock)
+	cfg := config.Consumer{Topic: "kafqa", StartFrom: "offset", StartOffset: 42}
+	client.On("GetMetadata", "kafqa").Return(&kafka.Metadata{Topics: map[string]kafka.TopicMetadata{
+		"kafqa": {Topic: "kafqa", Partitions: []kafka.PartitionMetadata{{ID: 0}, {ID: 1}}},
+	}}, nil)
+
+	tps, err := assignment(cfg, client)
+
+	require.NoError(t, err)
+	assert.Equal(t, offsetPartitions("kafqa", 42, 0, 1), tps)
+}
+
+func TestShouldAssignPartitionsFromTimestamp(t *testing.T) {
+	client := new(offsetClientMock)
+	cfg := config.Consumer{Topic: "kafqa", AssignPartitions: []int32{0}, StartFrom: "timestamp", StartTimestampMs: 1564668000000}
+	client.On("OffsetsForTimes", offsetPartitions("kafqa", 1564668000000, 0)).Return(offsetPartitions("kafqa", 120, 0), nil)
+
+	tps, err := assignment(cfg, client)
+
+	require.NoError(t, err)
+	assert.Equal(t, offsetPartitions("kafqa", 120, 0), tps)
+}
+
+func TestShouldFailAssignmentForInvalidStartOrRegex(t *testing.T) {
+	_, err := assignment(config.Consumer{Topic: "kafqa", AssignPartitions: []int32{0}, StartFrom: "middle"}, new(offsetClientMock))
+	assert.Error(t, err)
+
+	_, err = assignment(config.Consumer{Topics: []string{"^kafqa-.*"}, StartFrom: "earliest"}, new(offsetClientMock))
+	assert.Error(t, err)
+}
+
+func TestShouldResolveEndOffsetsSkippingPartitionsWithoutMessages(t *testing.T) {
+	client := new(offsetClientMock)
+	cfg := config.Consumer{EndTimestampMs: 1564671600000}
+	tps := append(offsetPartitions("kafqa", 10, 0), offsetPartitions("kafqa", 10, 1, 2)...)
+	client.On("OffsetsForTimes", offsetPartitions("kafqa", 1564671600000, 0, 1, 2)).
+		Return(append(offsetPartitions("kafqa", 50, 0, 1), offsetPartitions("kafqa", kafka.OffsetEnd, 2)...), nil)
+	client.On("QueryWatermarkOffsets", "kafqa", int32(0)).Return(int64(0), int64(100), nil)
+	client.On("QueryWatermarkOffsets", "kafqa", int32(1)).Return(int64(60), int64(100), nil)
+	client.On("QueryWatermarkOffsets", "kafqa", int32(2)).Return(int64(0), int64(80), nil)
+	tps[1].Offset = kafka.OffsetBeginning
+
+	ends, err := endOffsets(cfg, client, tps)
+
+	require.NoError(t, err)
+	assert.Equal(t, map[partition]int64{{topic: "kafqa", id: 0}: 50, {topic: "kafqa", id: 2}: 80}, ends)
+}
+
+func TestShouldConsumePartitionsUntilEndOffset(t *testing.T) {
+	ends := partitionEnds{{topic: "kafqa", id: 0}: 3, {topic: "kafqa", id: 1}: 1}
+
+	assert.True(t, ends.consume(offsetPartitions("kafqa", 1, 0)[0]))
+	assert.True(t, ends.consume(offsetPartitions("kafqa", 0, 1)[0]))
+	assert.False(t, ends.done())
+	assert.False(t, ends.consume(offsetPartitions("kafqa", 1, 1)[0]))
+	assert.True(t, ends.consume(offsetPartitions("kafqa", 2, 0)[0]))
+	assert.True(t, ends.done())
+}
+
+func TestShouldSplitPartitionsAcrossConsumers(t *testing.T) {
+	tps := topicPartitions("kafqa", 0, 1, 2)
+
+	assert.Equal(t, [][]kafka.TopicPartition{tps[0:1], tps[1:2], tps[2:3]}, split(tps, 5))
+	assert.Equal(t, [][]kafka.TopicPartition{{tps[0], tps[2]}, {tps[1]}}, split(tps, 2))
+}
+
+func TestShouldRejectConsumerWithoutConcurrency(t *testing.T) {
+	for _, assign := range []bool{false, true} {
+		_, err := New(config.Consumer{Topic: "kafqa", Concurrency: 0, AssignEnabled: assign})
+
+		assert.EqualError(t, err, "invalid consumer concurrency 0, expected at least 1")
+	}
+}
+
+func (s *ConsumerSuite) TestShouldCompleteWhenEndOffsetsAreReached() {
+	t := s.T()
+	logger.Setup("")
+	kafkaconsumer := new(consumerMock)
+	s.consumer.consumers = []consumer{kafkaconsumer}
+	s.consumer.config.EnableAutoCommit = true
+	s.consumer.ends = []partitionEnds{{{topic: "kafqa", id: 0}: 2}}
+	s.consumer.pending = 1
+	s.consumer.done = make(chan struct{})
+	kafkaconsumer.On("Close").Return(nil)
+	kafkaconsumer.On("ReadMessage", time.Duration(0)).Return(&kafka.Message{TopicPartition: offsetPartitions("kafqa", 0, 0)[0]}, nil).Once()
+	kafkaconsumer.On("ReadMessage", time.Duration(0)).Return(&kafka.Message{TopicPartition: offsetPartitions("kafqa", 1, 0)[0]}, nil).Once()
+	received := make(chan *kafka.Message, 2)
+	s.consumer.Register(func(msg *kafka.Message) { received <- msg })
+
+	s.consumer.Run(context.Background())
+
+	select {
+	case <-s.consumer.Done():
+	case <-time.After(5 * time.Second):
+		t.Fatal("consumer didn't complete at the end offset")
+	}
+	s.consumer.Close()
+	assert.Len(t, received, 2)
+	kafkaconsumer.AssertNumberOfCalls(t, "ReadMessage", 2)
+}
+
+type offsetClientMock struct {
+	mock.Mock
+}
+
+func (m *offsetClientMock) GetMetadata(topic *string, allTopics bool, timeoutMs int) (*kafka.Metadata, error) {
+	args := m.Called(*topic)
+	md, _ := args.Get(0).(*kafka.Metadata)
+	return md, args.Error(1)
+}
+
+func (m *offsetClientMock) OffsetsForTimes(times []kafka.TopicPartition, timeoutMs int) ([]kafka.TopicPartition, error) {
+	args := m.Called(times)
+	tps, _ := args.Get(0).([]kafka.TopicPartition)
+	return tps, args.Error(1)
+}
+
+func (m *offsetClientMock) QueryWatermarkOffsets(topic string, partition int32, timeoutMs int) (int64, int64, error) {
+	args := m.Called(topic, partition)
+	return args.Get(0).(int64), args.Get(1).(int64), args.Error(2)
+}
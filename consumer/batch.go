@@ -0,0 +1,52 @@
+package consumer
+
+import (
+	"time"
+
+	"github.com/gojek/kafqa/logger"
+	"github.com/gojek/kafqa/tracer"
+	"github.com/opentracing/opentracing-go"
+	"gopkg.in/confluentinc/confluent-kafka-go.v1/kafka"
+)
+
+// readBatch polls until the batch is full or the batch timeout passes since its first message,
+// the first poll waits up to the poll timeout for messages to arrive
+func (c *Consumer) readBatch(cons consumer, batches chan<- []*kafka.Message, id int) {
+	size := c.config.BatchSize
+	if size < 1 {
+		size = 1
+	}
+	batch := make([]*kafka.Message, 0, size)
+	timeout := c.config.PollTimeout()
+	var deadline time.Time
+	for len(batch) < size {
+		switch ev := cons.Poll(int(timeout / time.Millisecond)).(type) {
+		case *kafka.Message:
+			if ev.TopicPartition.Error != nil {
+				logger.Errorf("error consuming message on %v: %v", ev.TopicPartition, ev.TopicPartition.Error)
+			} else if c.accept(id, ev) {
+				batch = append(batch, ev)
+			}
+		case kafka.Error:
+			logger.Errorf("error consuming messages: %+v", ev)
+		}
+		if len(batch) == 0 {
+			return
+		}
+		if deadline.IsZero() {
+			deadline = time.Now().Add(c.config.BatchTimeout())
+		}
+		if timeout = time.Until(deadline); timeout <= 0 {
+			break
+		}
+	}
+
+	spans := make([]opentracing.Span, 0, len(batch))
+	for _, msg := range batch {
+		spans = append(spans, tracer.StartSpanFromMessage("kafqa.consumer", msg))
+	}
+	batches <- batch
+	for _, span := range spans {
+		span.Finish()
+	}
+}
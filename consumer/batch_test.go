@@ -0,0 +1,56 @@
+package consumer
+
+import (
+	"context"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"gopkg.in/confluentinc/confluent-kafka-go.v1/kafka"
+)
+
+func (s *ConsumerSuite) TestShouldReadMessagesInBatches() {
+	t := s.T()
+	kafkaconsumer := new(consumerMock)
+	s.consumer.config.BatchEnabled = true
+	s.consumer.config.BatchSize = 3
+	s.consumer.config.BatchTimeoutMs = 1000
+	s.consumer.config.EnableAutoCommit = true
+	s.consumer.consumers = []consumer{kafkaconsumer}
+	for offset := 0; offset < 6; offset++ {
+		msg := &kafka.Message{TopicPartition: offsetPartitions("kafqa", kafka.Offset(offset), 0)[0]}
+		kafkaconsumer.On("Poll", mock.AnythingOfType("int")).Return(msg).Once()
+	}
+	kafkaconsumer.On("Poll", mock.AnythingOfType("int")).Return(nil)
+	kafkaconsumer.On("Close").Return(nil)
+	batches := make(chan []*kafka.Message, 10)
+	s.consumer.wg.Add(1)
+	go func() {
+		for batch := range s.consumer.consumerWorker(context.Background(), kafkaconsumer, 0) {
+			batches <- batch
+		}
+	}()
+
+	first, second := <-batches, <-batches
+	s.consumer.exit <- struct{}{}
+	s.consumer.wg.Wait()
+
+	assert.Len(t, first, 3)
+	assert.Len(t, second, 3)
+	assert.Equal(t, kafka.Offset(5), second[2].TopicPartition.Offset)
+	kafkaconsumer.AssertNotCalled(t, "ReadMessage", mock.Anything)
+}
+
+func (s *ConsumerSuite) TestShouldNotSendEmptyBatchOnPollTimeout() {
+	kafkaconsumer := new(consumerMock)
+	s.consumer.config.BatchSize = 10
+	kafkaconsumer.On("Poll", mock.AnythingOfType("int")).Return(nil).Once()
+	batches := make(chan []*kafka.Message, 1)
+
+	start := time.Now()
+	s.consumer.readBatch(kafkaconsumer, batches, 0)
+
+	assert.Empty(s.T(), batches)
+	assert.True(s.T(), time.Since(start) < time.Second)
+	kafkaconsumer.AssertExpectations(s.T())
+}
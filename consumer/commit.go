@@ -0,0 +1,240 @@
+package consumer
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/gojek/kafqa/config"
+	"github.com/gojek/kafqa/logger"
+	"github.com/gojek/kafqa/reporter/metrics"
+	"gopkg.in/confluentinc/confluent-kafka-go.v1/kafka"
+)
+
+const (
+	commitSync     = "sync"
+	commitAsync    = "async"
+	commitPeriodic = "periodic"
+	commitStore    = "store"
+)
+
+type offsetCommitter interface {
+	CommitOffsets([]kafka.TopicPartition) ([]kafka.TopicPartition, error)
+	StoreOffsets([]kafka.TopicPartition) ([]kafka.TopicPartition, error)
+}
+
+// partitionOffsets are the offsets of a partition in the order consumed, an offset is
+// committable once the callbacks of all the messages before it completed
+type partitionOffsets struct {
+	tp      kafka.TopicPartition
+	pending []kafka.Offset
+	done    map[kafka.Offset]bool
+}
+
+// complete marks the offset processed and returns the next offset to commit, if it advanced
+func (p *partitionOffsets) complete(offset kafka.Offset) (kafka.Offset, bool) {
+	p.done[offset] = true
+	var next kafka.Offset
+	advanced := false
+	for len(p.pending) > 0 && p.done[p.pending[0]] {
+		delete(p.done, p.pending[0])
+		next, advanced = p.pending[0]+1, true
+		p.pending = p.pending[1:]
+	}
+	return next, advanced
+}
+
+// committer commits the offsets of the messages once their callbacks completed, so a restarted
+// consumer resumes from messages which weren't processed
+type committer struct {
+	sync.Mutex
+	// commits are serialised so an older offset never overwrites a newer one
+	commitMu sync.Mutex
+	// nil while the consumer instance is replaced after a crash
+	cons       offsetCommitter
+	strategy   string
+	every      int
+	partitions map[partition]*partitionOffsets
+	// committable offsets not yet committed
+	ready       map[partition]kafka.TopicPartition
+	uncommitted int
+
+	async chan struct{}
+	exit  chan struct{}
+	wg    sync.WaitGroup
+}
+
+// track records the consumed offsets before the messages are handed to the callbacks
+func (c *committer) track(batch []*kafka.Message) {
+	c.Lock()
+	defer c.Unlock()
+	for _, msg := range batch {
+		key := partitionKey(msg.TopicPartition)
+		p, ok := c.partitions[key]
+		if !ok {
+			tp := kafka.TopicPartition{Topic: msg.TopicPartition.Topic, Partition: msg.TopicPartition.Partition}
+			p = &partitionOffsets{tp: tp, done: make(map[kafka.Offset]bool)}
+			c.partitions[key] = p
+		}
+		p.pending = append(p.pending, msg.TopicPartition.Offset)
+	}
+}
+
+// done is called once the callbacks of the messages completed, failed messages aren't passed
+// so the offsets of their partitions aren't committed past them
+func (c *committer) done(batch []*kafka.Message) {
+	c.Lock()
+	for _, msg := range batch {
+		key := partitionKey(msg.TopicPartition)
+		p, ok := c.partitions[key]
+		if !ok {
+			continue
+		}
+		if next, ok := p.complete(msg.TopicPartition.Offset); ok {
+			tp := p.tp
+			tp.Offset = next
+			c.ready[key] = tp
+		}
+	}
+	c.uncommitted += len(batch)
+	c.Unlock()
+
+	switch c.strategy {
+	case commitSync, commitStore:
+		c.commit()
+	case commitAsync:
+		select {
+		case c.async <- struct{}{}:
+		default:
+			// a commit is already due, it picks up these offsets as well
+		}
+	case commitPeriodic:
+		if c.every > 0 && c.uncommittedCount() >= c.every {
+			c.commit()
+		}
+	}
+}
+
+func (c *committer) uncommittedCount() int {
+	c.Lock()
+	defer c.Unlock()
+	return c.uncommitted
+}
+
+// commit commits the offsets ready since the last commit, or stores them to be committed by auto commit
+func (c *committer) commit() {
+	c.commitMu.Lock()
+	defer c.commitMu.Unlock()
+	c.Lock()
+	offsets := make([]kafka.TopicPartition, 0, len(c.ready))
+	for _, tp := range c.ready {
+		offsets = append(offsets, tp)
+	}
+	c.ready = make(map[partition]kafka.TopicPartition)
+	c.uncommitted = 0
+	c.Unlock()
+	if len(offsets) == 0 || c.cons == nil {
+		return
+	}
+
+	start := time.Now()
+	var err error
+	if c.strategy == commitStore {
+		_, err = c.cons.StoreOffsets(offsets)
+	} else {
+		_, err = c.cons.CommitOffsets(offsets)
+	}
+	metrics.CommitLatency(c.strategy, time.Since(start))
+	if err != nil {
+		metrics.CommitFailure(c.strategy)
+		logger.Errorf("error committing offsets %v with %s strategy: %v", offsets, c.strategy, err)
+	}
+}
+
+// detach stops committing through a consumer instance before it's closed, the offsets not committed
+// are dropped as its partitions are reassigned and consumed again from the last commit
+func (c *committer) detach() {
+	c.commitMu.Lock()
+	defer c.commitMu.Unlock()
+	c.cons = nil
+	c.Lock()
+	defer c.Unlock()
+	c.partitions = make(map[partition]*partitionOffsets)
+	c.ready = make(map[partition]kafka.TopicPartition)
+	c.uncommitted = 0
+}
+
+// revoke drops the offsets of the revoked partitions once a commit in flight completed, committing them
+// later could move the offset of their new owner back
+func (c *committer) revoke(partitions []kafka.TopicPartition) {
+	c.commitMu.Lock()
+	defer c.commitMu.Unlock()
+	c.Lock()
+	defer c.Unlock()
+	for _, tp := range partitions {
+		key := partitionKey(tp)
+		delete(c.partitions, key)
+		delete(c.ready, key)
+	}
+}
+
+// replace commits through the consumer instance replacing a crashed one
+func (c *committer) replace(cons offsetCommitter) {
+	c.commitMu.Lock()
+	defer c.commitMu.Unlock()
+	c.cons = cons
+}
+
+func (c *committer) run(interval time.Duration) {
+	defer c.wg.Done()
+	var tick <-chan time.Time
+	if c.strategy == commitPeriodic && interval > 0 {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		tick = ticker.C
+	}
+	for {
+		select {
+		case <-c.async:
+			c.commit()
+		case <-tick:
+			c.commit()
+		case <-c.exit:
+			return
+		}
+	}
+}
+
+// close commits the offsets processed after the last commit
+func (c *committer) close() {
+	close(c.exit)
+	c.wg.Wait()
+	c.commit()
+}
+
+func validateCommitStrategy(strategy string) error {
+	switch strategy {
+	case commitSync, commitAsync, commitPeriodic, commitStore:
+		return nil
+	}
+	return fmt.Errorf("invalid commit strategy %s, expected one of sync, async, periodic or store", strategy)
+}
+
+func newCommitter(cons offsetCommitter, cfg config.Consumer) *committer {
+	strategy := cfg.CommitStrategy
+	if strategy == "" {
+		strategy = commitSync
+	}
+	c := &committer{
+		cons:       cons,
+		strategy:   strategy,
+		every:      cfg.CommitEveryMessages,
+		partitions: make(map[partition]*partitionOffsets),
+		ready:      make(map[partition]kafka.TopicPartition),
+		async:      make(chan struct{}, 1),
+		exit:       make(chan struct{}),
+	}
+	c.wg.Add(1)
+	go c.run(cfg.CommitInterval())
+	return c
+}
@@ -0,0 +1,133 @@
+package consumer
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/gojek/kafqa/config"
+	"github.com/gojek/kafqa/logger"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"gopkg.in/confluentinc/confluent-kafka-go.v1/kafka"
+)
+
+func offsetMessages(topic string, partition int32, offsets ...kafka.Offset) []*kafka.Message {
+	var msgs []*kafka.Message
+	for _, o := range offsets {
+		msgs = append(msgs, &kafka.Message{TopicPartition: offsetPartitions(topic, o, partition)[0]})
+	}
+	return msgs
+}
+
+func TestShouldCommitOnlyOffsetsWithAllPriorMessagesProcessed(t *testing.T) {
+	logger.Setup("")
+	cons := new(consumerMock)
+	cons.On("CommitOffsets", offsetPartitions("kafqa", 13, 0)).Return(nil, nil).Once()
+	cons.On("CommitOffsets", offsetPartitions("kafqa", 14, 0)).Return(nil, nil).Once()
+	cm := newCommitter(cons, config.Consumer{CommitStrategy: "sync"})
+	msgs := offsetMessages("kafqa", 0, 10, 11, 12, 13)
+	cm.track(msgs)
+
+	// callbacks of later messages complete first
+	cm.done(msgs[2:3])
+	cm.done(msgs[0:2])
+	cm.done(msgs[3:4])
+	cm.close()
+
+	cons.AssertExpectations(t)
+	cons.AssertNumberOfCalls(t, "CommitOffsets", 2)
+}
+
+func TestShouldCommitPeriodicallyByCount(t *testing.T) {
+	cons := new(consumerMock)
+	cons.On("CommitOffsets", offsetPartitions("kafqa", 3, 1)).Return(nil, nil).Once()
+	cons.On("CommitOffsets", offsetPartitions("kafqa", 4, 1)).Return(nil, nil).Once()
+	cm := newCommitter(cons, config.Consumer{CommitStrategy: "periodic", CommitEveryMessages: 3, CommitIntervalMs: 60000})
+	msgs := offsetMessages("kafqa", 1, 0, 1, 2, 3)
+	cm.track(msgs)
+
+	for _, msg := range msgs {
+		cm.done([]*kafka.Message{msg})
+	}
+	cons.AssertNumberOfCalls(t, "CommitOffsets", 1)
+	cm.close()
+
+	cons.AssertExpectations(t)
+}
+
+func TestShouldCommitPeriodicallyByInterval(t *testing.T) {
+	cons := new(consumerMock)
+	committed := make(chan struct{}, 1)
+	cons.On("CommitOffsets", offsetPartitions("kafqa", 1, 0)).Run(func(mock.Arguments) { committed <- struct{}{} }).Return(nil, nil)
+	cm := newCommitter(cons, config.Consumer{CommitStrategy: "periodic", CommitIntervalMs: 10})
+	msgs := offsetMessages("kafqa", 0, 0)
+	cm.track(msgs)
+
+	cm.done(msgs)
+
+	select {
+	case <-committed:
+	case <-time.After(time.Second):
+		t.Fatal("offsets weren't committed on the interval")
+	}
+	cm.close()
+}
+
+func TestShouldCommitAsynchronously(t *testing.T) {
+	cons := new(consumerMock)
+	committed := make(chan []kafka.TopicPartition, 10)
+	cons.On("CommitOffsets", mock.Anything).Run(func(args mock.Arguments) {
+		committed <- args.Get(0).([]kafka.TopicPartition)
+	}).Return(nil, nil)
+	cm := newCommitter(cons, config.Consumer{CommitStrategy: "async"})
+	msgs := offsetMessages("kafqa", 0, 5, 6)
+	cm.track(msgs)
+
+	cm.done(msgs)
+
+	select {
+	case offsets := <-committed:
+		assert.Equal(t, offsetPartitions("kafqa", 7, 0), offsets)
+	case <-time.After(time.Second):
+		t.Fatal("offsets weren't committed in the background")
+	}
+	cm.close()
+}
+
+func TestShouldStoreOffsetsWithStoreStrategy(t *testing.T) {
+	logger.Setup("")
+	cons := new(consumerMock)
+	cons.On("StoreOffsets", offsetPartitions("kafqa", 3, 2)).Return(nil, errors.New("unknown partition")).Once()
+	cm := newCommitter(cons, config.Consumer{CommitStrategy: "store"})
+	msgs := offsetMessages("kafqa", 2, 2)
+	cm.track(msgs)
+
+	cm.done(msgs)
+	cm.close()
+
+	cons.AssertExpectations(t)
+	cons.AssertNotCalled(t, "CommitOffsets", mock.Anything)
+}
+
+func TestShouldNotCommitOffsetsOfRevokedPartitions(t *testing.T) {
+	cons := new(consumerMock)
+	cons.On("CommitOffsets", offsetPartitions("kafqa", 2, 1)).Return(nil, nil).Once()
+	cm := newCommitter(cons, config.Consumer{CommitStrategy: "periodic", CommitIntervalMs: 60000})
+	revoked, kept := offsetMessages("kafqa", 0, 5), offsetMessages("kafqa", 1, 1)
+	cm.track(revoked)
+	cm.track(kept)
+	cm.done(revoked)
+
+	cm.revoke(topicPartitions("kafqa", 0))
+	cm.done(kept)
+	cm.close()
+
+	cons.AssertExpectations(t)
+	cons.AssertNumberOfCalls(t, "CommitOffsets", 1)
+}
+
+func TestShouldValidateCommitStrategy(t *testing.T) {
+	assert.NoError(t, validateCommitStrategy("periodic"))
+	assert.Error(t, validateCommitStrategy("manual"))
+}
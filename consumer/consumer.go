@@ -4,6 +4,7 @@ import (
 	"context"
 	"fmt"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/gojek/kafqa/reporter/metrics"
@@ -22,18 +23,56 @@ type Consumer struct {
 	wg        *sync.WaitGroup
 	callbacks []callback.Callback
 	exit      chan struct{}
-	cbwg      *sync.WaitGroup
+	executor  *executor
+	// commit the offsets of processed messages when auto commit is disabled
+	committers []*committer
+	faults     processingFaults
+	// creates a consumer replacing a crashed one, nil when crashes can't be injected
+	recreate func(id int) (consumer, error)
+	// rebalances of each consumer in the group, none with assigned partitions
+	trackers    []*rebalanceTracker
+	consumersMu sync.Mutex
+	// end offsets of the partitions read by each consumer, when bounded
+	ends    []partitionEnds
+	pending int32
+	// partitions assigned to each consumer, exported on Run once metrics are set up
+	assigned []int
+	done     chan struct{}
+	// creates the clients instead of librdkafka, eg: with the fake broker
+	clients func(config.Consumer) (Client, error)
 }
 
+// Client is the kafka consumer client, librdkafka unless replaced with Clients
+type Client = consumer
+
 type consumer interface {
 	SubscribeTopics([]string, kafka.RebalanceCb) error
 	ReadMessage(time.Duration) (*kafka.Message, error)
 	Close() error
-	CommitMessage(*kafka.Message) ([]kafka.TopicPartition, error)
+	Poll(int) kafka.Event
+	offsetCommitter
 }
 
 func (c *Consumer) Run(ctx context.Context) {
-	logger.Debugf("running consumer on brokers: %s, subscribed to: %s", c.config.KafkaBrokers, c.config.Topic)
+	logger.Debugf("running consumer on brokers: %s, subscribed to: %v", c.config.KafkaBrokers, c.config.Subscriptions())
+	process := runCallbacks(c.callbacks)
+	if c.faults.enabled() {
+		process = c.faults.wrap(c.callbacks)
+	}
+	c.executor = newExecutor(process, c.config.CallbackWorkers, c.config.CallbackQueueSize, c.config.OrderedCallbacks)
+	if !c.config.EnableAutoCommit {
+		c.committers = make([]*committer, 0, len(c.consumers))
+		for i, cons := range c.consumers {
+			c.committers = append(c.committers, newCommitter(cons, c.config))
+			// set before the workers poll, the rebalance callbacks are run by their polls
+			if i < len(c.trackers) {
+				c.trackers[i].onRevoke = c.committers[i].revoke
+			}
+		}
+	}
+	for i, count := range c.assigned {
+		metrics.AssignedPartitions(i, count)
+	}
 	for i, cons := range c.consumers {
 		c.wg.Add(2)
 		msgs := c.consumerWorker(ctx, cons, i) // goroutine producer
@@ -46,34 +85,44 @@ func (c *Consumer) Register(cb callback.Callback) {
 	c.callbacks = append(c.callbacks, cb)
 }
 
-func (c *Consumer) processor(messages <-chan *kafka.Message, id int) {
+func (c *Consumer) processor(messages <-chan []*kafka.Message, id int) {
 	defer c.wg.Done()
 	logger.Debugf("[processor-%d] processing messages...", id)
-	for msg := range messages {
-		start := time.Now()
-		c.cbwg.Add(len(c.callbacks))
-		for _, cb := range c.callbacks {
-			go func(cb callback.Callback, m *kafka.Message) {
-				cb(m)
-				c.cbwg.Done()
-			}(cb, msg)
+	for batch := range messages {
+		var done func([]*kafka.Message)
+		if id < len(c.committers) {
+			c.committers[id].track(batch)
+			done = c.committers[id].done
 		}
-		metrics.ConsumerMessageProcessingTime(time.Since(start))
+		c.executor.submit(batch, done)
 		metrics.ConsumerChannelLength(len(messages))
 	}
 	logger.Debugf("[processor-%d] completed.", id)
 }
 
-func (c *Consumer) consumerWorker(ctx context.Context, cons consumer, id int) <-chan *kafka.Message {
-	messages := make(chan *kafka.Message, 1000)
+func (c *Consumer) consumerWorker(ctx context.Context, cons consumer, id int) <-chan []*kafka.Message {
+	messages := make(chan []*kafka.Message, 1000)
 
-	go func(messages chan *kafka.Message) {
+	go func(messages chan []*kafka.Message) {
 		defer c.wg.Done()
 		defer func() { close(messages) }()
 
+		schedule := newFaultSchedule(c.config, time.Now())
 		for {
 			start := time.Now()
-			c.readMessage(cons, messages, id)
+			var ok bool
+			if cons, ok = c.injectFaults(ctx, cons, id, schedule); !ok {
+				return
+			}
+			if c.config.BatchEnabled {
+				c.readBatch(cons, messages, id)
+			} else {
+				c.readMessage(cons, messages, id)
+			}
+			if c.completed(id) {
+				logger.Infof("[consumer-%d] reached the end offsets, closing....", id)
+				return
+			}
 			select {
 			case <-ctx.Done():
 				logger.Debugf("[consumer-%d] context done, closing %v....", id, ctx.Err())
@@ -81,8 +130,10 @@ func (c *Consumer) consumerWorker(ctx context.Context, cons consumer, id int) <-
 			case <-c.exit:
 				return
 			default:
-				// This is required to preempt goroutine
-				time.Sleep(c.config.MessageLoopDelay())
+				// This is required to preempt goroutine, batches block in poll instead
+				if !c.config.BatchEnabled {
+					time.Sleep(c.config.MessageLoopDelay())
+				}
 			}
 			metrics.ConsumerMessageReadTime(time.Since(start))
 		}
@@ -91,7 +142,7 @@ func (c *Consumer) consumerWorker(ctx context.Context, cons consumer, id int) <-
 	return messages
 }
 
-func (c *Consumer) readMessage(cons consumer, messages chan<- *kafka.Message, id int) {
+func (c *Consumer) readMessage(cons consumer, messages chan<- []*kafka.Message, id int) {
 	timeout := c.config.PollTimeout()
 	logger.Debugf("[consumer-%d] polling kafka for messages... with timeout %v", id, timeout)
 	msg, err := cons.ReadMessage(timeout)
@@ -101,26 +152,62 @@ func (c *Consumer) readMessage(cons consumer, messages chan<- *kafka.Message, id
 			logger.Errorf("error consuming messages: %+v timeout: %v", err, timeout)
 		}
 	} else {
-		span := tracer.StartSpanFromMessage("kafqa.consumer", msg)
-		messages <- msg
-		if !c.config.EnableAutoCommit && msg != nil {
-			tps, err := cons.CommitMessage(msg)
-			if err != nil {
-				logger.Errorf("Error committing message: %v, TopicParitions: %v err: %v", msg, tps, err)
-			}
+		if msg == nil || !c.accept(id, msg) {
+			return
 		}
+		span := tracer.StartSpanFromMessage("kafqa.consumer", msg)
+		messages <- []*kafka.Message{msg}
 		span.Finish()
 	}
 
 }
 
+// accept drops the messages beyond the end offsets of a bounded consumer
+func (c *Consumer) accept(id int, msg *kafka.Message) bool {
+	ends := c.partitionEnds(id)
+	return ends == nil || ends.consume(msg.TopicPartition)
+}
+
+func (c *Consumer) partitionEnds(id int) partitionEnds {
+	if id >= len(c.ends) {
+		return nil
+	}
+	return c.ends[id]
+}
+
+// completed marks the consumer done once it has read all its partitions until their end offsets
+func (c *Consumer) completed(id int) bool {
+	ends := c.partitionEnds(id)
+	if ends == nil || !ends.done() {
+		return false
+	}
+	if atomic.AddInt32(&c.pending, -1) == 0 {
+		close(c.done)
+	}
+	return true
+}
+
+// Done is closed when all the consumers reached the end offsets, it blocks forever unless bounded
+func (c *Consumer) Done() <-chan struct{} {
+	return c.done
+}
+
 func (c *Consumer) Close() {
 	logger.Infof("closing consumer...")
 	c.exit <- struct{}{}
 	c.wg.Wait()
-	c.cbwg.Wait()
+	c.consumersMu.Lock()
+	defer c.consumersMu.Unlock()
+	if c.executor != nil {
+		c.executor.close()
+	}
+	for _, cm := range c.committers {
+		cm.close()
+	}
 	for _, cons := range c.consumers {
-		cons.Close()
+		if cons != nil {
+			cons.Close()
+		}
 	}
 }
 
@@ -138,27 +225,142 @@ func Register(cb callback.Callback) Option {
 	}
 }
 
+// Clients replaces the librdkafka consumers of the group, partitions can't be assigned with them
+func Clients(create func(config.Consumer) (Client, error)) Option {
+	return func(c *Consumer) {
+		c.clients = create
+	}
+}
+
 func New(cfg config.Consumer, opts ...Option) (*Consumer, error) {
-	var consumers []consumer
+	if cfg.Concurrency < 1 {
+		return nil, fmt.Errorf("invalid consumer concurrency %d, expected at least 1", cfg.Concurrency)
+	}
+	if err := validateCommitStrategy(cfg.CommitStrategy); err != nil {
+		return nil, err
+	}
+	faults, err := newProcessingFaults(cfg)
+	if err != nil {
+		return nil, err
+	}
+	cons := newConsumer(cfg, nil, nil, opts...)
+	if cfg.AssignEnabled {
+		if cfg.FaultCrashIntervalMs > 0 {
+			return nil, fmt.Errorf("crashes can't be injected with assigned partitions")
+		}
+		if cons.clients != nil {
+			return nil, fmt.Errorf("partitions can't be assigned with replaced clients")
+		}
+		cons, err := newAssigned(cfg, opts...)
+		if err != nil {
+			return nil, err
+		}
+		cons.faults = faults
+		return cons, nil
+	}
 	for i := 0; i < cfg.Concurrency; i++ {
+		tracker := newRebalanceTracker(i, time.Now())
+		client, err := subscribe(cfg, tracker, cons.clients)
+		if err != nil {
+			return nil, err
+		}
+		cons.consumers = append(cons.consumers, client)
+		cons.trackers = append(cons.trackers, tracker)
+	}
+	cons.faults = faults
+	// the replacement rejoins the group as the same worker
+	cons.recreate = func(id int) (consumer, error) { return subscribe(cfg, cons.trackers[id], cons.clients) }
+	return cons, nil
+}
+
+func subscribe(cfg config.Consumer, tracker *rebalanceTracker, clients func(config.Consumer) (Client, error)) (consumer, error) {
+	var cons consumer
+	var err error
+	if clients != nil {
+		cons, err = clients(cfg)
+	} else {
+		cons, err = kafka.NewConsumer(cfg.KafkaConfig())
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error creating consumer: %v", err)
+	}
+	err = cons.SubscribeTopics(cfg.Subscriptions(), tracker.callback)
+	if err != nil {
+		cons.Close()
+		return nil, fmt.Errorf("error subscribing to topic: %v", err)
+	}
+	return cons, nil
+}
+
+// newAssigned creates consumers reading the assigned partitions split across them, outside the consumer group
+func newAssigned(cfg config.Consumer, opts ...Option) (*Consumer, error) {
+	resolver, err := kafka.NewConsumer(cfg.KafkaConfig())
+	if err != nil {
+		return nil, fmt.Errorf("error creating consumer: %v", err)
+	}
+	defer resolver.Close()
+	tps, err := assignment(cfg, resolver)
+	if err != nil {
+		return nil, err
+	}
+	var ends map[partition]int64
+	if cfg.Bounded() {
+		if ends, err = endOffsets(cfg, resolver, tps); err != nil {
+			return nil, err
+		}
+		var bounded []kafka.TopicPartition
+		for _, tp := range tps {
+			if _, ok := ends[partitionKey(tp)]; ok {
+				bounded = append(bounded, tp)
+			}
+		}
+		tps = bounded
+	}
+	if len(tps) == 0 {
+		return nil, fmt.Errorf("no partitions to assign of %v", cfg.Subscriptions())
+	}
+
+	var consumers []consumer
+	var workerEnds []partitionEnds
+	var assigned []int
+	for i, group := range split(tps, cfg.Concurrency) {
 		cons, err := kafka.NewConsumer(cfg.KafkaConfig())
 		if err != nil {
 			return nil, fmt.Errorf("error creating consumer: %v", err)
 		}
-		err = cons.SubscribeTopics([]string{cfg.Topic}, nil)
-		if err != nil {
-			return nil, fmt.Errorf("error subscribing to topic: %v", err)
+		if err := cons.Assign(group); err != nil {
+			cons.Close()
+			return nil, fmt.Errorf("error assigning partitions %v: %v", group, err)
 		}
+		logger.Infof("[consumer-%d] assigned partitions: %v", i, group)
+		assigned = append(assigned, len(group))
 		consumers = append(consumers, cons)
+		if ends != nil {
+			pe := make(partitionEnds, len(group))
+			for _, tp := range group {
+				pe[partitionKey(tp)] = ends[partitionKey(tp)]
+			}
+			workerEnds = append(workerEnds, pe)
+		}
 	}
+	cons := newConsumer(cfg, consumers, workerEnds, opts...)
+	cons.assigned = assigned
+	return cons, nil
+}
+
+func newConsumer(cfg config.Consumer, consumers []consumer, ends []partitionEnds, opts ...Option) *Consumer {
 	cons := &Consumer{
 		consumers: consumers,
 		config:    cfg,
 		exit:      make(chan struct{}, 1),
-		cbwg:      &sync.WaitGroup{},
+		ends:      ends,
+		pending:   int32(len(ends)),
+	}
+	if len(ends) > 0 {
+		cons.done = make(chan struct{})
 	}
 	for _, opt := range opts {
 		opt(cons)
 	}
-	return cons, nil
+	return cons
 }
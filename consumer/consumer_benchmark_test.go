@@ -44,7 +44,6 @@ func BenchmarkConsumer100MsgsProcessing(b *testing.B) {
 		cons := Consumer{
 			consumers: []consumer{kafkaConsumer, kafkaConsumer, kafkaConsumer},
 			config:    config,
-			cbwg:      &sync.WaitGroup{},
 			wg:        &sync.WaitGroup{},
 			exit:      stopConsumer,
 		}
@@ -27,7 +27,6 @@ func (s *ConsumerSuite) SetupTest() {
 	s.consumer = &Consumer{
 		config: config.Consumer{Concurrency: 1},
 		wg:     &sync.WaitGroup{},
-		cbwg:   &sync.WaitGroup{},
 		exit:   make(chan struct{}, 1),
 	}
 }
@@ -39,7 +38,7 @@ func (s *ConsumerSuite) TestIfCallbackCalled() {
 	s.consumer.consumers = []consumer{kafkaconsumer}
 	kafkaconsumer.On("Close").Return(nil)
 	kafkaconsumer.On("ReadMessage", time.Duration(0)).Return(msg, nil)
-	kafkaconsumer.On("CommitMessage", msg).Return(make([]kafka.TopicPartition, 1), nil)
+	kafkaconsumer.On("CommitOffsets", mock.Anything).Return(make([]kafka.TopicPartition, 1), nil)
 	ch := make(chan struct{}, 1)
 	var callbackCalled int32
 	call := func(msg *kafka.Message) {
@@ -67,7 +66,7 @@ func (s *ConsumerSuite) TestCallbackCalledForNMessages() {
 	kafkaconsumer.On("Close").Return(nil)
 	kafkaconsumer.On("ReadMessage", mock.AnythingOfType("time.Duration")).Return(msg, nil).Times(n)
 	kafkaconsumer.On("ReadMessage", mock.AnythingOfType("time.Duration")).Return(&kafka.Message{}, errors.New("failed"))
-	kafkaconsumer.On("CommitMessage", msg).Return(make([]kafka.TopicPartition, 1), nil)
+	kafkaconsumer.On("CommitOffsets", mock.Anything).Return(make([]kafka.TopicPartition, 1), nil)
 	var callbackCalled int32
 	callback := func(msg *kafka.Message) {
 		go func() {
@@ -109,7 +108,20 @@ func (c *consumerMock) Close() error {
 	return args.Error(0)
 }
 
-func (c *consumerMock) CommitMessage(msg *kafka.Message) ([]kafka.TopicPartition, error) {
-	args := c.Called(msg)
-	return args.Get(0).([]kafka.TopicPartition), args.Error(1)
+func (c *consumerMock) Poll(timeoutMs int) kafka.Event {
+	args := c.Called(timeoutMs)
+	ev, _ := args.Get(0).(kafka.Event)
+	return ev
+}
+
+func (c *consumerMock) StoreOffsets(offsets []kafka.TopicPartition) ([]kafka.TopicPartition, error) {
+	args := c.Called(offsets)
+	tps, _ := args.Get(0).([]kafka.TopicPartition)
+	return tps, args.Error(1)
+}
+
+func (c *consumerMock) CommitOffsets(offsets []kafka.TopicPartition) ([]kafka.TopicPartition, error) {
+	args := c.Called(offsets)
+	tps, _ := args.Get(0).([]kafka.TopicPartition)
+	return tps, args.Error(1)
 }
@@ -0,0 +1,125 @@
+package consumer
+
+import (
+	"hash/fnv"
+	"sync"
+	"time"
+
+	"github.com/gojek/kafqa/callback"
+	"github.com/gojek/kafqa/reporter/metrics"
+	"gopkg.in/confluentinc/confluent-kafka-go.v1/kafka"
+)
+
+// executor runs the callbacks of the consumed batches on a fixed number of workers,
+// submitting blocks once the queue is full so consumption slows down to the processing rate.
+// When ordered the messages of a partition are always processed by the same worker in the order consumed.
+type executor struct {
+	queues []chan job
+	// runs the callbacks of a message, false when its processing failed
+	process func(*kafka.Message) bool
+	wg      sync.WaitGroup
+}
+
+// runCallbacks processes a message with all the callbacks, it never fails
+func runCallbacks(callbacks []callback.Callback) func(*kafka.Message) bool {
+	return func(msg *kafka.Message) bool {
+		for _, cb := range callbacks {
+			cb(msg)
+		}
+		return true
+	}
+}
+
+// job is a batch of messages along with the function called with the ones processed once their callbacks completed
+type job struct {
+	batch []*kafka.Message
+	done  func([]*kafka.Message)
+}
+
+func (e *executor) submit(batch []*kafka.Message, done func([]*kafka.Message)) {
+	if len(e.queues) == 1 {
+		e.enqueue(e.queues[0], job{batch, done})
+		return
+	}
+	if len(batch) == 1 {
+		e.enqueue(e.queues[e.queueIndex(batch[0].TopicPartition)], job{batch, done})
+		return
+	}
+	split := make([][]*kafka.Message, len(e.queues))
+	for _, msg := range batch {
+		i := e.queueIndex(msg.TopicPartition)
+		split[i] = append(split[i], msg)
+	}
+	for i, msgs := range split {
+		if len(msgs) > 0 {
+			e.enqueue(e.queues[i], job{msgs, done})
+		}
+	}
+}
+
+func (e *executor) enqueue(queue chan<- job, j job) {
+	queue <- j
+	metrics.CallbackQueueLength(len(queue))
+}
+
+func (e *executor) queueIndex(tp kafka.TopicPartition) int {
+	h := fnv.New32a()
+	if tp.Topic != nil {
+		h.Write([]byte(*tp.Topic))
+	}
+	h.Write([]byte{byte(tp.Partition >> 24), byte(tp.Partition >> 16), byte(tp.Partition >> 8), byte(tp.Partition)})
+	return int(h.Sum32() % uint32(len(e.queues)))
+}
+
+func (e *executor) work(queue <-chan job) {
+	defer e.wg.Done()
+	for j := range queue {
+		processed := j.batch[:0:0]
+		for _, msg := range j.batch {
+			start := time.Now()
+			if e.process(msg) {
+				processed = append(processed, msg)
+			}
+			metrics.ConsumerMessageProcessingTime(time.Since(start))
+		}
+		if j.done != nil {
+			j.done(processed)
+		}
+	}
+}
+
+// close waits for the queued messages to be processed
+func (e *executor) close() {
+	for _, queue := range e.queues {
+		close(queue)
+	}
+	e.wg.Wait()
+}
+
+func newExecutor(process func(*kafka.Message) bool, workers, queueSize int, ordered bool) *executor {
+	if workers < 1 {
+		workers = 1
+	}
+	if queueSize < 0 {
+		queueSize = 0
+	}
+	e := &executor{process: process}
+	if !ordered {
+		queue := make(chan job, queueSize)
+		e.queues = []chan job{queue}
+		e.wg.Add(workers)
+		for i := 0; i < workers; i++ {
+			go e.work(queue)
+		}
+		return e
+	}
+	// the queue size is shared by the per worker queues
+	size := queueSize / workers
+	e.wg.Add(workers)
+	for i := 0; i < workers; i++ {
+		queue := make(chan job, size)
+		e.queues = append(e.queues, queue)
+		go e.work(queue)
+	}
+	return e
+}
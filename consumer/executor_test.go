@@ -0,0 +1,112 @@
+package consumer
+
+import (
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gojek/kafqa/callback"
+	"github.com/stretchr/testify/assert"
+	"gopkg.in/confluentinc/confluent-kafka-go.v1/kafka"
+)
+
+func TestShouldRunAllCallbacksOfSubmittedMessages(t *testing.T) {
+	var calls int32
+	cb := func(*kafka.Message) { atomic.AddInt32(&calls, 1) }
+	e := newExecutor(runCallbacks([]callback.Callback{cb, cb}), 4, 10, false)
+
+	for i := 0; i < 50; i++ {
+		e.submit([]*kafka.Message{{}}, nil)
+	}
+	e.close()
+
+	assert.Equal(t, int32(100), atomic.LoadInt32(&calls))
+}
+
+func TestShouldNotMarkFailedMessagesDone(t *testing.T) {
+	failed := &kafka.Message{}
+	processed := make(chan []*kafka.Message, 1)
+	e := newExecutor(func(msg *kafka.Message) bool { return msg != failed }, 1, 1, false)
+	ok := &kafka.Message{}
+
+	e.submit([]*kafka.Message{ok, failed}, func(msgs []*kafka.Message) { processed <- msgs })
+	e.close()
+
+	assert.Equal(t, []*kafka.Message{ok}, <-processed)
+}
+
+func TestShouldPreservePartitionOrderWhenOrdered(t *testing.T) {
+	var mu sync.Mutex
+	offsets := make(map[int32][]kafka.Offset)
+	cb := func(msg *kafka.Message) {
+		// later messages finish first if they run concurrently
+		time.Sleep(time.Duration(10-msg.TopicPartition.Offset%10) * 100 * time.Microsecond)
+		mu.Lock()
+		defer mu.Unlock()
+		offsets[msg.TopicPartition.Partition] = append(offsets[msg.TopicPartition.Partition], msg.TopicPartition.Offset)
+	}
+	e := newExecutor(runCallbacks([]callback.Callback{cb}), 4, 40, true)
+
+	for offset := 0; offset < 20; offset++ {
+		for _, tp := range offsetPartitions("kafqa", kafka.Offset(offset), 0, 1, 2) {
+			e.submit([]*kafka.Message{{TopicPartition: tp}}, nil)
+		}
+	}
+	e.close()
+
+	for partition, got := range offsets {
+		assert.Len(t, got, 20)
+		for i, offset := range got {
+			assert.Equal(t, kafka.Offset(i), offset, "partition %d processed out of order", partition)
+		}
+	}
+}
+
+func TestShouldBlockSubmitWhenQueueIsFull(t *testing.T) {
+	release := make(chan struct{})
+	e := newExecutor(runCallbacks([]callback.Callback{func(*kafka.Message) { <-release }}), 1, 1, false)
+	// one message is processed and one queued
+	e.submit([]*kafka.Message{{}}, nil)
+	e.submit([]*kafka.Message{{}}, nil)
+
+	submitted := make(chan struct{})
+	go func() {
+		e.submit([]*kafka.Message{{}}, nil)
+		close(submitted)
+	}()
+
+	select {
+	case <-submitted:
+		t.Fatal("submit didn't block on a full queue")
+	case <-time.After(50 * time.Millisecond):
+	}
+	close(release)
+	<-submitted
+	e.close()
+}
+
+func TestShouldSplitSubmittedBatchesByPartitionWhenOrdered(t *testing.T) {
+	var mu sync.Mutex
+	offsets := make(map[int32][]kafka.Offset)
+	cb := func(msg *kafka.Message) {
+		mu.Lock()
+		defer mu.Unlock()
+		offsets[msg.TopicPartition.Partition] = append(offsets[msg.TopicPartition.Partition], msg.TopicPartition.Offset)
+	}
+	e := newExecutor(runCallbacks([]callback.Callback{cb}), 3, 10, true)
+
+	for offset := 0; offset < 10; offset += 2 {
+		var batch []*kafka.Message
+		for _, o := range []int{offset, offset + 1} {
+			for _, tp := range offsetPartitions("kafqa", kafka.Offset(o), 0, 1) {
+				batch = append(batch, &kafka.Message{TopicPartition: tp})
+			}
+		}
+		e.submit(batch, nil)
+	}
+	e.close()
+
+	expected := []kafka.Offset{0, 1, 2, 3, 4, 5, 6, 7, 8, 9}
+	assert.Equal(t, map[int32][]kafka.Offset{0: expected, 1: expected}, offsets)
+}
@@ -0,0 +1,186 @@
+package consumer
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"time"
+
+	"github.com/gojek/kafqa/callback"
+	"github.com/gojek/kafqa/config"
+	"github.com/gojek/kafqa/logger"
+	"github.com/gojek/kafqa/reporter/metrics"
+	"gopkg.in/confluentinc/confluent-kafka-go.v1/kafka"
+)
+
+const (
+	fixedDelay       = "fixed"
+	uniformDelay     = "uniform"
+	normalDelay      = "normal"
+	exponentialDelay = "exponential"
+
+	delayFault   = "delay"
+	failureFault = "failure"
+	pauseFault   = "pause"
+	crashFault   = "crash"
+
+	// delay between attempts to recreate a crashed consumer
+	recreateRetryDelay = time.Second
+)
+
+// processingFaults slows down and fails the processing of messages as a misbehaving client would
+type processingFaults struct {
+	delay        time.Duration
+	jitter       time.Duration
+	distribution string
+	failureRate  float64
+}
+
+func (f processingFaults) enabled() bool {
+	return f.delay > 0 || f.jitter > 0 || f.failureRate > 0
+}
+
+func (f processingFaults) nextDelay() time.Duration {
+	var d time.Duration
+	switch f.distribution {
+	case uniformDelay:
+		d = f.delay - f.jitter + time.Duration(rand.Int63n(int64(2*f.jitter)+1))
+	case normalDelay:
+		d = f.delay + time.Duration(rand.NormFloat64()*float64(f.jitter))
+	case exponentialDelay:
+		d = time.Duration(rand.ExpFloat64() * float64(f.delay))
+	default:
+		d = f.delay
+	}
+	if d < 0 {
+		return 0
+	}
+	return d
+}
+
+// wrap runs the callbacks after the injected delay, a failed message skips its callbacks
+// and isn't processed, so its offset isn't committed
+func (f processingFaults) wrap(callbacks []callback.Callback) func(*kafka.Message) bool {
+	run := runCallbacks(callbacks)
+	return func(msg *kafka.Message) bool {
+		if d := f.nextDelay(); d > 0 {
+			metrics.InjectedFault(delayFault)
+			time.Sleep(d)
+		}
+		if f.failureRate > 0 && rand.Float64() < f.failureRate {
+			metrics.InjectedFault(failureFault)
+			logger.Debugf("injected callback failure for message on %v", msg.TopicPartition)
+			return false
+		}
+		return run(msg)
+	}
+}
+
+func newProcessingFaults(cfg config.Consumer) (processingFaults, error) {
+	switch cfg.FaultDelayDistribution {
+	case "", fixedDelay, uniformDelay, normalDelay, exponentialDelay:
+	default:
+		return processingFaults{}, fmt.Errorf("invalid fault delay distribution %s, expected one of fixed, uniform, normal or exponential",
+			cfg.FaultDelayDistribution)
+	}
+	if cfg.FaultFailureRate < 0 || cfg.FaultFailureRate > 1 {
+		return processingFaults{}, fmt.Errorf("invalid fault failure rate %v, expected between 0 and 1", cfg.FaultFailureRate)
+	}
+	return processingFaults{
+		delay:        time.Duration(cfg.FaultDelayMs) * time.Millisecond,
+		jitter:       time.Duration(cfg.FaultDelayJitterMs) * time.Millisecond,
+		distribution: cfg.FaultDelayDistribution,
+		failureRate:  cfg.FaultFailureRate,
+	}, nil
+}
+
+// faultSchedule is when a consumer worker is next paused or crashed
+type faultSchedule struct {
+	pauseInterval time.Duration
+	crashInterval time.Duration
+	nextPause     time.Time
+	nextCrash     time.Time
+}
+
+func (s *faultSchedule) pauseDue(now time.Time) bool {
+	if s.pauseInterval <= 0 || now.Before(s.nextPause) {
+		return false
+	}
+	s.nextPause = now.Add(s.pauseInterval)
+	return true
+}
+
+func (s *faultSchedule) crashDue(now time.Time) bool {
+	if s.crashInterval <= 0 || now.Before(s.nextCrash) {
+		return false
+	}
+	s.nextCrash = now.Add(s.crashInterval)
+	return true
+}
+
+func newFaultSchedule(cfg config.Consumer, start time.Time) *faultSchedule {
+	return &faultSchedule{
+		pauseInterval: cfg.FaultPauseInterval(),
+		crashInterval: cfg.FaultCrashInterval(),
+		nextPause:     start.Add(cfg.FaultPauseInterval()),
+		nextCrash:     start.Add(cfg.FaultCrashInterval()),
+	}
+}
+
+// injectFaults pauses the consumer or replaces it with a new instance when due, returning the consumer to poll.
+// A crashed consumer is closed before its replacement subscribes, the client always leaves the group on close
+// so the crash is seen as a leave rather than a session timeout. It's false when the run ended before
+// the consumer could be recreated.
+func (c *Consumer) injectFaults(ctx context.Context, cons consumer, id int, schedule *faultSchedule) (consumer, bool) {
+	now := time.Now()
+	if schedule.pauseDue(now) {
+		logger.Infof("[consumer-%d] injected pause of %v", id, c.config.FaultPause())
+		metrics.InjectedFault(pauseFault)
+		select {
+		case <-time.After(c.config.FaultPause()):
+		case <-ctx.Done():
+		}
+	}
+	if c.recreate == nil || !schedule.crashDue(now) {
+		return cons, true
+	}
+	logger.Infof("[consumer-%d] injected crash, replacing consumer", id)
+	metrics.InjectedFault(crashFault)
+	c.detach(id)
+	if err := cons.Close(); err != nil {
+		logger.Errorf("[consumer-%d] error closing crashed consumer: %v", id, err)
+	}
+	for {
+		replacement, err := c.recreate(id)
+		if err == nil {
+			c.replace(id, replacement)
+			return replacement, true
+		}
+		logger.Errorf("[consumer-%d] error recreating consumer, retrying in %v: %v", id, recreateRetryDelay, err)
+		select {
+		case <-time.After(recreateRetryDelay):
+		case <-ctx.Done():
+			c.consumersMu.Lock()
+			c.consumers[id] = nil
+			c.consumersMu.Unlock()
+			return nil, false
+		}
+	}
+}
+
+// detach stops committing the offsets of a worker through its consumer instance, before it's closed
+func (c *Consumer) detach(id int) {
+	if id < len(c.committers) {
+		c.committers[id].detach()
+	}
+}
+
+// replace swaps the consumer instance of a worker, offsets are committed through the new instance
+func (c *Consumer) replace(id int, cons consumer) {
+	c.consumersMu.Lock()
+	c.consumers[id] = cons
+	c.consumersMu.Unlock()
+	if id < len(c.committers) {
+		c.committers[id].replace(cons)
+	}
+}
@@ -0,0 +1,156 @@
+package consumer
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gojek/kafqa/callback"
+	"github.com/gojek/kafqa/config"
+	"github.com/gojek/kafqa/logger"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gopkg.in/confluentinc/confluent-kafka-go.v1/kafka"
+)
+
+func TestShouldDrawDelaysFromDistribution(t *testing.T) {
+	cases := []struct {
+		distribution string
+		min, max     time.Duration
+	}{
+		{"fixed", 20 * time.Millisecond, 20 * time.Millisecond},
+		{"uniform", 15 * time.Millisecond, 25 * time.Millisecond},
+		{"normal", 0, time.Hour},
+		{"exponential", 0, time.Hour},
+	}
+	for _, c := range cases {
+		faults, err := newProcessingFaults(config.Consumer{FaultDelayMs: 20, FaultDelayJitterMs: 5, FaultDelayDistribution: c.distribution})
+		require.NoError(t, err)
+
+		for i := 0; i < 100; i++ {
+			d := faults.nextDelay()
+			assert.True(t, d >= c.min && d <= c.max, "%s delay %v out of [%v, %v]", c.distribution, d, c.min, c.max)
+		}
+	}
+}
+
+func TestShouldFailInvalidProcessingFaults(t *testing.T) {
+	_, err := newProcessingFaults(config.Consumer{FaultDelayDistribution: "pareto"})
+	assert.Error(t, err)
+
+	_, err = newProcessingFaults(config.Consumer{FaultDelayDistribution: "fixed", FaultFailureRate: 1.5})
+	assert.Error(t, err)
+}
+
+func TestShouldSkipCallbacksOfFailedMessages(t *testing.T) {
+	logger.Setup("")
+	var called int
+	cbs := []callback.Callback{func(*kafka.Message) { called++ }}
+
+	assert.False(t, processingFaults{failureRate: 1}.wrap(cbs)(&kafka.Message{}))
+	assert.True(t, processingFaults{delay: time.Millisecond}.wrap(cbs)(&kafka.Message{}))
+
+	assert.Equal(t, 1, called)
+}
+
+func TestShouldScheduleFaultsEveryInterval(t *testing.T) {
+	start := time.Now()
+	schedule := newFaultSchedule(config.Consumer{FaultPauseIntervalMs: 1000}, start)
+
+	assert.False(t, schedule.pauseDue(start))
+	assert.True(t, schedule.pauseDue(start.Add(time.Second)))
+	assert.False(t, schedule.pauseDue(start.Add(1500*time.Millisecond)))
+	assert.True(t, schedule.pauseDue(start.Add(2*time.Second)))
+	assert.False(t, schedule.crashDue(start.Add(time.Hour)))
+}
+
+func (s *ConsumerSuite) TestShouldReplaceCrashedConsumer() {
+	t := s.T()
+	crashed, replacement := new(consumerMock), new(consumerMock)
+	crashed.On("Close").Return(nil).Once()
+	s.consumer.consumers = []consumer{crashed}
+	s.consumer.config.FaultCrashIntervalMs = 1
+	s.consumer.recreate = func(id int) (consumer, error) {
+		crashed.AssertCalled(t, "Close")
+		return replacement, nil
+	}
+	schedule := newFaultSchedule(s.consumer.config, time.Now().Add(-time.Second))
+
+	cons, ok := s.consumer.injectFaults(context.Background(), crashed, 0, schedule)
+
+	assert.True(t, ok)
+	assert.Equal(t, replacement, cons)
+	assert.Equal(t, []consumer{replacement}, s.consumer.consumers)
+	crashed.AssertExpectations(t)
+}
+
+func (s *ConsumerSuite) TestShouldRetryRecreatingCrashedConsumerUntilRunEnds() {
+	t := s.T()
+	crashed := new(consumerMock)
+	crashed.On("Close").Return(nil).Once()
+	s.consumer.consumers = []consumer{crashed}
+	s.consumer.config.FaultCrashIntervalMs = 1
+	s.consumer.recreate = func(id int) (consumer, error) { return nil, errors.New("broker down") }
+	schedule := newFaultSchedule(s.consumer.config, time.Now().Add(-time.Second))
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+
+	cons, ok := s.consumer.injectFaults(ctx, crashed, 0, schedule)
+
+	assert.False(t, ok)
+	assert.Nil(t, cons)
+	assert.Equal(t, []consumer{nil}, s.consumer.consumers)
+	crashed.AssertExpectations(t)
+}
+
+func (s *ConsumerSuite) TestShouldNotCommitThroughCrashedConsumerWhileRecreating() {
+	t := s.T()
+	crashed := new(consumerMock)
+	crashed.On("Close").Return(nil).Once()
+	s.consumer.consumers = []consumer{crashed}
+	cm := newCommitter(crashed, config.Consumer{CommitStrategy: commitSync})
+	s.consumer.committers = []*committer{cm}
+	s.consumer.config.FaultCrashIntervalMs = 1
+	schedule := newFaultSchedule(s.consumer.config, time.Now().Add(-time.Second))
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	topic := "kafqa"
+	done := make(chan struct{})
+	var once sync.Once
+	// workers keep finishing messages while the consumer is recreated
+	commits := func() {
+		defer close(done)
+		for offset := kafka.Offset(0); ctx.Err() == nil; offset++ {
+			batch := []*kafka.Message{{TopicPartition: kafka.TopicPartition{Topic: &topic, Offset: offset}}}
+			cm.track(batch)
+			cm.done(batch)
+			time.Sleep(time.Millisecond)
+		}
+	}
+	s.consumer.recreate = func(id int) (consumer, error) {
+		once.Do(func() { go commits() })
+		return nil, errors.New("broker down")
+	}
+
+	_, ok := s.consumer.injectFaults(ctx, crashed, 0, schedule)
+	<-done
+	cm.close()
+
+	assert.False(t, ok)
+	crashed.AssertExpectations(t)
+}
+
+func (s *ConsumerSuite) TestShouldPauseConsumerUntilContextDone() {
+	s.consumer.config.FaultPauseIntervalMs = 1
+	s.consumer.config.FaultPauseMs = 60000
+	schedule := newFaultSchedule(s.consumer.config, time.Now().Add(-time.Second))
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	s.consumer.injectFaults(ctx, new(consumerMock), 0, schedule)
+
+	assert.True(s.T(), time.Since(start) < time.Second)
+}
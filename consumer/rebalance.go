@@ -0,0 +1,103 @@
+package consumer
+
+import (
+	"sync"
+	"time"
+
+	"github.com/gojek/kafqa/logger"
+	"github.com/gojek/kafqa/reporter"
+	"github.com/gojek/kafqa/reporter/metrics"
+	"gopkg.in/confluentinc/confluent-kafka-go.v1/kafka"
+)
+
+const (
+	assignEvent = "assign"
+	revokeEvent = "revoke"
+)
+
+// rebalanceTracker follows the partitions assigned to a consumer, the window between
+// a revocation (or the subscription) and the next assignment is reported as a rebalance.
+// The assignment itself is left to the client which applies it once the callback returns.
+type rebalanceTracker struct {
+	sync.Mutex
+	id       int
+	assigned map[partition]struct{}
+	// start of the rebalance in progress, zero when the consumer holds an assignment
+	since   time.Time
+	revoked int
+	// drops the state kept for the revoked partitions, eg: their offsets not committed yet
+	onRevoke func([]kafka.TopicPartition)
+}
+
+func (r *rebalanceTracker) callback(_ *kafka.Consumer, ev kafka.Event) error {
+	switch e := ev.(type) {
+	case kafka.AssignedPartitions:
+		r.assign(e.Partitions, time.Now())
+	case kafka.RevokedPartitions:
+		r.revoke(e.Partitions, time.Now())
+		if r.onRevoke != nil {
+			r.onRevoke(e.Partitions)
+		}
+	}
+	return nil
+}
+
+func (r *rebalanceTracker) assign(partitions []kafka.TopicPartition, at time.Time) {
+	r.Lock()
+	defer r.Unlock()
+
+	logger.Infof("[consumer-%d] assigned partitions: %v", r.id, partitions)
+	metrics.Rebalance(assignEvent)
+	for _, tp := range partitions {
+		r.assigned[partitionKey(tp)] = struct{}{}
+	}
+	metrics.AssignedPartitions(r.id, len(r.assigned))
+	if r.since.IsZero() {
+		return
+	}
+	window := reporter.RebalanceWindow{Consumer: r.id, Start: r.since, End: at, Revoked: r.revoked, Assigned: len(partitions)}
+	metrics.RebalanceDuration(window.Duration())
+	reporter.Rebalance(window)
+	logger.Infof("[consumer-%d] rebalance completed in %v", r.id, window.Duration())
+	r.since, r.revoked = time.Time{}, 0
+}
+
+func (r *rebalanceTracker) revoke(partitions []kafka.TopicPartition, at time.Time) {
+	r.Lock()
+	defer r.Unlock()
+
+	logger.Infof("[consumer-%d] revoked partitions: %v", r.id, partitions)
+	metrics.Rebalance(revokeEvent)
+	for _, tp := range partitions {
+		delete(r.assigned, partitionKey(tp))
+	}
+	metrics.AssignedPartitions(r.id, len(r.assigned))
+	if r.since.IsZero() {
+		r.since = at
+	}
+	r.revoked += len(partitions)
+}
+
+func (r *rebalanceTracker) partitions() int {
+	r.Lock()
+	defer r.Unlock()
+	return len(r.assigned)
+}
+
+type partition struct {
+	topic string
+	id    int32
+}
+
+// partitionKey drops the topic pointer, offset and error so the same partition compares equal across events
+func partitionKey(tp kafka.TopicPartition) partition {
+	var topic string
+	if tp.Topic != nil {
+		topic = *tp.Topic
+	}
+	return partition{topic: topic, id: tp.Partition}
+}
+
+func newRebalanceTracker(id int, subscribed time.Time) *rebalanceTracker {
+	return &rebalanceTracker{id: id, assigned: make(map[partition]struct{}), since: subscribed}
+}
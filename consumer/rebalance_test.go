@@ -0,0 +1,70 @@
+package consumer
+
+import (
+	"testing"
+	"time"
+
+	"github.com/gojek/kafqa/logger"
+	"github.com/stretchr/testify/assert"
+	"gopkg.in/confluentinc/confluent-kafka-go.v1/kafka"
+)
+
+func topicPartitions(topic string, ids ...int32) []kafka.TopicPartition {
+	var tps []kafka.TopicPartition
+	for _, id := range ids {
+		t := topic
+		tps = append(tps, kafka.TopicPartition{Topic: &t, Partition: id})
+	}
+	return tps
+}
+
+func TestShouldTrackAssignedPartitionsAcrossRebalances(t *testing.T) {
+	logger.Setup("")
+	tracker := newRebalanceTracker(1, time.Now())
+
+	assert.NoError(t, tracker.callback(nil, kafka.AssignedPartitions{Partitions: topicPartitions("kafqa", 0, 1, 2)}))
+	assert.Equal(t, 3, tracker.partitions())
+
+	assert.NoError(t, tracker.callback(nil, kafka.RevokedPartitions{Partitions: topicPartitions("kafqa", 0, 1, 2)}))
+	assert.Equal(t, 0, tracker.partitions())
+
+	assert.NoError(t, tracker.callback(nil, kafka.AssignedPartitions{Partitions: topicPartitions("kafqa", 1)}))
+	assert.Equal(t, 1, tracker.partitions())
+}
+
+func TestShouldDropStateOfRevokedPartitions(t *testing.T) {
+	logger.Setup("")
+	var dropped []kafka.TopicPartition
+	tracker := newRebalanceTracker(1, time.Now())
+	tracker.onRevoke = func(tps []kafka.TopicPartition) { dropped = tps }
+
+	assert.NoError(t, tracker.callback(nil, kafka.AssignedPartitions{Partitions: topicPartitions("kafqa", 0, 1)}))
+	assert.Nil(t, dropped)
+	assert.NoError(t, tracker.callback(nil, kafka.RevokedPartitions{Partitions: topicPartitions("kafqa", 1)}))
+	assert.Equal(t, topicPartitions("kafqa", 1), dropped)
+}
+
+func TestShouldMeasureRebalanceWindowFromRevocation(t *testing.T) {
+	logger.Setup("")
+	subscribed := time.Now()
+	tracker := newRebalanceTracker(2, subscribed)
+
+	tracker.assign(topicPartitions("kafqa", 0, 1), subscribed.Add(time.Second))
+	assert.True(t, tracker.since.IsZero(), "initial assignment completes the subscription window")
+
+	revoked := subscribed.Add(time.Minute)
+	tracker.revoke(topicPartitions("kafqa", 0, 1), revoked)
+	assert.Equal(t, revoked, tracker.since)
+	assert.Equal(t, 2, tracker.revoked)
+
+	tracker.assign(topicPartitions("kafqa", 0), revoked.Add(3*time.Second))
+	assert.True(t, tracker.since.IsZero())
+	assert.Equal(t, 0, tracker.revoked)
+}
+
+func TestShouldIgnoreOtherEventsInRebalanceCallback(t *testing.T) {
+	tracker := newRebalanceTracker(0, time.Now())
+
+	assert.NoError(t, tracker.callback(nil, kafka.PartitionEOF{}))
+	assert.Equal(t, 0, tracker.partitions())
+}
@@ -0,0 +1,258 @@
+package control
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"sync"
+
+	"github.com/gojek/kafqa/config"
+	"github.com/gojek/kafqa/logger"
+	"github.com/gojek/kafqa/reporter"
+)
+
+// Producer adjusts the producing of a run in progress
+type Producer interface {
+	Pause()
+	Resume()
+	Paused() bool
+	SetRate(int)
+	Rate() int
+	SetConcurrency(int)
+	Concurrency() int
+}
+
+// Run is a run started through the api
+type Run interface {
+	// nil when the run doesn't produce
+	Producer() Producer
+	// Stop ends the run, it's done once reported
+	Stop()
+	Done() <-chan struct{}
+}
+
+// Starter sets up and starts a run with the config
+type Starter func(config.Application) (Run, error)
+
+type Status struct {
+	Running     bool `json:"running"`
+	Paused      bool `json:"paused"`
+	Rate        int  `json:"rate"`
+	Concurrency int  `json:"concurrency"`
+}
+
+// ProducerUpdate changes the fields given of the producer
+type ProducerUpdate struct {
+	Rate        *int `json:"rate"`
+	Concurrency *int `json:"concurrency"`
+}
+
+// Server runs one run at a time, started with the config loaded from env overridden by the json posted
+type Server struct {
+	cfg   config.Application
+	start Starter
+	mu    sync.Mutex
+	run   Run
+	// a run is being set up, outside the lock as it connects to the brokers and the store
+	starting bool
+}
+
+// Handler serves the api:
+// GET /run status, POST /run start, DELETE /run stop, POST /run/pause, POST /run/resume,
+// PATCH /run/producer rate and concurrency, GET /run/report live report
+func (s *Server) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/run", s.handleRun)
+	mux.HandleFunc("/run/pause", s.producer(http.MethodPost, func(p Producer, _ *http.Request) error {
+		p.Pause()
+		return nil
+	}))
+	mux.HandleFunc("/run/resume", s.producer(http.MethodPost, func(p Producer, _ *http.Request) error {
+		p.Resume()
+		return nil
+	}))
+	mux.HandleFunc("/run/producer", s.producer(http.MethodPatch, updateProducer))
+	mux.HandleFunc("/run/report", s.handleReport)
+	return mux
+}
+
+func (s *Server) handleRun(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		writeJSON(w, http.StatusOK, status(s.current()))
+	case http.MethodPost:
+		s.handleStart(w, r)
+	case http.MethodDelete:
+		s.mu.Lock()
+		run := s.current()
+		s.mu.Unlock()
+		if run == nil {
+			http.Error(w, "no run in progress", http.StatusNotFound)
+			return
+		}
+		run.Stop()
+		<-run.Done()
+		writeJSON(w, http.StatusOK, status(nil))
+	default:
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+func (s *Server) handleStart(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	if s.starting || s.current() != nil {
+		s.mu.Unlock()
+		http.Error(w, "a run is in progress", http.StatusConflict)
+		return
+	}
+	s.starting = true
+	s.mu.Unlock()
+	run, err := s.setup(w, r)
+	s.mu.Lock()
+	s.starting = false
+	s.run = run
+	s.mu.Unlock()
+	if err != nil {
+		return
+	}
+	logger.Infof("run started through the control api")
+	writeJSON(w, http.StatusCreated, status(run))
+}
+
+// setup starts a run with the config posted, the error is written to the response
+func (s *Server) setup(w http.ResponseWriter, r *http.Request) (Run, error) {
+	cfg := s.cfg
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return nil, err
+	}
+	if len(body) > 0 {
+		if cfg, err = config.Override(s.cfg, body); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return nil, err
+		}
+	}
+	run, err := s.start(cfg)
+	if err != nil {
+		logger.Errorf("error starting run: %v", err)
+		http.Error(w, fmt.Sprintf("error starting run: %v", err), http.StatusInternalServerError)
+		return nil, err
+	}
+	return run, nil
+}
+
+// producer handles a change to the producer of the run in progress
+func (s *Server) producer(method string, change func(Producer, *http.Request) error) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != method {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		run := s.current()
+		if run == nil {
+			http.Error(w, "no run in progress", http.StatusNotFound)
+			return
+		}
+		p := run.Producer()
+		if p == nil {
+			http.Error(w, "run doesn't produce", http.StatusConflict)
+			return
+		}
+		if err := change(p, r); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		writeJSON(w, http.StatusOK, status(run))
+	}
+}
+
+func updateProducer(p Producer, r *http.Request) error {
+	var update ProducerUpdate
+	if err := json.NewDecoder(r.Body).Decode(&update); err != nil {
+		return fmt.Errorf("invalid producer update: %v", err)
+	}
+	if (update.Rate != nil && *update.Rate < 0) || (update.Concurrency != nil && *update.Concurrency < 0) {
+		return fmt.Errorf("rate and concurrency can't be negative")
+	}
+	if update.Rate != nil {
+		p.SetRate(*update.Rate)
+	}
+	if update.Concurrency != nil {
+		p.SetConcurrency(*update.Concurrency)
+	}
+	return nil
+}
+
+func (s *Server) handleReport(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	s.mu.Lock()
+	run := s.current()
+	s.mu.Unlock()
+	if run == nil {
+		http.Error(w, "no run in progress", http.StatusNotFound)
+		return
+	}
+	report, err := reporter.Live()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	}
+	writeJSON(w, http.StatusOK, report)
+}
+
+// current is the run in progress, nil once done
+func (s *Server) current() Run {
+	if s.run == nil {
+		return nil
+	}
+	select {
+	case <-s.run.Done():
+		s.run = nil
+	default:
+	}
+	return s.run
+}
+
+// Stop ends the run in progress and waits until it's reported
+func (s *Server) Stop() {
+	s.mu.Lock()
+	run := s.current()
+	s.mu.Unlock()
+	if run != nil {
+		run.Stop()
+		<-run.Done()
+	}
+}
+
+func status(run Run) Status {
+	if run == nil {
+		return Status{}
+	}
+	st := Status{Running: true}
+	if p := run.Producer(); p != nil {
+		st.Paused, st.Rate, st.Concurrency = p.Paused(), p.Rate(), p.Concurrency()
+	}
+	return st
+}
+
+func writeJSON(w http.ResponseWriter, code int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		logger.Errorf("error writing control api response: %v", err)
+	}
+}
+
+// New serves runs started with the config given, overridden by the one posted
+func New(cfg config.Application, start Starter) *Server {
+	return &Server{cfg: cfg, start: start}
+}
@@ -0,0 +1,141 @@
+package control
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/gojek/kafqa/config"
+	"github.com/gojek/kafqa/logger"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func init() {
+	logger.Setup("none")
+}
+
+type fakeProducer struct {
+	paused      bool
+	rate        int
+	concurrency int
+}
+
+func (p *fakeProducer) Pause()               { p.paused = true }
+func (p *fakeProducer) Resume()              { p.paused = false }
+func (p *fakeProducer) Paused() bool         { return p.paused }
+func (p *fakeProducer) SetRate(rate int)     { p.rate = rate }
+func (p *fakeProducer) Rate() int            { return p.rate }
+func (p *fakeProducer) SetConcurrency(n int) { p.concurrency = n }
+func (p *fakeProducer) Concurrency() int     { return p.concurrency }
+
+type fakeRun struct {
+	producer *fakeProducer
+	done     chan struct{}
+	once     sync.Once
+}
+
+func (r *fakeRun) Producer() Producer {
+	if r.producer == nil {
+		return nil
+	}
+	return r.producer
+}
+
+func (r *fakeRun) Stop()                 { r.once.Do(func() { close(r.done) }) }
+func (r *fakeRun) Done() <-chan struct{} { return r.done }
+
+func request(t *testing.T, h http.Handler, method, path, body string) *httptest.ResponseRecorder {
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(method, path, strings.NewReader(body)))
+	return rec
+}
+
+func TestShouldStartRunWithConfigOverridden(t *testing.T) {
+	var started config.Application
+	run := &fakeRun{producer: &fakeProducer{rate: 100, concurrency: 10}, done: make(chan struct{})}
+	srv := New(config.Application{Producer: config.Producer{Topic: "kafqa_test", TotalMessages: 10}},
+		func(cfg config.Application) (Run, error) {
+			started = cfg
+			return run, nil
+		})
+	h := srv.Handler()
+
+	rec := request(t, h, http.MethodPost, "/run", `{"producer": {"TotalMessages": 500}}`)
+
+	require.Equal(t, http.StatusCreated, rec.Code)
+	assert.JSONEq(t, `{"running": true, "paused": false, "rate": 100, "concurrency": 10}`, rec.Body.String())
+	assert.Equal(t, int64(500), started.Producer.TotalMessages)
+	assert.Equal(t, "kafqa_test", started.Producer.Topic)
+	assert.Equal(t, http.StatusConflict, request(t, h, http.MethodPost, "/run", "").Code)
+}
+
+func TestShouldRejectUnknownConfig(t *testing.T) {
+	srv := New(config.Application{}, func(config.Application) (Run, error) {
+		t.Fatal("run started with an invalid config")
+		return nil, nil
+	})
+
+	rec := request(t, srv.Handler(), http.MethodPost, "/run", `{"unknown": {}}`)
+
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+}
+
+func TestShouldPauseResumeAndUpdateProducer(t *testing.T) {
+	p := &fakeProducer{rate: 100, concurrency: 10}
+	srv := New(config.Application{}, func(config.Application) (Run, error) {
+		return &fakeRun{producer: p, done: make(chan struct{})}, nil
+	})
+	h := srv.Handler()
+	require.Equal(t, http.StatusCreated, request(t, h, http.MethodPost, "/run", "").Code)
+
+	assert.Equal(t, http.StatusOK, request(t, h, http.MethodPost, "/run/pause", "").Code)
+	assert.True(t, p.paused)
+	assert.Equal(t, http.StatusOK, request(t, h, http.MethodPost, "/run/resume", "").Code)
+	assert.False(t, p.paused)
+
+	rec := request(t, h, http.MethodPatch, "/run/producer", `{"rate": 250, "concurrency": 4}`)
+	require.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, 250, p.rate)
+	assert.Equal(t, 4, p.concurrency)
+	assert.Equal(t, http.StatusBadRequest, request(t, h, http.MethodPatch, "/run/producer", `{"rate": -1}`).Code)
+	assert.Equal(t, 250, p.rate)
+}
+
+func TestShouldStopRunInProgress(t *testing.T) {
+	run := &fakeRun{done: make(chan struct{})}
+	srv := New(config.Application{}, func(config.Application) (Run, error) { return run, nil })
+	h := srv.Handler()
+	require.Equal(t, http.StatusCreated, request(t, h, http.MethodPost, "/run", "").Code)
+	assert.Equal(t, http.StatusConflict, request(t, h, http.MethodPost, "/run/pause", "").Code)
+
+	rec := request(t, h, http.MethodDelete, "/run", "")
+
+	require.Equal(t, http.StatusOK, rec.Code)
+	assert.JSONEq(t, `{"running": false, "paused": false, "rate": 0, "concurrency": 0}`, rec.Body.String())
+	assert.Equal(t, http.StatusNotFound, request(t, h, http.MethodPost, "/run/pause", "").Code)
+	assert.Equal(t, http.StatusNotFound, request(t, h, http.MethodGet, "/run/report", "").Code)
+}
+
+func TestShouldServeWhileRunIsStarting(t *testing.T) {
+	started, release := make(chan struct{}), make(chan struct{})
+	srv := New(config.Application{}, func(config.Application) (Run, error) {
+		close(started)
+		<-release
+		return &fakeRun{done: make(chan struct{})}, nil
+	})
+	h := srv.Handler()
+	created := make(chan int)
+	go func() { created <- request(t, h, http.MethodPost, "/run", "").Code }()
+	<-started
+
+	assert.Equal(t, http.StatusOK, request(t, h, http.MethodGet, "/run", "").Code)
+	assert.Equal(t, http.StatusConflict, request(t, h, http.MethodPost, "/run", "").Code)
+	close(release)
+
+	assert.Equal(t, http.StatusCreated, <-created)
+	assert.JSONEq(t, `{"running": true, "paused": false, "rate": 0, "concurrency": 0}`,
+		request(t, h, http.MethodGet, "/run", "").Body.String())
+}
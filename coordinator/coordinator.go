@@ -0,0 +1,231 @@
+package coordinator
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/go-redis/redis"
+	"github.com/gojek/kafqa/config"
+	"github.com/gojek/kafqa/logger"
+	"github.com/gojek/kafqa/reporter"
+	"github.com/gojek/kafqa/store"
+)
+
+// Coordinator synchronises the instances of a distributed run through the redis store they share,
+// instances register under the run id, wait for each other before producing and push their results
+// for the aggregator to report the run.
+// Every run of the aggregator starts a new generation of the run id, the other instances join the one
+// it announces so registrations and results left by an earlier run with the same id aren't counted.
+// The ids tracked in the store aren't scoped to the generation, the aggregator clears them when starting one.
+type Coordinator struct {
+	cfg        config.Coordinator
+	id         string
+	store      *store.Redis
+	redisdb    redis.UniversalClient
+	namespace  string
+	ttl        time.Duration
+	cleanup    bool
+	generation int64
+}
+
+func (c *Coordinator) generationKey() string {
+	return fmt.Sprintf("%s:coordinator:generation", c.namespace)
+}
+
+// aggregatorKey announces the generation while the aggregator waits at the barrier
+func (c *Coordinator) aggregatorKey() string {
+	return fmt.Sprintf("%s:coordinator:aggregator", c.namespace)
+}
+
+func (c *Coordinator) instancesKey() string {
+	return fmt.Sprintf("%s:coordinator:%d:instances", c.namespace, c.generation)
+}
+
+func (c *Coordinator) resultsKey() string {
+	return fmt.Sprintf("%s:coordinator:%d:results", c.namespace, c.generation)
+}
+
+func (c *Coordinator) ID() string {
+	return c.id
+}
+
+// Aggregator reports the run, the other instances only push their results
+func (c *Coordinator) Aggregator() bool {
+	return c.cfg.Aggregator
+}
+
+// Join registers the instance and waits at the barrier until all the instances registered,
+// the aggregator starts a new generation and the others wait for it to announce one
+func (c *Coordinator) Join(ctx context.Context) error {
+	if c.cfg.Aggregator {
+		generation, err := c.redisdb.Incr(c.generationKey()).Result()
+		if err != nil {
+			return fmt.Errorf("error starting run generation: %v", err)
+		}
+		c.generation = generation
+		if err := c.expire(c.generationKey()); err != nil {
+			return err
+		}
+		// instances only track ids once past the barrier of this generation
+		if err := c.store.Clear(); err != nil {
+			return fmt.Errorf("error clearing ids of an earlier run: %v", err)
+		}
+	}
+	logger.Infof("instance %s joining, waiting for %d instances", c.id, c.cfg.Instances)
+	ctx, cancel := context.WithTimeout(ctx, c.cfg.BarrierTimeout())
+	defer cancel()
+	var registered int64
+	err := c.poll(ctx, func() (bool, error) {
+		ok, err := c.announced()
+		if err != nil || !ok {
+			return false, err
+		}
+		if err := c.redisdb.SAdd(c.instancesKey(), c.id).Err(); err != nil {
+			return false, fmt.Errorf("error registering instance %s: %v", c.id, err)
+		}
+		if err := c.expire(c.instancesKey()); err != nil {
+			return false, err
+		}
+		registered, err = c.redisdb.SCard(c.instancesKey()).Result()
+		return registered >= int64(c.cfg.Instances), err
+	})
+	if err == context.DeadlineExceeded {
+		if c.generation == 0 {
+			return fmt.Errorf("timed out waiting for the aggregator to start the run")
+		}
+		return fmt.Errorf("timed out waiting for %d instances at the barrier, %d registered", c.cfg.Instances, registered)
+	}
+	return err
+}
+
+// announced refreshes the generation announced by the aggregator, or follows it on the other instances.
+// The announcement expires soon after the aggregator stops waiting, instances keep the one they joined.
+func (c *Coordinator) announced() (bool, error) {
+	heartbeat := 3 * c.cfg.PollInterval()
+	if c.cfg.Aggregator {
+		return true, c.redisdb.Set(c.aggregatorKey(), c.generation, heartbeat).Err()
+	}
+	value, err := c.redisdb.Get(c.aggregatorKey()).Result()
+	if err == redis.Nil {
+		return c.generation != 0, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	generation, err := strconv.ParseInt(value, 10, 64)
+	if err != nil {
+		return false, fmt.Errorf("invalid run generation %s: %v", value, err)
+	}
+	c.generation = generation
+	return true, nil
+}
+
+// Push flushes the ids tracked by the instance and pushes its results
+func (c *Coordinator) Push(result reporter.InstanceResult) error {
+	if err := c.store.Flush(); err != nil {
+		return fmt.Errorf("error flushing ids to redis: %v", err)
+	}
+	data, err := json.Marshal(result)
+	if err != nil {
+		return err
+	}
+	if err := c.redisdb.HSet(c.resultsKey(), c.id, data).Err(); err != nil {
+		return err
+	}
+	return c.expire(c.resultsKey())
+}
+
+// Results waits for the results of all the instances, the registered instances which didn't push
+// theirs by the report timeout are returned as missing
+func (c *Coordinator) Results(ctx context.Context) ([]reporter.InstanceResult, []string, error) {
+	ctx, cancel := context.WithTimeout(ctx, c.cfg.ReportTimeout())
+	defer cancel()
+	err := c.poll(ctx, func() (bool, error) {
+		pushed, err := c.redisdb.HLen(c.resultsKey()).Result()
+		return pushed >= int64(c.cfg.Instances), err
+	})
+	if err != nil && err != context.DeadlineExceeded {
+		return nil, nil, err
+	}
+	pushed, err := c.redisdb.HGetAll(c.resultsKey()).Result()
+	if err != nil {
+		return nil, nil, err
+	}
+	instances, err := c.redisdb.SMembers(c.instancesKey()).Result()
+	if err != nil {
+		return nil, nil, err
+	}
+	var results []reporter.InstanceResult
+	for id, data := range pushed {
+		var result reporter.InstanceResult
+		if err := json.Unmarshal([]byte(data), &result); err != nil {
+			return nil, nil, fmt.Errorf("error decoding results of instance %s: %v", id, err)
+		}
+		results = append(results, result)
+	}
+	sort.Slice(results, func(i, j int) bool { return results[i].ID < results[j].ID })
+	var missing []string
+	for _, id := range instances {
+		if _, ok := pushed[id]; !ok {
+			missing = append(missing, id)
+		}
+	}
+	sort.Strings(missing)
+	return results, missing, nil
+}
+
+// Close deletes the keys of the run on the aggregator when the store cleans up, once reported
+func (c *Coordinator) Close() error {
+	if !c.cleanup {
+		return nil
+	}
+	return c.redisdb.Del(c.generationKey(), c.aggregatorKey(), c.instancesKey(), c.resultsKey()).Err()
+}
+
+func (c *Coordinator) expire(key string) error {
+	if c.ttl <= 0 {
+		return nil
+	}
+	return c.redisdb.Expire(key, c.ttl).Err()
+}
+
+func (c *Coordinator) poll(ctx context.Context, done func() (bool, error)) error {
+	ticker := time.NewTicker(c.cfg.PollInterval())
+	defer ticker.Stop()
+	for {
+		ok, err := done()
+		if err != nil || ok {
+			return err
+		}
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// New coordinates the instance through the redis store of the run, only the aggregator deletes
+// the keys of the run as the others close before it reported
+func New(cfg config.Coordinator, id string, rs *store.Redis) *Coordinator {
+	if cfg.PollIntervalMs <= 0 {
+		cfg.PollIntervalMs = 500
+	}
+	c := &Coordinator{
+		cfg:       cfg,
+		id:        id,
+		store:     rs,
+		redisdb:   rs.Client(),
+		namespace: rs.Namespace(),
+		ttl:       rs.KeyTTL(),
+		cleanup:   cfg.Aggregator && rs.CleansUp(),
+	}
+	if !cfg.Aggregator {
+		rs.KeepOnClose()
+	}
+	return c
+}
@@ -0,0 +1,159 @@
+package coordinator
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis"
+	"github.com/gojek/kafqa/config"
+	"github.com/gojek/kafqa/creator"
+	"github.com/gojek/kafqa/logger"
+	"github.com/gojek/kafqa/reporter"
+	"github.com/gojek/kafqa/store"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gopkg.in/confluentinc/confluent-kafka-go.v1/kafka"
+)
+
+func init() {
+	logger.Setup("none")
+}
+
+func newCoordinator(t *testing.T, mr *miniredis.Miniredis, id string, aggregator bool, opts ...store.RedisOption) *Coordinator {
+	rs, err := store.NewRedis(mr.Addr(), "run", func(t store.Trace) string { return t.Message.ID }, opts...)
+	require.NoError(t, err)
+	cfg := config.Coordinator{Instances: 2, Aggregator: aggregator, BarrierTimeoutMs: 1000, ReportTimeoutMs: 200,
+		PollIntervalMs: 10}
+	return New(cfg, id, rs)
+}
+
+// join runs the barrier of both instances, returning once they passed it
+func join(t *testing.T, aggregator, instance *Coordinator) {
+	joined := make(chan error)
+	go func() { joined <- instance.Join(context.Background()) }()
+	require.NoError(t, aggregator.Join(context.Background()))
+	require.NoError(t, <-joined)
+}
+
+func TestShouldWaitAtBarrierUntilAllInstancesRegister(t *testing.T) {
+	mr, err := miniredis.Run()
+	require.NoError(t, err)
+	defer mr.Close()
+	aggregator, instance := newCoordinator(t, mr, "pod-1", true), newCoordinator(t, mr, "pod-2", false)
+	joined := make(chan error)
+
+	go func() { joined <- aggregator.Join(context.Background()) }()
+	select {
+	case <-joined:
+		t.Fatal("aggregator passed the barrier alone")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	require.NoError(t, instance.Join(context.Background()))
+	assert.NoError(t, <-joined)
+	assert.Equal(t, aggregator.generation, instance.generation)
+}
+
+func TestShouldFailWhenInstancesDontRegisterInTime(t *testing.T) {
+	mr, err := miniredis.Run()
+	require.NoError(t, err)
+	defer mr.Close()
+	aggregator, instance := newCoordinator(t, mr, "pod-1", true), newCoordinator(t, mr, "pod-2", false)
+	aggregator.cfg.BarrierTimeoutMs, instance.cfg.BarrierTimeoutMs = 50, 50
+
+	assert.EqualError(t, instance.Join(context.Background()), "timed out waiting for the aggregator to start the run")
+	assert.EqualError(t, aggregator.Join(context.Background()), "timed out waiting for 2 instances at the barrier, 1 registered")
+}
+
+func TestShouldReturnResultsAndMissingInstances(t *testing.T) {
+	mr, err := miniredis.Run()
+	require.NoError(t, err)
+	defer mr.Close()
+	aggregator, instance := newCoordinator(t, mr, "pod-1", true), newCoordinator(t, mr, "pod-2", false)
+	join(t, aggregator, instance)
+	latency := reporter.NewHistogram()
+	latency.Observe(20)
+	require.NoError(t, aggregator.Push(reporter.InstanceResult{ID: "pod-1", Corrupted: 2, Latency: latency}))
+
+	results, missing, err := aggregator.Results(context.Background())
+
+	require.NoError(t, err)
+	require.Len(t, results, 1)
+	assert.Equal(t, "pod-1", results[0].ID)
+	assert.Equal(t, int64(2), results[0].Corrupted)
+	assert.Equal(t, uint32(20), results[0].Latency.Max)
+	assert.Equal(t, []string{"pod-2"}, missing)
+}
+
+func TestShouldNotCountRegistrationsAndResultsOfEarlierRunWithSameID(t *testing.T) {
+	mr, err := miniredis.Run()
+	require.NoError(t, err)
+	defer mr.Close()
+	earlier, earlierInstance := newCoordinator(t, mr, "pod-1", true), newCoordinator(t, mr, "pod-2", false)
+	join(t, earlier, earlierInstance)
+	require.NoError(t, earlierInstance.store.Track(store.Trace{Message: creator.Message{ID: "1"}}))
+	require.NoError(t, earlierInstance.Push(reporter.InstanceResult{ID: "pod-2", Corrupted: 5}))
+	// the announcement of the earlier aggregator expires
+	mr.FastForward(time.Second)
+
+	aggregator, instance := newCoordinator(t, mr, "pod-1", true), newCoordinator(t, mr, "pod-2", false)
+	joined := make(chan error)
+	go func() { joined <- instance.Join(context.Background()) }()
+	select {
+	case <-joined:
+		t.Fatal("instance passed the barrier with the registrations of the earlier run")
+	case <-time.After(50 * time.Millisecond):
+	}
+	require.NoError(t, aggregator.Join(context.Background()))
+	require.NoError(t, <-joined)
+	require.NoError(t, aggregator.Push(reporter.InstanceResult{ID: "pod-1"}))
+
+	results, missing, err := aggregator.Results(context.Background())
+
+	require.NoError(t, err)
+	require.Len(t, results, 1)
+	assert.Equal(t, "pod-1", results[0].ID)
+	assert.Equal(t, []string{"pod-2"}, missing)
+	assert.Equal(t, int64(0), aggregator.store.Result().Tracked, "ids of the earlier run should be cleared")
+}
+
+func TestShouldExpireCoordinationKeysWithStoreTTL(t *testing.T) {
+	mr, err := miniredis.Run()
+	require.NoError(t, err)
+	defer mr.Close()
+	ttl := store.TTL(time.Minute)
+	aggregator, instance := newCoordinator(t, mr, "pod-1", true, ttl), newCoordinator(t, mr, "pod-2", false, ttl)
+
+	join(t, aggregator, instance)
+	require.NoError(t, instance.Push(reporter.InstanceResult{ID: "pod-2"}))
+
+	for _, key := range []string{aggregator.generationKey(), aggregator.instancesKey(), aggregator.resultsKey()} {
+		assert.Equal(t, time.Minute, mr.TTL(key), key)
+	}
+}
+
+func TestShouldOnlyCleanupOnAggregatorOnceReported(t *testing.T) {
+	mr, err := miniredis.Run()
+	require.NoError(t, err)
+	defer mr.Close()
+	cleanup := store.CleanupOnClose()
+	aggregator, instance := newCoordinator(t, mr, "pod-1", true, cleanup), newCoordinator(t, mr, "pod-2", false, cleanup)
+	join(t, aggregator, instance)
+	topic := "kafqa_test"
+	require.NoError(t, instance.store.Track(store.Trace{Message: creator.Message{ID: "1"},
+		TopicPartition: kafka.TopicPartition{Topic: &topic}}))
+	require.NoError(t, instance.Push(reporter.InstanceResult{ID: "pod-2"}))
+
+	require.NoError(t, instance.Close())
+	require.NoError(t, instance.store.Close())
+
+	assert.True(t, mr.Exists("run:tracked:ids"))
+	assert.True(t, mr.Exists(aggregator.resultsKey()))
+	require.NoError(t, aggregator.Push(reporter.InstanceResult{ID: "pod-1"}))
+	_, _, err = aggregator.Results(context.Background())
+	require.NoError(t, err)
+	require.NoError(t, aggregator.Close())
+	require.NoError(t, aggregator.store.Close())
+	assert.Empty(t, mr.Keys())
+}
@@ -0,0 +1,226 @@
+package fake
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/gojek/kafqa/config"
+	"gopkg.in/confluentinc/confluent-kafka-go.v1/kafka"
+)
+
+type partition struct {
+	topic string
+	id    int32
+}
+
+func (p partition) topicPartition(offset kafka.Offset) kafka.TopicPartition {
+	topic := p.topic
+	return kafka.TopicPartition{Topic: &topic, Partition: p.id, Offset: offset}
+}
+
+// Broker is an in-memory kafka cluster of a single broker, topics are created on first use.
+// Producers and consumers created from it behave like the librdkafka clients kafqa uses.
+type Broker struct {
+	cfg config.FakeBroker
+	mu  sync.RWMutex
+	// logs by topic and partition, dropped messages are kept as nil to leave a gap in the offsets
+	topics map[string][][]*kafka.Message
+	groups map[string]*group
+	// serialises rebalances so members see the assignments in order
+	rebalanceMu sync.Mutex
+	// closed and replaced on every append, to wake up the waiting consumers
+	appended chan struct{}
+}
+
+type group struct {
+	members []*Consumer
+	offsets map[partition]kafka.Offset
+}
+
+// append adds the message to the log of its partition, a nil message only takes an offset
+func (b *Broker) append(p partition, msg *kafka.Message) (kafka.Offset, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	logs := b.createTopic(p.topic)
+	if p.id < 0 || int(p.id) >= len(logs) {
+		return kafka.OffsetInvalid, kafka.NewError(kafka.ErrUnknownPartition, "Local: Unknown partition", false)
+	}
+	offset := kafka.Offset(len(logs[p.id]))
+	if msg != nil {
+		stored := *msg
+		stored.TopicPartition = p.topicPartition(offset)
+		if stored.Timestamp.IsZero() {
+			stored.Timestamp = time.Now()
+		}
+		msg = &stored
+	}
+	logs[p.id] = append(logs[p.id], msg)
+	close(b.appended)
+	b.appended = make(chan struct{})
+	return offset, nil
+}
+
+// read returns the next message of the partition from the offset, skipping dropped ones
+func (b *Broker) read(p partition, offset kafka.Offset) (*kafka.Message, bool) {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	logs := b.topics[p.topic]
+	if int(p.id) >= len(logs) {
+		return nil, false
+	}
+	for ; int(offset) < len(logs[p.id]); offset++ {
+		if msg := logs[p.id][offset]; msg != nil {
+			cp := *msg
+			cp.TopicPartition = p.topicPartition(offset)
+			return &cp, true
+		}
+	}
+	return nil, false
+}
+
+func (b *Broker) highWatermark(p partition) kafka.Offset {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	logs := b.topics[p.topic]
+	if int(p.id) >= len(logs) {
+		return 0
+	}
+	return kafka.Offset(len(logs[p.id]))
+}
+
+func (b *Broker) partitionCount(topic string) int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return len(b.createTopic(topic))
+}
+
+// waiter is closed on the next append
+func (b *Broker) waiter() <-chan struct{} {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	return b.appended
+}
+
+func (b *Broker) createTopic(topic string) [][]*kafka.Message {
+	logs, ok := b.topics[topic]
+	if !ok {
+		logs = make([][]*kafka.Message, b.cfg.Partitions)
+		b.topics[topic] = logs
+	}
+	return logs
+}
+
+func (b *Broker) committed(groupID string, p partition) (kafka.Offset, bool) {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	g, ok := b.groups[groupID]
+	if !ok {
+		return 0, false
+	}
+	offset, ok := g.offsets[p]
+	return offset, ok
+}
+
+func (b *Broker) commit(groupID string, offsets []kafka.TopicPartition) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	g := b.group(groupID)
+	for _, tp := range offsets {
+		if tp.Topic != nil && tp.Offset >= 0 {
+			g.offsets[partition{*tp.Topic, tp.Partition}] = tp.Offset
+		}
+	}
+}
+
+func (b *Broker) group(groupID string) *group {
+	g, ok := b.groups[groupID]
+	if !ok {
+		g = &group{offsets: make(map[partition]kafka.Offset)}
+		b.groups[groupID] = g
+	}
+	return g
+}
+
+// join adds the consumer to its group and rebalances the partitions across the members
+func (b *Broker) join(c *Consumer) {
+	b.rebalanceMu.Lock()
+	defer b.rebalanceMu.Unlock()
+	b.mu.Lock()
+	for _, topic := range c.topics {
+		b.createTopic(topic)
+	}
+	g := b.group(c.groupID)
+	g.members = append(g.members, c)
+	assignments := b.assign(g)
+	b.mu.Unlock()
+	rebalance(assignments)
+}
+
+// leave removes the consumer from its group, its partitions are assigned to the other members
+func (b *Broker) leave(c *Consumer) {
+	b.rebalanceMu.Lock()
+	defer b.rebalanceMu.Unlock()
+	b.mu.Lock()
+	g := b.group(c.groupID)
+	for i, m := range g.members {
+		if m == c {
+			g.members = append(g.members[:i], g.members[i+1:]...)
+			break
+		}
+	}
+	assignments := b.assign(g)
+	b.mu.Unlock()
+	rebalance(assignments)
+}
+
+// assign spreads the partitions of the subscribed topics round robin across the members
+func (b *Broker) assign(g *group) map[*Consumer][]partition {
+	subscribed := make(map[string]bool)
+	for _, m := range g.members {
+		for _, topic := range m.topics {
+			subscribed[topic] = true
+		}
+	}
+	var topics []string
+	for topic := range subscribed {
+		topics = append(topics, topic)
+	}
+	sort.Strings(topics)
+	assignments := make(map[*Consumer][]partition, len(g.members))
+	for _, m := range g.members {
+		assignments[m] = nil
+	}
+	i := 0
+	for _, topic := range topics {
+		for id := range b.topics[topic] {
+			for n := 0; n < len(g.members); n++ {
+				m := g.members[(i+n)%len(g.members)]
+				if m.subscribed(topic) {
+					assignments[m] = append(assignments[m], partition{topic, int32(id)})
+					i = (i + n + 1) % len(g.members)
+					break
+				}
+			}
+		}
+	}
+	return assignments
+}
+
+func rebalance(assignments map[*Consumer][]partition) {
+	for m, partitions := range assignments {
+		m.reassign(partitions)
+	}
+}
+
+func NewBroker(cfg config.FakeBroker) *Broker {
+	if cfg.Partitions <= 0 {
+		cfg.Partitions = 1
+	}
+	return &Broker{
+		cfg:      cfg,
+		topics:   make(map[string][][]*kafka.Message),
+		groups:   make(map[string]*group),
+		appended: make(chan struct{}),
+	}
+}
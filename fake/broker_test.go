@@ -0,0 +1,157 @@
+package fake
+
+import (
+	"testing"
+	"time"
+
+	"github.com/gojek/kafqa/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gopkg.in/confluentinc/confluent-kafka-go.v1/kafka"
+)
+
+func produce(t *testing.T, p *Producer, topic string, partition int32, values ...string) []*kafka.Message {
+	var reports []*kafka.Message
+	for _, v := range values {
+		require.NoError(t, p.Produce(&kafka.Message{
+			TopicPartition: kafka.TopicPartition{Topic: &topic, Partition: partition},
+			Value:          []byte(v),
+		}, nil))
+	}
+	for range values {
+		select {
+		case ev := <-p.Events():
+			reports = append(reports, ev.(*kafka.Message))
+		case <-time.After(time.Second):
+			t.Fatal("delivery report not received")
+		}
+	}
+	return reports
+}
+
+func consume(t *testing.T, c *Consumer, n int) []string {
+	var values []string
+	for len(values) < n {
+		msg, err := c.ReadMessage(time.Second)
+		require.NoError(t, err)
+		values = append(values, string(msg.Value))
+	}
+	return values
+}
+
+func subscribed(t *testing.T, b *Broker, groupID string, topics ...string) *Consumer {
+	c, err := b.NewConsumer(config.Consumer{GroupID: groupID, OffsetReset: "earliest", EnableAutoCommit: true})
+	require.NoError(t, err)
+	require.NoError(t, c.SubscribeTopics(topics, nil))
+	return c
+}
+
+func TestShouldConsumeProducedMessagesInOrder(t *testing.T) {
+	b := NewBroker(config.FakeBroker{Partitions: 1})
+	p := b.NewProducer(config.Producer{})
+	defer p.Close()
+
+	reports := produce(t, p, "kafqa", kafka.PartitionAny, "a", "b", "c")
+	c := subscribed(t, b, "group", "kafqa")
+
+	assert.Equal(t, []string{"a", "b", "c"}, consume(t, c, 3))
+	assert.Equal(t, kafka.Offset(2), reports[2].TopicPartition.Offset)
+	_, err := c.ReadMessage(10 * time.Millisecond)
+	assert.Equal(t, kafka.ErrTimedOut, err.(kafka.Error).Code())
+}
+
+func TestShouldAcknowledgeDroppedMessagesWithoutAppending(t *testing.T) {
+	b := NewBroker(config.FakeBroker{Partitions: 1, DropRate: 1})
+	p := b.NewProducer(config.Producer{})
+	defer p.Close()
+
+	reports := produce(t, p, "kafqa", 0, "a", "b")
+
+	assert.NoError(t, reports[1].TopicPartition.Error)
+	assert.Equal(t, kafka.Offset(2), b.highWatermark(partition{"kafqa", 0}))
+	_, ok := b.read(partition{"kafqa", 0}, 0)
+	assert.False(t, ok)
+}
+
+func TestShouldDuplicateMessages(t *testing.T) {
+	b := NewBroker(config.FakeBroker{Partitions: 1, DuplicateRate: 1})
+	p := b.NewProducer(config.Producer{})
+	defer p.Close()
+
+	produce(t, p, "kafqa", 0, "a", "b")
+
+	assert.Equal(t, []string{"a", "a", "b", "b"}, consume(t, subscribed(t, b, "group", "kafqa"), 4))
+}
+
+func TestShouldAppendHeldMessageAfterTheNext(t *testing.T) {
+	b := NewBroker(config.FakeBroker{Partitions: 1, ReorderRate: 1})
+	p := b.NewProducer(config.Producer{})
+	defer p.Close()
+
+	topic := "kafqa"
+	for _, v := range []string{"a", "b", "c"} {
+		require.NoError(t, p.Produce(&kafka.Message{TopicPartition: kafka.TopicPartition{Topic: &topic, Partition: 0}, Value: []byte(v)}, nil))
+	}
+	assert.Equal(t, []string{"b", "a", "c"}, consume(t, subscribed(t, b, "group", "kafqa"), 3))
+}
+
+func TestShouldReportDeliveryErrors(t *testing.T) {
+	b := NewBroker(config.FakeBroker{Partitions: 2, MaxMessageBytes: 1})
+	p := b.NewProducer(config.Producer{})
+	defer p.Close()
+
+	unknown := produce(t, p, "kafqa", 5, "a")[0]
+	oversized := produce(t, p, "kafqa", 0, "ab")[0]
+
+	assert.Equal(t, kafka.ErrUnknownPartition, unknown.TopicPartition.Error.(kafka.Error).Code())
+	assert.Equal(t, kafka.ErrMsgSizeTooLarge, oversized.TopicPartition.Error.(kafka.Error).Code())
+}
+
+func TestShouldFailProduceWhenQueueIsFull(t *testing.T) {
+	b := NewBroker(config.FakeBroker{Partitions: 1, DelayMs: 1000})
+	cfg := config.Producer{}
+	cfg.Librdconfigs.QueueBufferingMaxMessage = 1
+	p := b.NewProducer(cfg)
+	topic := "kafqa"
+	msg := &kafka.Message{TopicPartition: kafka.TopicPartition{Topic: &topic, Partition: 0}}
+
+	var err error
+	for i := 0; i < 3 && err == nil; i++ {
+		err = p.Produce(msg, nil)
+	}
+
+	require.Error(t, err)
+	assert.Equal(t, kafka.ErrQueueFull, err.(kafka.Error).Code())
+}
+
+func TestShouldRebalancePartitionsAcrossGroupMembers(t *testing.T) {
+	b := NewBroker(config.FakeBroker{Partitions: 4})
+	first := subscribed(t, b, "group", "kafqa")
+	var events []kafka.Event
+	first.rebalance = func(_ *kafka.Consumer, ev kafka.Event) error {
+		events = append(events, ev)
+		return nil
+	}
+
+	second := subscribed(t, b, "group", "kafqa")
+	assert.Len(t, first.assigned, 2)
+	assert.Len(t, second.assigned, 2)
+	require.Len(t, events, 2)
+	assert.IsType(t, kafka.RevokedPartitions{}, events[0])
+	assert.IsType(t, kafka.AssignedPartitions{}, events[1])
+
+	require.NoError(t, second.Close())
+	assert.Len(t, first.assigned, 4)
+}
+
+func TestShouldResumeGroupFromCommittedOffsets(t *testing.T) {
+	b := NewBroker(config.FakeBroker{Partitions: 1})
+	p := b.NewProducer(config.Producer{})
+	defer p.Close()
+	produce(t, p, "kafqa", 0, "a", "b", "c")
+	c := subscribed(t, b, "group", "kafqa")
+	consume(t, c, 1)
+	require.NoError(t, c.Close())
+
+	assert.Equal(t, []string{"b", "c"}, consume(t, subscribed(t, b, "group", "kafqa"), 2))
+}
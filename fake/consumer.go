@@ -0,0 +1,197 @@
+package fake
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gojek/kafqa/config"
+	"gopkg.in/confluentinc/confluent-kafka-go.v1/kafka"
+)
+
+// Consumer is a group member of the fake broker, offsets are committed on read with auto commit.
+// Rebalances are eager, all the partitions are revoked before the new assignment.
+type Consumer struct {
+	broker     *Broker
+	groupID    string
+	autoCommit bool
+	reset      string
+	topics     []string
+	rebalance  kafka.RebalanceCb
+
+	mu        sync.Mutex
+	assigned  []partition
+	positions map[partition]kafka.Offset
+	next      int
+	closed    bool
+}
+
+func (c *Consumer) SubscribeTopics(topics []string, cb kafka.RebalanceCb) error {
+	for _, topic := range topics {
+		if strings.HasPrefix(topic, "^") {
+			return fmt.Errorf("regex subscription %s isn't supported by the fake broker", topic)
+		}
+	}
+	c.topics, c.rebalance = topics, cb
+	c.broker.join(c)
+	return nil
+}
+
+func (c *Consumer) subscribed(topic string) bool {
+	for _, t := range c.topics {
+		if t == topic {
+			return true
+		}
+	}
+	return false
+}
+
+// reassign revokes the partitions held and assigns the new ones from their committed offsets
+func (c *Consumer) reassign(partitions []partition) {
+	c.mu.Lock()
+	if samePartitions(c.assigned, partitions) {
+		c.mu.Unlock()
+		return
+	}
+	revoked := c.assigned
+	c.assigned = partitions
+	c.positions = make(map[partition]kafka.Offset, len(partitions))
+	for _, p := range partitions {
+		c.positions[p] = c.startOffset(p)
+	}
+	c.next = 0
+	c.mu.Unlock()
+
+	if c.rebalance == nil {
+		return
+	}
+	if len(revoked) > 0 {
+		c.rebalance(nil, kafka.RevokedPartitions{Partitions: topicPartitions(revoked)})
+	}
+	c.rebalance(nil, kafka.AssignedPartitions{Partitions: topicPartitions(partitions)})
+}
+
+func (c *Consumer) startOffset(p partition) kafka.Offset {
+	if offset, ok := c.broker.committed(c.groupID, p); ok {
+		return offset
+	}
+	if c.reset == "earliest" || c.reset == "smallest" || c.reset == "beginning" {
+		return 0
+	}
+	return c.broker.highWatermark(p)
+}
+
+func (c *Consumer) ReadMessage(timeout time.Duration) (*kafka.Message, error) {
+	deadline := time.Now().Add(timeout)
+	for {
+		// wait on the append following the read, so a message appended in between isn't missed
+		appended := c.broker.waiter()
+		msg, err := c.readNext()
+		if msg != nil || err != nil {
+			return msg, err
+		}
+		wait := time.Until(deadline)
+		if wait <= 0 {
+			return nil, kafka.NewError(kafka.ErrTimedOut, "Local: Timed out", false)
+		}
+		select {
+		case <-appended:
+		case <-time.After(wait):
+		}
+	}
+}
+
+// readNext reads the assigned partitions round robin
+func (c *Consumer) readNext() (*kafka.Message, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.closed {
+		return nil, kafka.NewError(kafka.ErrState, "Local: Consumer closed", false)
+	}
+	for i := 0; i < len(c.assigned); i++ {
+		p := c.assigned[(c.next+i)%len(c.assigned)]
+		msg, ok := c.broker.read(p, c.positions[p])
+		if !ok {
+			continue
+		}
+		c.next = (c.next + i + 1) % len(c.assigned)
+		c.positions[p] = msg.TopicPartition.Offset + 1
+		if c.autoCommit {
+			c.broker.commit(c.groupID, []kafka.TopicPartition{p.topicPartition(msg.TopicPartition.Offset + 1)})
+		}
+		return msg, nil
+	}
+	return nil, nil
+}
+
+func (c *Consumer) Poll(timeoutMs int) kafka.Event {
+	msg, err := c.ReadMessage(time.Duration(timeoutMs) * time.Millisecond)
+	if err != nil {
+		if kerr, ok := err.(kafka.Error); ok && kerr.Code() == kafka.ErrTimedOut {
+			return nil
+		}
+		return err.(kafka.Error)
+	}
+	return msg
+}
+
+func (c *Consumer) CommitOffsets(offsets []kafka.TopicPartition) ([]kafka.TopicPartition, error) {
+	c.broker.commit(c.groupID, offsets)
+	return offsets, nil
+}
+
+// StoreOffsets commits right away, there's no auto commit interval to wait for
+func (c *Consumer) StoreOffsets(offsets []kafka.TopicPartition) ([]kafka.TopicPartition, error) {
+	return c.CommitOffsets(offsets)
+}
+
+func (c *Consumer) Close() error {
+	c.mu.Lock()
+	if c.closed {
+		c.mu.Unlock()
+		return nil
+	}
+	c.closed = true
+	revoked := c.assigned
+	c.assigned = nil
+	c.mu.Unlock()
+	if c.rebalance != nil && len(revoked) > 0 {
+		c.rebalance(nil, kafka.RevokedPartitions{Partitions: topicPartitions(revoked)})
+	}
+	c.broker.leave(c)
+	return nil
+}
+
+// NewConsumer creates a consumer of the group configured, it joins the group on subscription
+func (b *Broker) NewConsumer(cfg config.Consumer) (*Consumer, error) {
+	if cfg.GroupID == "" {
+		return nil, fmt.Errorf("fake consumer needs a group id")
+	}
+	return &Consumer{
+		broker:     b,
+		groupID:    cfg.GroupID,
+		autoCommit: cfg.EnableAutoCommit,
+		reset:      cfg.OffsetReset,
+	}, nil
+}
+
+func samePartitions(a, b []partition) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func topicPartitions(partitions []partition) []kafka.TopicPartition {
+	tps := make([]kafka.TopicPartition, 0, len(partitions))
+	for _, p := range partitions {
+		tps = append(tps, p.topicPartition(kafka.OffsetInvalid))
+	}
+	return tps
+}
@@ -0,0 +1,71 @@
+package fake_test
+
+import (
+	"context"
+	"math/rand"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gojek/kafqa/callback"
+	"github.com/gojek/kafqa/config"
+	"github.com/gojek/kafqa/consumer"
+	"github.com/gojek/kafqa/creator"
+	"github.com/gojek/kafqa/fake"
+	"github.com/gojek/kafqa/logger"
+	"github.com/gojek/kafqa/producer"
+	"github.com/gojek/kafqa/reporter"
+	"github.com/gojek/kafqa/serde"
+	"github.com/gojek/kafqa/store"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestShouldDetectDroppedMessagesAsLost runs producer, handler, store and consumer against the fake broker
+func TestShouldDetectDroppedMessagesAsLost(t *testing.T) {
+	logger.Setup("none")
+	const total, seed, dropRate = 200, 42, 0.1
+	// the dispatcher draws once per message for drops, so the lost count follows from the seed
+	rnd, dropped := rand.New(rand.NewSource(seed)), int64(0)
+	for i := 0; i < total; i++ {
+		if rnd.Float64() < dropRate {
+			dropped++
+		}
+	}
+	broker := fake.NewBroker(config.FakeBroker{Partitions: 3, DropRate: dropRate, Seed: seed})
+	parser := serde.KafqaParser{}
+	ms := store.NewInMemory(func(t store.Trace) string { return t.Message.ID })
+
+	var consWg sync.WaitGroup
+	cons, err := consumer.New(config.Consumer{Topic: "kafqa_test", Concurrency: 2, GroupID: "kafqa", OffsetReset: "earliest",
+		EnableAutoCommit: true, CommitStrategy: "sync", PollTimeoutMs: 50, CallbackWorkers: 2, CallbackQueueSize: 100},
+		consumer.Register(callback.Acker(ms, parser)),
+		consumer.WaitGroup(&consWg),
+		consumer.Clients(func(cfg config.Consumer) (consumer.Client, error) { return broker.NewConsumer(cfg) }))
+	require.NoError(t, err)
+
+	prodCfg := config.Producer{Topic: "kafqa_test", TotalMessages: total, Concurrency: 4, FlushTimeoutMs: 2000}
+	prod, err := producer.New(prodCfg, creator.New(), parser, producer.KafkaProducer(broker.NewProducer(prodCfg)))
+	require.NoError(t, err)
+	var wg sync.WaitGroup
+	wg.Add(1)
+	handler := producer.NewHandler(prod.Events(), &wg, ms, parser, reporter.LibrdTags{}, false)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cons.Run(ctx)
+	prod.Run(ctx)
+	go handler.Handle()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) && ms.Result().Acknowledged < total-dropped {
+		time.Sleep(10 * time.Millisecond)
+	}
+	cancel()
+	prod.Close()
+	wg.Wait()
+	cons.Close()
+
+	res := ms.Result()
+	assert.Equal(t, int64(total), res.Tracked)
+	assert.Equal(t, dropped, res.Tracked-res.Acknowledged)
+}
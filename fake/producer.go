@@ -0,0 +1,209 @@
+package fake
+
+import (
+	"math/rand"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gojek/kafqa/config"
+	"gopkg.in/confluentinc/confluent-kafka-go.v1/kafka"
+)
+
+// a message held back is appended after the next one produced within the window
+const reorderWindow = 100 * time.Millisecond
+
+// Producer appends to the fake broker in the order produced, from a single dispatcher
+// so the faults drawn are reproducible with a seed
+type Producer struct {
+	broker   *Broker
+	cfg      config.FakeBroker
+	rnd      *rand.Rand
+	queue    chan pending
+	events   chan kafka.Event
+	produced chan *kafka.Message
+	// produced but not yet delivered
+	inFlight   int64
+	mu         sync.RWMutex
+	closed     bool
+	dispatched chan struct{}
+	partitions map[string]uint32
+}
+
+type pending struct {
+	msg          *kafka.Message
+	deliveryChan chan kafka.Event
+	due          time.Time
+}
+
+// Produce queues the message, it fails when the queue (queue.buffering.max.messages) is full
+func (p *Producer) Produce(msg *kafka.Message, deliveryChan chan kafka.Event) error {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	if p.closed {
+		return kafka.NewError(kafka.ErrState, "Local: Producer closed", false)
+	}
+	cp := *msg
+	atomic.AddInt64(&p.inFlight, 1)
+	select {
+	case p.queue <- pending{msg: &cp, deliveryChan: deliveryChan, due: time.Now().Add(p.cfg.Delay())}:
+		return nil
+	default:
+		atomic.AddInt64(&p.inFlight, -1)
+		return kafka.NewError(kafka.ErrQueueFull, "Local: Queue full", false)
+	}
+}
+
+// dispatch appends the queued messages when due, dropping, duplicating or holding back some of them
+func (p *Producer) dispatch() {
+	defer close(p.dispatched)
+	var held *pending
+	for {
+		var pm pending
+		var ok bool
+		if held == nil {
+			pm, ok = <-p.queue
+		} else {
+			select {
+			case pm, ok = <-p.queue:
+			case <-time.After(reorderWindow):
+				p.deliver(*held)
+				held = nil
+				continue
+			}
+		}
+		if !ok {
+			break
+		}
+		if wait := time.Until(pm.due); wait > 0 {
+			time.Sleep(wait)
+		}
+		if held == nil && p.draw(p.cfg.ReorderRate) {
+			held = &pm
+			continue
+		}
+		p.deliver(pm)
+		if held != nil {
+			p.deliver(*held)
+			held = nil
+		}
+	}
+	if held != nil {
+		p.deliver(*held)
+	}
+}
+
+func (p *Producer) deliver(pm pending) {
+	defer atomic.AddInt64(&p.inFlight, -1)
+	msg := pm.msg
+	part, err := p.partition(msg)
+	if err == nil {
+		err = p.validate(msg)
+	}
+	if err == nil {
+		stored := msg
+		if p.draw(p.cfg.DropRate) {
+			// acknowledged but never readable, as a message lost on an unclean leader election
+			stored = nil
+		}
+		msg.TopicPartition.Offset, err = p.broker.append(part, stored)
+		if err == nil && stored != nil && p.draw(p.cfg.DuplicateRate) {
+			_, err = p.broker.append(part, stored)
+		}
+		msg.TopicPartition.Partition = part.id
+	}
+	msg.TopicPartition.Error = err
+	events := p.events
+	if pm.deliveryChan != nil {
+		events = pm.deliveryChan
+	}
+	events <- msg
+}
+
+func (p *Producer) partition(msg *kafka.Message) (partition, error) {
+	if msg.TopicPartition.Topic == nil {
+		return partition{}, kafka.NewError(kafka.ErrUnknownTopic, "Local: Unknown topic", false)
+	}
+	topic := *msg.TopicPartition.Topic
+	if msg.TopicPartition.Partition != kafka.PartitionAny {
+		return partition{topic, msg.TopicPartition.Partition}, nil
+	}
+	count := uint32(p.broker.partitionCount(topic))
+	id := p.partitions[topic] % count
+	p.partitions[topic]++
+	return partition{topic, int32(id)}, nil
+}
+
+func (p *Producer) validate(msg *kafka.Message) error {
+	size := len(msg.Key) + len(msg.Value)
+	for _, h := range msg.Headers {
+		size += len(h.Key) + len(h.Value)
+	}
+	if p.cfg.MaxMessageBytes > 0 && size > p.cfg.MaxMessageBytes {
+		return kafka.NewError(kafka.ErrMsgSizeTooLarge, "Broker: Message size too large", false)
+	}
+	return nil
+}
+
+func (p *Producer) draw(rate float64) bool {
+	return rate > 0 && p.rnd.Float64() < rate
+}
+
+// Flush waits for the queued messages to be delivered, returning the ones still in flight
+func (p *Producer) Flush(timeoutMs int) int {
+	deadline := time.Now().Add(time.Duration(timeoutMs) * time.Millisecond)
+	for {
+		n := int(atomic.LoadInt64(&p.inFlight))
+		if n == 0 || time.Now().After(deadline) {
+			return n
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func (p *Producer) Events() chan kafka.Event {
+	return p.events
+}
+
+// ProduceChannel is only reported on, messages are produced with Produce
+func (p *Producer) ProduceChannel() chan *kafka.Message {
+	return p.produced
+}
+
+// Close delivers the queued messages and closes the events channel
+func (p *Producer) Close() {
+	p.mu.Lock()
+	if p.closed {
+		p.mu.Unlock()
+		return
+	}
+	p.closed = true
+	close(p.queue)
+	p.mu.Unlock()
+	<-p.dispatched
+	close(p.events)
+}
+
+// NewProducer creates a producer, its queue is sized by queue.buffering.max.messages
+func (b *Broker) NewProducer(cfg config.Producer) *Producer {
+	queueSize := cfg.Librdconfigs.QueueBufferingMaxMessage
+	if queueSize <= 0 {
+		queueSize = 100000
+	}
+	seed := b.cfg.Seed
+	if seed == 0 {
+		seed = time.Now().UnixNano()
+	}
+	p := &Producer{
+		broker:     b,
+		cfg:        b.cfg,
+		rnd:        rand.New(rand.NewSource(seed)),
+		queue:      make(chan pending, queueSize),
+		events:     make(chan kafka.Event, queueSize),
+		produced:   make(chan *kafka.Message),
+		dispatched: make(chan struct{}),
+		partitions: make(map[string]uint32),
+	}
+	go p.dispatch()
+	return p
+}
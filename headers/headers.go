@@ -0,0 +1,151 @@
+package headers
+
+import (
+	"errors"
+	"fmt"
+	"math/rand"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/gojek/kafqa/checksum"
+	"github.com/gojek/kafqa/creator"
+	"gopkg.in/confluentinc/confluent-kafka-go.v1/kafka"
+)
+
+const (
+	ManifestKey = "kafqa-headers"
+	PaddingKey  = "kafqa-padding"
+)
+
+var ErrNotFound = errors.New("headers manifest not found")
+
+type template struct {
+	key   string
+	value string
+}
+
+type Generator struct {
+	templates    []template
+	runID        string
+	producerID   string
+	paddingBytes int
+}
+
+// Headers appends the configured headers for msg followed by a manifest of their keys and checksum
+func (g *Generator) Headers(msg creator.Message, msgHeaders []kafka.Header) []kafka.Header {
+	replacer := strings.NewReplacer(
+		"{run_id}", g.runID,
+		"{producer_id}", g.producerID,
+		"{sequence}", strconv.FormatUint(msg.Sequence, 10),
+		"{message_id}", msg.ID,
+	)
+	custom := make([]kafka.Header, 0, len(g.templates)+1)
+	for _, t := range g.templates {
+		custom = append(custom, kafka.Header{Key: t.key, Value: []byte(replacer.Replace(t.value))})
+	}
+	if g.paddingBytes > 0 {
+		padding := make([]byte, rand.Intn(g.paddingBytes+1))
+		rand.Read(padding)
+		custom = append(custom, kafka.Header{Key: PaddingKey, Value: padding})
+	}
+	msgHeaders = append(msgHeaders, custom...)
+	return append(msgHeaders, kafka.Header{Key: ManifestKey, Value: []byte(manifest(custom))})
+}
+
+// Verify checks the headers listed in the manifest arrived intact and in order
+func Verify(msg *kafka.Message) error {
+	expected, found := find(msg.Headers)
+	if !found {
+		return ErrNotFound
+	}
+	keys, sum, err := parseManifest(expected)
+	if err != nil {
+		return err
+	}
+	wanted := make(map[string]bool, len(keys))
+	for _, k := range keys {
+		wanted[k] = true
+	}
+	var received []kafka.Header
+	for _, h := range msg.Headers {
+		if wanted[h.Key] {
+			received = append(received, h)
+		}
+	}
+	if len(received) != len(keys) {
+		return fmt.Errorf("expected %d headers, received %d", len(keys), len(received))
+	}
+	for i, h := range received {
+		if h.Key != keys[i] {
+			return fmt.Errorf("header %s received at position %d, expected %s", h.Key, i, keys[i])
+		}
+	}
+	if checksum.Sum(serialize(received)) != sum {
+		return errors.New("header values modified")
+	}
+	return nil
+}
+
+func manifest(hs []kafka.Header) string {
+	keys := make([]string, 0, len(hs))
+	for _, h := range hs {
+		keys = append(keys, h.Key)
+	}
+	return fmt.Sprintf("%s;%d", strings.Join(keys, ","), checksum.Sum(serialize(hs)))
+}
+
+func parseManifest(value []byte) ([]string, uint32, error) {
+	parts := strings.Split(string(value), ";")
+	if len(parts) != 2 {
+		return nil, 0, fmt.Errorf("invalid headers manifest %q", value)
+	}
+	sum, err := strconv.ParseUint(parts[1], 10, 32)
+	if err != nil {
+		return nil, 0, fmt.Errorf("invalid headers manifest %q: %v", value, err)
+	}
+	var keys []string
+	if parts[0] != "" {
+		keys = strings.Split(parts[0], ",")
+	}
+	return keys, uint32(sum), nil
+}
+
+func serialize(hs []kafka.Header) []byte {
+	var data []byte
+	for _, h := range hs {
+		data = append(data, h.Key...)
+		data = append(data, 0)
+		data = append(data, h.Value...)
+		data = append(data, 0)
+	}
+	return data
+}
+
+func find(hs []kafka.Header) ([]byte, bool) {
+	for _, h := range hs {
+		if h.Key == ManifestKey {
+			return h.Value, true
+		}
+	}
+	return nil, false
+}
+
+func NewGenerator(static map[string]string, runID, producerID string, paddingBytes int) *Generator {
+	keys := make([]string, 0, len(static))
+	for k := range static {
+		keys = append(keys, k)
+	}
+	// map iteration is random, keep headers in a stable order across messages
+	sort.Strings(keys)
+	templates := make([]template, 0, len(keys))
+	for _, k := range keys {
+		templates = append(templates, template{key: k, value: static[k]})
+	}
+	return &Generator{
+		templates:    templates,
+		runID:        runID,
+		producerID:   producerID,
+		paddingBytes: paddingBytes,
+	}
+}
@@ -0,0 +1,66 @@
+package headers
+
+import (
+	"testing"
+
+	"github.com/gojek/kafqa/creator"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gopkg.in/confluentinc/confluent-kafka-go.v1/kafka"
+)
+
+func generate(paddingBytes int) []kafka.Header {
+	static := map[string]string{"run": "{run_id}", "seq": "{sequence}", "app": "kafqa", "producer": "{producer_id}"}
+	g := NewGenerator(static, "run-1", "pod-1", paddingBytes)
+	return g.Headers(creator.Message{Sequence: 42, ID: "id"}, nil)
+}
+
+func TestShouldRenderTemplatedHeadersInOrder(t *testing.T) {
+	hs := generate(0)
+
+	require.Len(t, hs, 5)
+	assert.Equal(t, kafka.Header{Key: "app", Value: []byte("kafqa")}, hs[0])
+	assert.Equal(t, kafka.Header{Key: "producer", Value: []byte("pod-1")}, hs[1])
+	assert.Equal(t, kafka.Header{Key: "run", Value: []byte("run-1")}, hs[2])
+	assert.Equal(t, kafka.Header{Key: "seq", Value: []byte("42")}, hs[3])
+	assert.Equal(t, ManifestKey, hs[4].Key)
+}
+
+func TestShouldAddPaddingHeader(t *testing.T) {
+	hs := generate(100)
+
+	require.Len(t, hs, 6)
+	assert.Equal(t, PaddingKey, hs[4].Key)
+	assert.True(t, len(hs[4].Value) <= 100)
+}
+
+func TestShouldVerifyIntactHeaders(t *testing.T) {
+	hs := append(generate(10), kafka.Header{Key: "uber-trace-id", Value: []byte("trace")})
+
+	assert.NoError(t, Verify(&kafka.Message{Headers: hs}))
+}
+
+func TestShouldFailVerificationWhenHeaderDropped(t *testing.T) {
+	hs := generate(0)
+	hs = append(hs[:1], hs[2:]...)
+
+	assert.EqualError(t, Verify(&kafka.Message{Headers: hs}), "expected 4 headers, received 3")
+}
+
+func TestShouldFailVerificationWhenHeadersReordered(t *testing.T) {
+	hs := generate(0)
+	hs[0], hs[1] = hs[1], hs[0]
+
+	assert.EqualError(t, Verify(&kafka.Message{Headers: hs}), "header producer received at position 0, expected app")
+}
+
+func TestShouldFailVerificationWhenHeaderModified(t *testing.T) {
+	hs := generate(0)
+	hs[3].Value = []byte("43")
+
+	assert.EqualError(t, Verify(&kafka.Message{Headers: hs}), "header values modified")
+}
+
+func TestShouldReturnNotFoundWithoutManifest(t *testing.T) {
+	assert.Equal(t, ErrNotFound, Verify(&kafka.Message{}))
+}
@@ -0,0 +1,255 @@
+package mirror
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/gojek/kafqa/callback"
+	"github.com/gojek/kafqa/config"
+	"github.com/gojek/kafqa/creator"
+	"github.com/gojek/kafqa/logger"
+	"github.com/gojek/kafqa/reporter"
+	"github.com/gojek/kafqa/reporter/metrics"
+	"github.com/gojek/kafqa/serde"
+	"gopkg.in/confluentinc/confluent-kafka-go.v1/kafka"
+)
+
+type partition struct {
+	topic string
+	id    int32
+}
+
+type delivery struct {
+	partition
+	// appended to the source partition
+	at time.Time
+}
+
+// consumption of a message from the mirror, by the source partition it was mirrored from
+type consumption struct {
+	partition
+	at time.Time
+}
+
+type stats struct {
+	delivered  int64
+	mirrored   int64
+	duplicates int64
+	maxLag     time.Duration
+	totalLag   time.Duration
+}
+
+// Tracker measures the replication lag and loss of the produced messages by source partition,
+// from their append to the source cluster until they're consumed from the mirrored topic.
+// Messages consumed from the mirror without a delivery report within the delivery timeout were already
+// mirrored or not produced by this run, they're counted as duplicates.
+type Tracker struct {
+	mu      sync.Mutex
+	cfg     config.Mirror
+	decoder serde.Decoder
+	// source topics by mirrored topic
+	sources map[string]string
+	// delivered messages not yet consumed from the mirror, by message id
+	pending map[string]delivery
+	// messages consumed from the mirror before their delivery report was handled, by message id
+	early map[string]consumption
+	// ids of the early messages in the order they were consumed, to evict them past the delivery timeout
+	earlyOrder []string
+	partitions map[partition]*stats
+}
+
+// Delivered is called with the messages delivered to the source cluster
+func (t *Tracker) Delivered() callback.Callback {
+	return func(msg *kafka.Message) {
+		message, ok := t.decode(msg)
+		if !ok || msg.TopicPartition.Topic == nil {
+			return
+		}
+		// the timestamp of the delivery report is the append time when the topic uses log append time
+		appended := msg.Timestamp
+		if appended.IsZero() {
+			appended = message.CreatedTime
+		}
+		d := delivery{partition{*msg.TopicPartition.Topic, msg.TopicPartition.Partition}, appended}
+		t.mu.Lock()
+		defer t.mu.Unlock()
+		t.stats(d.partition).delivered++
+		if c, ok := t.early[message.ID]; ok {
+			delete(t.early, message.ID)
+			t.mirrored(d.partition, c.at.Sub(d.at))
+			return
+		}
+		t.pending[message.ID] = d
+	}
+}
+
+// Mirrored is called with the messages consumed from the mirrored topics
+func (t *Tracker) Mirrored() callback.Callback {
+	return func(msg *kafka.Message) {
+		message, ok := t.decode(msg)
+		if !ok {
+			return
+		}
+		now := time.Now()
+		t.mu.Lock()
+		defer t.mu.Unlock()
+		t.evict(now)
+		d, ok := t.pending[message.ID]
+		if ok {
+			delete(t.pending, message.ID)
+			t.mirrored(d.partition, now.Sub(d.at))
+			return
+		}
+		source := t.source(msg.TopicPartition)
+		if _, ok := t.early[message.ID]; ok {
+			t.stats(source).duplicates++
+			return
+		}
+		t.early[message.ID] = consumption{source, now}
+		t.earlyOrder = append(t.earlyOrder, message.ID)
+	}
+}
+
+// evict counts the early messages without a delivery report within the delivery timeout as duplicates
+func (t *Tracker) evict(now time.Time) {
+	evicted := 0
+	for _, id := range t.earlyOrder {
+		c, ok := t.early[id]
+		if ok && now.Sub(c.at) < t.cfg.DeliveryTimeout() {
+			break
+		}
+		evicted++
+		if ok {
+			delete(t.early, id)
+			t.stats(c.partition).duplicates++
+		}
+	}
+	t.earlyOrder = t.earlyOrder[evicted:]
+}
+
+// source is the source partition of a mirrored one, the partitions are preserved by the mirror
+func (t *Tracker) source(tp kafka.TopicPartition) partition {
+	p := partition{id: tp.Partition}
+	if tp.Topic != nil {
+		p.topic = *tp.Topic
+		if source, ok := t.sources[p.topic]; ok {
+			p.topic = source
+		}
+	}
+	return p
+}
+
+func (t *Tracker) mirrored(p partition, lag time.Duration) {
+	if lag < 0 {
+		lag = 0
+	}
+	s := t.stats(p)
+	s.mirrored++
+	s.totalLag += lag
+	if lag > s.maxLag {
+		s.maxLag = lag
+	}
+	metrics.MirrorLag(p.topic, p.id, lag)
+}
+
+func (t *Tracker) stats(p partition) *stats {
+	s, ok := t.partitions[p]
+	if !ok {
+		s = &stats{}
+		t.partitions[p] = s
+	}
+	return s
+}
+
+func (t *Tracker) decode(msg *kafka.Message) (creator.Message, bool) {
+	message, err := t.decoder.FromBytes(msg.Value)
+	if err != nil {
+		logger.Debugf("unable to decode mirrored message: %v", err)
+		return creator.Message{}, false
+	}
+	return message, true
+}
+
+// SourceTopic runs the callback with the topic of the mirrored message renamed to its source,
+// so the store acknowledges the message under the topic it was tracked with
+func (t *Tracker) SourceTopic(cb callback.Callback) callback.Callback {
+	return func(msg *kafka.Message) {
+		if msg.TopicPartition.Topic == nil {
+			cb(msg)
+			return
+		}
+		source, ok := t.sources[*msg.TopicPartition.Topic]
+		if !ok {
+			cb(msg)
+			return
+		}
+		renamed := *msg
+		renamed.TopicPartition.Topic = &source
+		cb(&renamed)
+	}
+}
+
+// Report lists the source partitions, messages still pending are lost and the ones
+// consumed from the mirror without a delivery report are duplicates
+func (t *Tracker) Report() *reporter.MirrorReport {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for _, c := range t.early {
+		t.stats(c.partition).duplicates++
+	}
+	t.early, t.earlyOrder = make(map[string]consumption), nil
+	report := &reporter.MirrorReport{}
+	for p, s := range t.partitions {
+		mp := reporter.MirrorPartition{
+			SourceTopic: p.topic,
+			TargetTopic: t.cfg.Target(p.topic),
+			Partition:   p.id,
+			Delivered:   s.delivered,
+			Mirrored:    s.mirrored,
+			Lost:        s.delivered - s.mirrored,
+			Duplicates:  s.duplicates,
+			MaxLagMs:    int64(s.maxLag / time.Millisecond),
+		}
+		if s.mirrored > 0 {
+			mp.AvgLagMs = int64(s.totalLag / time.Duration(s.mirrored) / time.Millisecond)
+		}
+		report.Partitions = append(report.Partitions, mp)
+	}
+	sort.Slice(report.Partitions, func(i, j int) bool {
+		a, b := report.Partitions[i], report.Partitions[j]
+		if a.SourceTopic != b.SourceTopic {
+			return a.SourceTopic < b.SourceTopic
+		}
+		return a.Partition < b.Partition
+	})
+	return report
+}
+
+// Targets are the mirrored topics to consume
+func (t *Tracker) Targets() []string {
+	var targets []string
+	for target := range t.sources {
+		targets = append(targets, target)
+	}
+	sort.Strings(targets)
+	return targets
+}
+
+func New(cfg config.Mirror, sources []string, decoder serde.Decoder) *Tracker {
+	if cfg.DeliveryTimeoutMs <= 0 {
+		cfg.DeliveryTimeoutMs = 30000
+	}
+	t := &Tracker{
+		cfg:        cfg,
+		decoder:    decoder,
+		sources:    make(map[string]string, len(sources)),
+		pending:    make(map[string]delivery),
+		early:      make(map[string]consumption),
+		partitions: make(map[partition]*stats),
+	}
+	for _, source := range sources {
+		t.sources[cfg.Target(source)] = source
+	}
+	return t
+}
@@ -0,0 +1,108 @@
+package mirror
+
+import (
+	"testing"
+	"time"
+
+	"github.com/gojek/kafqa/config"
+	"github.com/gojek/kafqa/creator"
+	"github.com/gojek/kafqa/serde"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gopkg.in/confluentinc/confluent-kafka-go.v1/kafka"
+)
+
+func message(t *testing.T, topic string, partition int32, id string) *kafka.Message {
+	value, err := serde.KafqaParser{}.Bytes(creator.Message{ID: id})
+	require.NoError(t, err)
+	return &kafka.Message{TopicPartition: kafka.TopicPartition{Topic: &topic, Partition: partition}, Value: value}
+}
+
+func TestShouldConsumeMirroredTopics(t *testing.T) {
+	cfg := config.Mirror{TopicPrefix: "source.", Topics: map[string]string{"orders": "orders_mirror"}}
+
+	tracker := New(cfg, []string{"orders", "payments"}, serde.KafqaParser{})
+
+	assert.Equal(t, []string{"orders_mirror", "source.payments"}, tracker.Targets())
+}
+
+func TestShouldReportMirroredAndLostMessagesBySourcePartition(t *testing.T) {
+	tracker := New(config.Mirror{TopicPrefix: "source."}, []string{"orders"}, serde.KafqaParser{})
+	delivered, mirrored := tracker.Delivered(), tracker.Mirrored()
+
+	delivered(message(t, "orders", 0, "1"))
+	delivered(message(t, "orders", 0, "2"))
+	delivered(message(t, "orders", 1, "3"))
+	mirrored(message(t, "source.orders", 2, "1"))
+	mirrored(message(t, "source.orders", 1, "3"))
+
+	report := tracker.Report()
+	require.Len(t, report.Partitions, 2)
+	assert.Equal(t, "source.orders", report.Partitions[0].TargetTopic)
+	assert.Equal(t, int32(0), report.Partitions[0].Partition)
+	assert.Equal(t, int64(2), report.Partitions[0].Delivered)
+	assert.Equal(t, int64(1), report.Partitions[0].Mirrored)
+	assert.Equal(t, int64(1), report.Partitions[0].Lost)
+	assert.Equal(t, int64(0), report.Partitions[1].Lost)
+}
+
+func TestShouldCountMessagesMirroredBeforeTheirDeliveryReport(t *testing.T) {
+	tracker := New(config.Mirror{TopicPrefix: "source."}, []string{"orders"}, serde.KafqaParser{})
+
+	tracker.Mirrored()(message(t, "source.orders", 0, "1"))
+	tracker.Delivered()(message(t, "orders", 0, "1"))
+
+	report := tracker.Report()
+	require.Len(t, report.Partitions, 1)
+	assert.Equal(t, int64(1), report.Partitions[0].Mirrored)
+	assert.Equal(t, int64(0), report.Partitions[0].Lost)
+}
+
+func TestShouldAckMirroredMessagesUnderTheirSourceTopic(t *testing.T) {
+	tracker := New(config.Mirror{TopicPrefix: "source."}, []string{"orders"}, serde.KafqaParser{})
+	msg := message(t, "source.orders", 0, "1")
+	var acked string
+
+	tracker.SourceTopic(func(m *kafka.Message) { acked = *m.TopicPartition.Topic })(msg)
+
+	assert.Equal(t, "orders", acked)
+	assert.Equal(t, "source.orders", *msg.TopicPartition.Topic)
+}
+
+func TestShouldMeasureLagFromTheAppendToTheSource(t *testing.T) {
+	tracker := New(config.Mirror{TopicPrefix: "source."}, []string{"orders"}, serde.KafqaParser{})
+	early, late := message(t, "orders", 0, "1"), message(t, "orders", 0, "2")
+	early.Timestamp = time.Now().Add(-2 * time.Second)
+	late.Timestamp = time.Now().Add(-time.Second)
+
+	tracker.Mirrored()(message(t, "source.orders", 0, "1"))
+	tracker.Delivered()(early)
+	tracker.Delivered()(late)
+	tracker.Mirrored()(message(t, "source.orders", 0, "2"))
+
+	report := tracker.Report()
+	require.Len(t, report.Partitions, 1)
+	assert.Equal(t, int64(2), report.Partitions[0].Mirrored)
+	assert.True(t, report.Partitions[0].MaxLagMs >= 2000)
+	assert.True(t, report.Partitions[0].AvgLagMs >= 1500)
+}
+
+func TestShouldCountMessagesMirroredWithoutDeliveryAsDuplicates(t *testing.T) {
+	tracker := New(config.Mirror{TopicPrefix: "source.", DeliveryTimeoutMs: 1}, []string{"orders"}, serde.KafqaParser{})
+	delivered, mirrored := tracker.Delivered(), tracker.Mirrored()
+
+	delivered(message(t, "orders", 0, "1"))
+	mirrored(message(t, "source.orders", 0, "1"))
+	mirrored(message(t, "source.orders", 0, "1"))
+	time.Sleep(5 * time.Millisecond)
+	mirrored(message(t, "source.orders", 0, "2"))
+	mirrored(message(t, "source.orders", 0, "2"))
+
+	assert.Len(t, tracker.early, 1)
+	report := tracker.Report()
+	require.Len(t, report.Partitions, 1)
+	assert.Equal(t, int64(1), report.Partitions[0].Mirrored)
+	assert.Equal(t, int64(3), report.Partitions[0].Duplicates)
+	assert.Equal(t, int64(0), report.Partitions[0].Lost)
+	assert.Empty(t, tracker.early)
+}
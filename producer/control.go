@@ -0,0 +1,127 @@
+package producer
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/gojek/kafqa/reporter/metrics"
+)
+
+// control adjusts a running producer, its workers wait on it before producing every message
+type control struct {
+	mu sync.Mutex
+	// context of the run, workers are started from it
+	ctx     context.Context
+	workers []context.CancelFunc
+	// closed on resume, nil when not paused
+	resumed chan struct{}
+	rate    int
+	// time the next message is due at when the rate is limited
+	next time.Time
+}
+
+// wait blocks while paused and until the next message is due, it's false once the context is done
+func (c *control) wait(ctx context.Context) bool {
+	c.mu.Lock()
+	resumed := c.resumed
+	c.mu.Unlock()
+	if resumed != nil {
+		select {
+		case <-resumed:
+		case <-ctx.Done():
+			return false
+		}
+	}
+	delay := c.reserve()
+	if delay <= 0 {
+		return ctx.Err() == nil
+	}
+	select {
+	case <-time.After(delay):
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+// reserve takes the next slot at the rate, returning how long until it's due
+func (c *control) reserve() time.Duration {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.rate <= 0 {
+		return 0
+	}
+	now := time.Now()
+	if c.next.Before(now) {
+		c.next = now
+	}
+	due := c.next
+	c.next = c.next.Add(time.Second / time.Duration(c.rate))
+	return due.Sub(now)
+}
+
+// Pause holds the workers before their next message until resumed
+func (p Producer) Pause() {
+	p.control.mu.Lock()
+	defer p.control.mu.Unlock()
+	if p.control.resumed == nil {
+		p.control.resumed = make(chan struct{})
+	}
+}
+
+func (p Producer) Resume() {
+	p.control.mu.Lock()
+	defer p.control.mu.Unlock()
+	if p.control.resumed != nil {
+		close(p.control.resumed)
+		p.control.resumed = nil
+	}
+}
+
+func (p Producer) Paused() bool {
+	p.control.mu.Lock()
+	defer p.control.mu.Unlock()
+	return p.control.resumed != nil
+}
+
+// SetRate limits the messages produced per second across the workers, 0 doesn't limit
+func (p Producer) SetRate(rate int) {
+	p.control.mu.Lock()
+	defer p.control.mu.Unlock()
+	p.control.rate = rate
+	p.control.next = time.Time{}
+}
+
+func (p Producer) Rate() int {
+	p.control.mu.Lock()
+	defer p.control.mu.Unlock()
+	return p.control.rate
+}
+
+// SetConcurrency starts or stops workers to have n of them producing, stopped workers finish their message
+func (p Producer) SetConcurrency(n int) {
+	p.control.mu.Lock()
+	defer p.control.mu.Unlock()
+	if p.control.ctx == nil || p.control.ctx.Err() != nil {
+		return
+	}
+	for len(p.control.workers) < n {
+		ctx, cancel := context.WithCancel(p.control.ctx)
+		p.control.workers = append(p.control.workers, cancel)
+		p.wg.Add(1)
+		go p.ProduceWorker(ctx)
+		metrics.ProducerCount()
+	}
+	for len(p.control.workers) > n && len(p.control.workers) > 0 {
+		last := len(p.control.workers) - 1
+		p.control.workers[last]()
+		p.control.workers = p.control.workers[:last]
+	}
+}
+
+func (p Producer) Concurrency() int {
+	p.control.mu.Lock()
+	defer p.control.mu.Unlock()
+	return len(p.control.workers)
+}
@@ -0,0 +1,51 @@
+package producer
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestShouldSpaceMessagesAtTheRate(t *testing.T) {
+	c := &control{rate: 100}
+
+	first, second, third := c.reserve(), c.reserve(), c.reserve()
+
+	assert.Equal(t, time.Duration(0), first)
+	assert.InDelta(t, float64(10*time.Millisecond), float64(second), float64(2*time.Millisecond))
+	assert.InDelta(t, float64(20*time.Millisecond), float64(third), float64(2*time.Millisecond))
+}
+
+func TestShouldNotWaitWithoutRate(t *testing.T) {
+	c := &control{}
+
+	assert.True(t, c.wait(context.Background()))
+	assert.Equal(t, time.Duration(0), c.reserve())
+}
+
+func TestShouldStopWaitingWhenPausedRunIsDone(t *testing.T) {
+	p := Producer{control: &control{}}
+	p.Pause()
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	assert.False(t, p.control.wait(ctx))
+}
+
+func TestShouldStartAndStopWorkers(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	p := Producer{control: &control{ctx: ctx}, wg: &sync.WaitGroup{}}
+
+	p.SetConcurrency(3)
+	assert.Equal(t, 3, p.Concurrency())
+	p.SetConcurrency(1)
+	assert.Equal(t, 1, p.Concurrency())
+	p.SetConcurrency(0)
+
+	p.wg.Wait()
+	assert.Equal(t, 0, p.Concurrency())
+}
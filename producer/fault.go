@@ -0,0 +1,120 @@
+package producer
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"time"
+
+	"github.com/gojek/kafqa/config"
+	"github.com/gojek/kafqa/logger"
+	"github.com/gojek/kafqa/reporter"
+	"github.com/gojek/kafqa/reporter/metrics"
+	"gopkg.in/confluentinc/confluent-kafka-go.v1/kafka"
+)
+
+const (
+	// FaultKey is the header of the messages produced with an injected fault
+	FaultKey        = "kafqa-fault"
+	faultPaddingKey = "kafqa-fault-padding"
+
+	oversizedFault        = "oversized"
+	invalidPartitionFault = "invalid_partition"
+	burstFault            = "burst"
+
+	// beyond the partitions of any topic
+	invalidPartition int32 = 1 << 20
+)
+
+// faults marks a share of the produced messages to fail, the fault is kept in a header
+// so the errors surfaced for it can be told apart from genuine failures
+type faults struct {
+	oversizedRate        float64
+	oversizedBytes       int
+	invalidPartitionRate float64
+}
+
+func (f faults) inject(msg *kafka.Message) string {
+	switch {
+	case f.oversizedRate > 0 && rand.Float64() < f.oversizedRate:
+		msg.Headers = append(msg.Headers, kafka.Header{Key: faultPaddingKey, Value: make([]byte, f.oversizedBytes)})
+		return markFault(msg, oversizedFault)
+	case f.invalidPartitionRate > 0 && rand.Float64() < f.invalidPartitionRate:
+		msg.TopicPartition.Partition = invalidPartition
+		return markFault(msg, invalidPartitionFault)
+	}
+	return ""
+}
+
+func markFault(msg *kafka.Message, fault string) string {
+	msg.Headers = append(msg.Headers, kafka.Header{Key: FaultKey, Value: []byte(fault)})
+	return fault
+}
+
+// faultOf returns the fault injected in the message, empty if none
+func faultOf(msg *kafka.Message) string {
+	for _, h := range msg.Headers {
+		if h.Key == FaultKey {
+			return string(h.Value)
+		}
+	}
+	return ""
+}
+
+func newFaults(cfg config.Producer) (faults, error) {
+	for name, rate := range map[string]float64{"oversized": cfg.FaultOversizedRate, "invalid partition": cfg.FaultInvalidPartitionRate} {
+		if rate < 0 || rate > 1 {
+			return faults{}, fmt.Errorf("invalid fault %s rate %v, expected between 0 and 1", name, rate)
+		}
+	}
+	return faults{
+		oversizedRate:        cfg.FaultOversizedRate,
+		oversizedBytes:       cfg.FaultOversizedBytes,
+		invalidPartitionRate: cfg.FaultInvalidPartitionRate,
+	}, nil
+}
+
+// runBursts takes a burst of the pending messages every interval and produces them at once,
+// skipping the worker delay, to overflow the producer queue
+func (p Producer) runBursts(ctx context.Context) {
+	defer p.wg.Done()
+	ticker := time.NewTicker(p.config.FaultBurstInterval())
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			logger.Infof("injecting burst of %d messages", p.config.FaultBurstSize)
+			for i := 0; i < p.config.FaultBurstSize; i++ {
+				select {
+				case msg, ok := <-p.messages:
+					if !ok {
+						return
+					}
+					p.produce(ctx, msg, burstFault)
+				case <-ctx.Done():
+					return
+				}
+			}
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// produceError records an error surfaced synchronously by produce or by the delivery report
+func produceError(fault string, err error) {
+	if fault == "" {
+		fault = reporter.NoFault
+	}
+	code := errorCode(err)
+	metrics.ProduceError(fault, code)
+	reporter.ProduceError(fault, code)
+}
+
+// errorCode is the kafka error code the errors are grouped by
+func errorCode(err error) string {
+	if kerr, ok := err.(kafka.Error); ok {
+		return kerr.Code().String()
+	}
+	return err.Error()
+}
@@ -0,0 +1,82 @@
+package producer
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+
+	"github.com/gojek/kafqa/config"
+	"github.com/gojek/kafqa/creator"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"gopkg.in/confluentinc/confluent-kafka-go.v1/kafka"
+)
+
+func TestShouldPadOversizedMessages(t *testing.T) {
+	msg := &kafka.Message{}
+
+	fault := faults{oversizedRate: 1, oversizedBytes: 2048}.inject(msg)
+
+	assert.Equal(t, oversizedFault, fault)
+	assert.Equal(t, oversizedFault, faultOf(msg))
+	require.Len(t, msg.Headers, 2)
+	assert.Len(t, msg.Headers[0].Value, 2048)
+}
+
+func TestShouldProduceToInvalidPartition(t *testing.T) {
+	msg := &kafka.Message{TopicPartition: kafka.TopicPartition{Partition: kafka.PartitionAny}}
+
+	fault := faults{invalidPartitionRate: 1}.inject(msg)
+
+	assert.Equal(t, invalidPartitionFault, fault)
+	assert.Equal(t, invalidPartition, msg.TopicPartition.Partition)
+}
+
+func TestShouldNotInjectFaultsByDefault(t *testing.T) {
+	f, err := newFaults(config.Producer{FaultOversizedBytes: 2000000})
+	require.NoError(t, err)
+	msg := &kafka.Message{}
+
+	assert.Empty(t, f.inject(msg))
+	assert.Empty(t, faultOf(msg))
+	assert.Empty(t, msg.Headers)
+}
+
+func TestShouldFailInvalidFaultRates(t *testing.T) {
+	_, err := newFaults(config.Producer{FaultOversizedRate: 2})
+	assert.Error(t, err)
+
+	_, err = newFaults(config.Producer{FaultInvalidPartitionRate: -0.5})
+	assert.Error(t, err)
+}
+
+func TestShouldGroupErrorsByKafkaCode(t *testing.T) {
+	assert.Equal(t, kafka.ErrMsgSizeTooLarge.String(), errorCode(kafka.NewError(kafka.ErrMsgSizeTooLarge, "too large", false)))
+	assert.Equal(t, "closed", errorCode(errors.New("closed")))
+}
+
+func (s *ProducerSuite) TestShouldProduceBurstsWithoutWorkerDelay() {
+	t := s.T()
+	produced := make(chan *kafka.Message, 10)
+	var events chan kafka.Event
+	s.kp.config = config.Producer{FaultBurstIntervalMs: 1, FaultBurstSize: 3}
+	s.kafkaProducer.On("Produce", mock.AnythingOfType("*kafka.Message"), events).Return(nil).Run(func(args mock.Arguments) {
+		produced <- args.Get(0).(*kafka.Message)
+	}).Times(3)
+	for i := 0; i < 3; i++ {
+		s.kp.messages <- creator.Message{}
+	}
+	close(s.kp.messages)
+	s.kp.wg = &sync.WaitGroup{}
+
+	s.kp.wg.Add(1)
+	s.kp.runBursts(context.Background())
+
+	require.Len(t, produced, 3)
+	for i := 0; i < 3; i++ {
+		assert.Equal(t, burstFault, faultOf(<-produced))
+	}
+	s.kafkaProducer.AssertExpectations(t)
+}
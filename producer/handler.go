@@ -3,6 +3,7 @@ package producer
 import (
 	"sync"
 
+	"github.com/gojek/kafqa/callback"
 	"github.com/gojek/kafqa/serde"
 
 	"github.com/gojek/kafqa/reporter"
@@ -19,6 +20,13 @@ type Handler struct {
 	librdStatsHandler reporter.LibrdKafkaStatsHandler
 	decoder           serde.Decoder
 	librdStatsEnabled bool
+	// called with the messages delivered
+	callbacks []callback.Callback
+}
+
+// Register adds a callback called with every message delivered to the broker
+func (h *Handler) Register(cb callback.Callback) {
+	h.callbacks = append(h.callbacks, cb)
 }
 
 func (h *Handler) Handle() {
@@ -43,6 +51,7 @@ func (h *Handler) handleKafkaMessage(ev *kafka.Message) {
 	// span := tracer.StartSpanFromMessage("kafqa.handler", ev)
 	if ev.TopicPartition.Error != nil {
 		logger.Debugf("Delivery failed: %v", ev.TopicPartition)
+		produceError(faultOf(ev), ev.TopicPartition.Error)
 	} else {
 		msg, err := h.decoder.FromBytes(ev.Value)
 		if err != nil {
@@ -53,6 +62,9 @@ func (h *Handler) handleKafkaMessage(ev *kafka.Message) {
 		if err != nil {
 			logger.Errorf("Couldn't track message: %v", ev.TopicPartition)
 		}
+		for _, cb := range h.callbacks {
+			cb(ev)
+		}
 	}
 	// span.Finish()
 
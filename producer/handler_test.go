@@ -36,6 +36,8 @@ func (s *HandlerSuite) SetupTest() {
 		config:        config.Producer{Topic: "sometopic", TotalMessages: 1000, Concurrency: 10},
 		wg:            &sync.WaitGroup{},
 		messages:      make(chan creator.Message, 1000),
+		topics:        &topicSelector{topics: []string{"sometopic"}, cumulative: []uint64{1}, total: 1},
+		control:       &control{},
 	}
 	s.msgStore = new(InMemoryStoreMock)
 	s.decoder = serde.KafqaParser{}
@@ -126,6 +128,27 @@ func (s *HandlerSuite) TestIfNoMsgsAreTracedIfEventTypeIsUnknown() {
 	s.msgCreator.AssertExpectations(t)
 }
 
+func (s *HandlerSuite) TestShouldNotTrackFailedDeliveries() {
+	t := s.T()
+	wg := &sync.WaitGroup{}
+	eventsCh := make(chan kafka.Event, 1)
+	deliveryHandler := Handler{wg: wg, events: eventsCh, msgStore: s.msgStore, decoder: s.decoder}
+	topic := "topic1"
+	failed := &kafka.Message{
+		TopicPartition: kafka.TopicPartition{Topic: &topic, Partition: invalidPartition,
+			Error: kafka.NewError(kafka.ErrUnknownPartition, "unknown partition", false)},
+	}
+	markFault(failed, invalidPartitionFault)
+
+	wg.Add(1)
+	eventsCh <- failed
+	close(eventsCh)
+	deliveryHandler.Handle()
+	wg.Wait()
+
+	s.msgStore.AssertNotCalled(t, "Track", mock.Anything)
+}
+
 func TestHandler(t *testing.T) {
 	suite.Run(t, new(HandlerSuite))
 }
@@ -7,6 +7,7 @@ import (
 
 	"github.com/gojek/kafqa/serde"
 
+	"github.com/gojek/kafqa/checksum"
 	"github.com/gojek/kafqa/creator"
 	"github.com/gojek/kafqa/tracer"
 	"github.com/opentracing/opentracing-go"
@@ -23,6 +24,10 @@ type msgCreator interface {
 	NewMessageWithFakeData() creator.Message
 }
 
+type headerGenerator interface {
+	Headers(creator.Message, []kafka.Header) []kafka.Header
+}
+
 type kafkaProducer interface {
 	Produce(*kafka.Message, chan kafka.Event) error
 	Flush(int) int
@@ -39,11 +44,19 @@ type Producer struct {
 	encoder   serde.Encoder
 	wg        *sync.WaitGroup
 	callbacks []callback.Callback
+	headers   headerGenerator
+	topics    *topicSelector
+	faults    faults
+	control   *control
 }
 
 func (p Producer) Run(ctx context.Context) {
 	go p.Poll(ctx)
-	go p.runProducers(ctx)
+	p.runProducers(ctx)
+	if p.config.FaultBurstInterval() > 0 && p.config.FaultBurstSize > 0 {
+		p.wg.Add(1)
+		go p.runBursts(ctx)
+	}
 	var i int64
 	logger.Debugf("started producing to chan....")
 
@@ -60,7 +73,13 @@ func (p Producer) Run(ctx context.Context) {
 				return
 			default:
 				msg := p.msgCreator.NewMessageWithFakeData()
-				p.messages <- msg
+				// workers may be paused or gone when the run is stopped
+				select {
+				case p.messages <- msg:
+				case <-ctx.Done():
+					span.Finish()
+					return
+				}
 			}
 			span.Finish()
 		}
@@ -81,17 +100,19 @@ func (p Producer) Close() error {
 }
 
 func (p Producer) runProducers(ctx context.Context) {
-	for i := 0; i < p.config.Concurrency; i++ {
-		logger.Debugf("running producer %d on brokers: %s for topic %s", i, p.config.KafkaBrokers, p.config.Topic)
-		go p.ProduceWorker(ctx)
-		metrics.ProducerCount()
-		p.wg.Add(1)
-	}
+	logger.Debugf("running %d producers on brokers: %s for topics %v", p.config.Concurrency, p.config.KafkaBrokers, p.config.TopicNames())
+	p.control.mu.Lock()
+	p.control.ctx = ctx
+	p.control.mu.Unlock()
+	p.SetConcurrency(p.config.Concurrency)
 }
 
 func (p Producer) ProduceWorker(ctx context.Context) {
 	defer p.wg.Done()
 	for {
+		if !p.control.wait(ctx) {
+			return
+		}
 		select {
 		case msg, ok := <-p.messages:
 			if !ok {
@@ -108,18 +129,35 @@ func (p Producer) ProduceWorker(ctx context.Context) {
 }
 
 func (p Producer) produceMessage(ctx context.Context, msg creator.Message) {
+	p.produce(ctx, msg, "")
+}
+
+// produce sends the message with the fault given, or one drawn from the configured faults
+func (p Producer) produce(ctx context.Context, msg creator.Message, fault string) {
 	span := tracer.StartChildSpan(ctx, "kafqa.produce.kafka")
 	defer span.Finish()
 
 	msg.CreatedTime = time.Now()
 	mbyte, _ := p.encoder.Bytes(msg)
 	kafkaMsg := kafka.Message{
-		TopicPartition: kafka.TopicPartition{Topic: &p.config.Topic, Partition: kafka.PartitionAny},
+		TopicPartition: kafka.TopicPartition{Topic: p.topics.Next(), Partition: kafka.PartitionAny},
 		Value:          mbyte,
 	}
+	if p.headers != nil {
+		kafkaMsg.Headers = p.headers.Headers(msg, kafkaMsg.Headers)
+	}
+	if p.config.ChecksumEnabled {
+		kafkaMsg.Headers = checksum.Headers(kafkaMsg.Value, kafkaMsg.Headers)
+	}
 	kafkaMsg.Headers = tracer.Headers(ctx, kafkaMsg.Headers)
+	if fault == "" {
+		fault = p.faults.inject(&kafkaMsg)
+	} else {
+		markFault(&kafkaMsg, fault)
+	}
 	if err := p.kafkaProducer.Produce(&kafkaMsg, nil); err != nil {
 		logger.Errorf("Error producing message to kafka: %v", err)
+		produceError(fault, err)
 	} else {
 		//TODO: introduce configured delay here
 		for _, cb := range p.callbacks {
@@ -134,24 +172,50 @@ func Register(cb callback.Callback) Option {
 	}
 }
 
+func HeaderGenerator(hg headerGenerator) Option {
+	return func(p *Producer) {
+		p.headers = hg
+	}
+}
+
+// KafkaProducer replaces the librdkafka producer, eg: with the fake broker
+func KafkaProducer(kp kafkaProducer) Option {
+	return func(p *Producer) {
+		p.kafkaProducer = kp
+	}
+}
+
 type Option func(*Producer)
 
 func New(prodCfg config.Producer, mc msgCreator, encoder serde.Encoder, opts ...Option) (*Producer, error) {
-	p, err := kafka.NewProducer(prodCfg.KafkaConfig())
+	topics, err := newTopicSelector(prodCfg.TopicWeights())
+	if err != nil {
+		return nil, err
+	}
+	faults, err := newFaults(prodCfg)
 	if err != nil {
 		return nil, err
 	}
 	producer := &Producer{
-		config:        prodCfg,
-		kafkaProducer: p,
-		messages:      make(chan creator.Message, 10000),
-		encoder:       encoder,
-		wg:            &sync.WaitGroup{},
-		msgCreator:    mc,
+		config:     prodCfg,
+		messages:   make(chan creator.Message, 10000),
+		encoder:    encoder,
+		wg:         &sync.WaitGroup{},
+		msgCreator: mc,
+		topics:     topics,
+		faults:     faults,
+		control:    &control{rate: prodCfg.Rate},
 	}
 	for _, opt := range opts {
 		opt(producer)
 	}
+	if producer.kafkaProducer == nil {
+		p, err := kafka.NewProducer(prodCfg.KafkaConfig())
+		if err != nil {
+			return nil, err
+		}
+		producer.kafkaProducer = p
+	}
 	return producer, nil
 }
 
@@ -10,11 +10,13 @@ import (
 	"github.com/gojek/kafqa/serde"
 
 	"github.com/gojek/kafqa/creator"
+	"github.com/gojek/kafqa/headers"
 	"github.com/gojek/kafqa/logger"
 
 	"github.com/gojek/kafqa/config"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
 	"github.com/stretchr/testify/suite"
 	"gopkg.in/confluentinc/confluent-kafka-go.v1/kafka"
 )
@@ -38,6 +40,8 @@ func (s *ProducerSuite) SetupTest() {
 		encoder:       serde.KafqaParser{},
 		wg:            &sync.WaitGroup{},
 		messages:      make(chan creator.Message, 1000),
+		topics:        &topicSelector{topics: []string{"sometopic"}, cumulative: []uint64{1}, total: 1},
+		control:       &control{},
 	}
 	s.encoder = serde.KafqaParser{}
 }
@@ -131,6 +135,31 @@ func (s *ProducerSuite) TestIfMessagesAreProducedInfinitely() {
 	s.creator.AssertExpectations(t)
 }
 
+func (s *ProducerSuite) TestShouldAttachGeneratedHeaders() {
+	t := s.T()
+	produced := make(chan *kafka.Message, 1)
+	var events chan kafka.Event
+	prodCh := make(chan *kafka.Message)
+	s.kp.config = config.Producer{TotalMessages: 1, Concurrency: 1, Topic: "sometopic"}
+	opt := HeaderGenerator(headers.NewGenerator(map[string]string{"seq": "{sequence}"}, "run", "producer", 0))
+	opt(&s.kp)
+	s.creator.On("NewMessageWithFakeData").Return(creator.Message{Sequence: 7}, nil).Times(1)
+	s.kafkaProducer.On("Produce", mock.AnythingOfType("*kafka.Message"), events).Return(nil).Run(func(args mock.Arguments) {
+		produced <- args.Get(0).(*kafka.Message)
+	}).Times(1)
+	s.kafkaProducer.On("Flush", 0).Return(0)
+	s.kafkaProducer.On("Close").Return()
+	s.kafkaProducer.On("ProduceChannel").Return(prodCh).Maybe()
+
+	s.kp.Run(context.Background())
+	msg := <-produced
+	s.kp.Close()
+
+	require.Len(t, msg.Headers, 2)
+	assert.Equal(t, kafka.Header{Key: "seq", Value: []byte("7")}, msg.Headers[0])
+	assert.NoError(t, headers.Verify(msg))
+}
+
 func TestProducer(t *testing.T) {
 	suite.Run(t, new(ProducerSuite))
 }
@@ -163,3 +192,50 @@ func (m *kafkaProducerMock) ProduceChannel() chan *kafka.Message {
 	args := m.Called()
 	return args.Get(0).(chan *kafka.Message)
 }
+
+func (s *ProducerSuite) TestShouldHoldWorkersWhilePaused() {
+	t := s.T()
+	produced := make(chan struct{}, 10)
+	prodCh := make(chan *kafka.Message)
+	var events chan kafka.Event
+	s.kp.config = config.Producer{TotalMessages: 5, Concurrency: 2, Topic: "sometopic"}
+	Register(func(*kafka.Message) { produced <- struct{}{} })(&s.kp)
+	s.kafkaProducer.On("Produce", mock.AnythingOfTypeArgument("*kafka.Message"), events).Return(nil)
+	s.kafkaProducer.On("Close").Return()
+	s.kafkaProducer.On("Flush", 0).Return(0)
+	s.kafkaProducer.On("ProduceChannel").Return(prodCh).Maybe()
+	s.creator.On("NewMessageWithFakeData").Return(creator.Message{}, nil)
+
+	s.kp.Pause()
+	s.kp.Run(context.Background())
+	select {
+	case <-produced:
+		t.Fatal("produced while paused")
+	case <-time.After(50 * time.Millisecond):
+	}
+	assert.True(t, s.kp.Paused())
+	assert.Equal(t, 2, s.kp.Concurrency())
+
+	s.kp.Resume()
+	for i := 0; i < 5; i++ {
+		<-produced
+	}
+	s.kp.Close()
+	s.kafkaProducer.AssertNumberOfCalls(t, "Produce", 5)
+}
+
+func (s *ProducerSuite) TestShouldChangeConcurrencyAsSoonAsRunReturns() {
+	t := s.T()
+	s.kp.config = config.Producer{TotalMessages: 0, Concurrency: 1, Topic: "sometopic"}
+	s.kafkaProducer.On("Close").Return()
+	s.kafkaProducer.On("Flush", 0).Return(0)
+	s.kafkaProducer.On("ProduceChannel").Return(make(chan *kafka.Message)).Maybe()
+	ctx, cancel := context.WithCancel(context.Background())
+
+	s.kp.Run(ctx)
+	s.kp.SetConcurrency(3)
+
+	assert.Equal(t, 3, s.kp.Concurrency())
+	cancel()
+	s.kp.Close()
+}
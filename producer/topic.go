@@ -0,0 +1,40 @@
+package producer
+
+import (
+	"errors"
+	"sort"
+	"sync/atomic"
+)
+
+// topicSelector spreads messages across topics in a weighted round robin
+type topicSelector struct {
+	topics     []string
+	cumulative []uint64
+	total      uint64
+	next       uint64
+}
+
+func (ts *topicSelector) Next() *string {
+	n := atomic.AddUint64(&ts.next, 1) % ts.total
+	i := sort.Search(len(ts.cumulative), func(i int) bool { return ts.cumulative[i] > n })
+	return &ts.topics[i]
+}
+
+func newTopicSelector(weights map[string]int) (*topicSelector, error) {
+	var topics []string
+	for t, w := range weights {
+		if w > 0 {
+			topics = append(topics, t)
+		}
+	}
+	if len(topics) == 0 {
+		return nil, errors.New("no topic with positive weight to produce")
+	}
+	sort.Strings(topics)
+	ts := &topicSelector{topics: topics}
+	for _, t := range topics {
+		ts.total += uint64(weights[t])
+		ts.cumulative = append(ts.cumulative, ts.total)
+	}
+	return ts, nil
+}
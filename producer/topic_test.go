@@ -0,0 +1,26 @@
+package producer
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestShouldSpreadMessagesByTopicWeight(t *testing.T) {
+	ts, err := newTopicSelector(map[string]int{"a": 3, "b": 1, "c": 0})
+	require.NoError(t, err)
+
+	counts := map[string]int{}
+	for i := 0; i < 400; i++ {
+		counts[*ts.Next()]++
+	}
+
+	assert.Equal(t, map[string]int{"a": 300, "b": 100}, counts)
+}
+
+func TestShouldFailWithoutPositiveWeights(t *testing.T) {
+	_, err := newTopicSelector(map[string]int{"a": 0})
+
+	assert.EqualError(t, err, "no topic with positive weight to produce")
+}
@@ -0,0 +1,194 @@
+package proxy
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/gojek/kafqa/logger"
+	"github.com/gojek/kafqa/reporter/metrics"
+)
+
+const (
+	// guards against reading garbage as a frame size
+	maxFrameBytes = 1 << 30
+	// frames read ahead of the writer, reads block beyond it
+	frameBuffer = 1000
+)
+
+type frame struct {
+	data []byte
+	due  time.Time
+}
+
+// connection is a client connection forwarded frame by frame to a broker
+type connection struct {
+	proxy    *Proxy
+	client   net.Conn
+	broker   net.Conn
+	mu       sync.Mutex
+	requests map[int32]request
+	closed   chan struct{}
+	once     sync.Once
+}
+
+func (c *connection) run() {
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go c.pipe(&wg, c.client, c.broker, c.trackRequest)
+	go c.pipe(&wg, c.broker, c.client, c.rewriteResponse)
+	wg.Wait()
+}
+
+// pipe forwards the frames read from src to dst after the injected latency
+func (c *connection) pipe(wg *sync.WaitGroup, src, dst net.Conn, handle func([]byte) ([]byte, error)) {
+	defer wg.Done()
+	frames := make(chan frame, frameBuffer)
+	written := make(chan struct{})
+	go c.write(dst, frames, written)
+	defer func() {
+		close(frames)
+		<-written
+		c.close()
+	}()
+	for {
+		data, err := readFrame(src)
+		if err != nil {
+			if err != io.EOF && !c.isClosed() {
+				logger.Debugf("proxy error reading from %v: %v", src.RemoteAddr(), err)
+			}
+			return
+		}
+		if c.proxy.resetDue() {
+			c.reset()
+			return
+		}
+		if data, err = handle(data); err != nil {
+			logger.Errorf("proxy error rewriting response from %v: %v", src.RemoteAddr(), err)
+			return
+		}
+		select {
+		case frames <- frame{data: data, due: time.Now().Add(c.proxy.delay())}:
+		case <-c.closed:
+			return
+		}
+	}
+}
+
+// write sends the frames when due, once the network isn't partitioned and within the bandwidth
+func (c *connection) write(dst net.Conn, frames <-chan frame, written chan<- struct{}) {
+	defer close(written)
+	for f := range frames {
+		if wait := time.Until(f.due); wait > 0 {
+			select {
+			case <-time.After(wait):
+			case <-c.closed:
+				return
+			}
+		}
+		select {
+		case <-c.proxy.healed():
+		case <-c.closed:
+			return
+		}
+		if err := writeFrame(dst, f.data); err != nil {
+			if !c.isClosed() {
+				logger.Debugf("proxy error writing to %v: %v", dst.RemoteAddr(), err)
+			}
+			c.close()
+			return
+		}
+		if bw := c.proxy.cfg.BandwidthBytesPerSec; bw > 0 {
+			time.Sleep(time.Duration(len(f.data)+4) * time.Second / time.Duration(bw))
+		}
+	}
+}
+
+func (c *connection) trackRequest(data []byte) ([]byte, error) {
+	req, id, ok := requestHeader(data)
+	if ok && req.rewritten() {
+		c.mu.Lock()
+		c.requests[id] = req
+		c.mu.Unlock()
+	}
+	return data, nil
+}
+
+func (c *connection) rewriteResponse(data []byte) ([]byte, error) {
+	id, ok := correlationID(data)
+	if !ok {
+		return data, nil
+	}
+	c.mu.Lock()
+	req, ok := c.requests[id]
+	delete(c.requests, id)
+	c.mu.Unlock()
+	if !ok {
+		return data, nil
+	}
+	return rewriteResponse(req, data, c.proxy.address)
+}
+
+// reset closes the connections without lingering, so the peers get a RST rather than a FIN
+func (c *connection) reset() {
+	logger.Debugf("proxy resetting connection from %v", c.client.RemoteAddr())
+	metrics.ProxyFault(resetFault)
+	for _, conn := range []net.Conn{c.client, c.broker} {
+		if tcp, ok := conn.(*net.TCPConn); ok {
+			tcp.SetLinger(0)
+		}
+	}
+	c.close()
+}
+
+func (c *connection) close() {
+	c.once.Do(func() {
+		close(c.closed)
+		c.client.Close()
+		c.broker.Close()
+	})
+}
+
+func (c *connection) isClosed() bool {
+	select {
+	case <-c.closed:
+		return true
+	default:
+		return false
+	}
+}
+
+func newConnection(p *Proxy, client, broker net.Conn) *connection {
+	return &connection{
+		proxy:    p,
+		client:   client,
+		broker:   broker,
+		requests: make(map[int32]request),
+		closed:   make(chan struct{}),
+	}
+}
+
+// readFrame reads a size delimited kafka request or response, without the size
+func readFrame(r io.Reader) ([]byte, error) {
+	var size [4]byte
+	if _, err := io.ReadFull(r, size[:]); err != nil {
+		return nil, err
+	}
+	n := binary.BigEndian.Uint32(size[:])
+	if n > maxFrameBytes {
+		return nil, fmt.Errorf("invalid frame size %d", n)
+	}
+	data := make([]byte, n)
+	if _, err := io.ReadFull(r, data); err != nil {
+		return nil, err
+	}
+	return data, nil
+}
+
+func writeFrame(w io.Writer, data []byte) error {
+	_, err := w.Write(append(appendInt32(make([]byte, 0, len(data)+4), int32(len(data))), data...))
+	return err
+}
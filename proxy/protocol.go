@@ -0,0 +1,160 @@
+package proxy
+
+import (
+	"encoding/binary"
+	"errors"
+)
+
+const (
+	metadataKey        int16 = 3
+	findCoordinatorKey int16 = 10
+	// first versions with the flexible encoding, not sent by the librdkafka version used
+	metadataFlexibleVersion        int16 = 9
+	findCoordinatorFlexibleVersion int16 = 3
+)
+
+var errTruncated = errors.New("truncated kafka frame")
+
+// request is the api of a request the response is rewritten for
+type request struct {
+	key     int16
+	version int16
+}
+
+func (r request) rewritten() bool {
+	switch r.key {
+	case metadataKey:
+		return r.version < metadataFlexibleVersion
+	case findCoordinatorKey:
+		return r.version < findCoordinatorFlexibleVersion
+	}
+	return false
+}
+
+// addressRewriter maps an advertised broker address to the address of its proxy listener
+type addressRewriter func(host string, port int32) (string, int32, error)
+
+// requestHeader parses the api and correlation id of a request frame
+func requestHeader(frame []byte) (request, int32, bool) {
+	if len(frame) < 8 {
+		return request{}, 0, false
+	}
+	req := request{key: int16(binary.BigEndian.Uint16(frame)), version: int16(binary.BigEndian.Uint16(frame[2:]))}
+	return req, int32(binary.BigEndian.Uint32(frame[4:])), true
+}
+
+// correlationID of a response frame
+func correlationID(frame []byte) (int32, bool) {
+	if len(frame) < 4 {
+		return 0, false
+	}
+	return int32(binary.BigEndian.Uint32(frame)), true
+}
+
+// rewriteResponse replaces the broker addresses of metadata and coordinator responses,
+// so the client connects to every broker through the proxy
+func rewriteResponse(req request, frame []byte, rewrite addressRewriter) ([]byte, error) {
+	r := &reader{buf: frame, off: 4}
+	var out []byte
+	switch req.key {
+	case metadataKey:
+		if req.version >= 3 {
+			r.next(4) // throttle time
+		}
+		brokers := r.int32()
+		out = append(out, frame[:r.off]...)
+		for i := int32(0); i < brokers && r.err == nil; i++ {
+			out = append(out, r.next(4)...) // node id
+			out = r.rewriteAddress(out, rewrite)
+			if req.version >= 1 {
+				rack := r.off
+				r.string()
+				out = append(out, frame[rack:r.off]...)
+			}
+		}
+	case findCoordinatorKey:
+		if req.version >= 1 {
+			r.next(4) // throttle time
+		}
+		r.int16() // error code
+		if req.version >= 1 {
+			r.string() // error message
+		}
+		r.next(4) // node id
+		out = append(out, frame[:r.off]...)
+		out = r.rewriteAddress(out, rewrite)
+	default:
+		return frame, nil
+	}
+	if r.err != nil {
+		return nil, r.err
+	}
+	return append(out, frame[r.off:]...), nil
+}
+
+type reader struct {
+	buf []byte
+	off int
+	err error
+}
+
+func (r *reader) next(n int) []byte {
+	if r.err != nil || n < 0 || r.off+n > len(r.buf) {
+		r.err = errTruncated
+		return nil
+	}
+	b := r.buf[r.off : r.off+n]
+	r.off += n
+	return b
+}
+
+func (r *reader) int16() int16 {
+	b := r.next(2)
+	if b == nil {
+		return 0
+	}
+	return int16(binary.BigEndian.Uint16(b))
+}
+
+func (r *reader) int32() int32 {
+	b := r.next(4)
+	if b == nil {
+		return 0
+	}
+	return int32(binary.BigEndian.Uint32(b))
+}
+
+// string reads a (nullable) string, null is read as empty
+func (r *reader) string() string {
+	n := r.int16()
+	if n < 0 {
+		return ""
+	}
+	return string(r.next(int(n)))
+}
+
+// rewriteAddress reads the host and port and appends the rewritten address to out
+func (r *reader) rewriteAddress(out []byte, rewrite addressRewriter) []byte {
+	host, port := r.string(), r.int32()
+	if r.err != nil {
+		return out
+	}
+	if host != "" {
+		var err error
+		if host, port, err = rewrite(host, port); err != nil {
+			r.err = err
+			return out
+		}
+	}
+	out = appendInt16(out, int16(len(host)))
+	out = append(out, host...)
+	return appendInt32(out, port)
+}
+
+func appendInt16(b []byte, v int16) []byte {
+	return append(b, byte(uint16(v)>>8), byte(v))
+}
+
+func appendInt32(b []byte, v int32) []byte {
+	return append(b, byte(uint32(v)>>24), byte(uint32(v)>>16), byte(uint32(v)>>8), byte(v))
+}
@@ -0,0 +1,69 @@
+package proxy
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func appendString(b []byte, s string) []byte {
+	return append(appendInt16(b, int16(len(s))), s...)
+}
+
+// metadataResponse is a v1 metadata response with the brokers and no topics
+func metadataResponse(correlationID int32, brokers map[int32]string, port int32) []byte {
+	b := appendInt32(nil, correlationID)
+	b = appendInt32(b, int32(len(brokers)))
+	for id := int32(0); id < int32(len(brokers)); id++ {
+		b = appendInt32(b, id)
+		b = appendString(b, brokers[id])
+		b = appendInt32(b, port)
+		b = appendInt16(b, -1) // null rack
+	}
+	b = appendInt32(b, 0) // controller id
+	return appendInt32(b, 0)
+}
+
+func localRewriter(host string, port int32) (string, int32, error) {
+	return "127.0.0.1", port + 1000, nil
+}
+
+func TestShouldRewriteBrokersOfMetadataResponse(t *testing.T) {
+	frame := metadataResponse(7, map[int32]string{0: "kafka-0", 1: "kafka-1.cluster.local"}, 9092)
+
+	out, err := rewriteResponse(request{key: metadataKey, version: 1}, frame, localRewriter)
+
+	require.NoError(t, err)
+	assert.Equal(t, metadataResponse(7, map[int32]string{0: "127.0.0.1", 1: "127.0.0.1"}, 10092), out)
+}
+
+func TestShouldRewriteCoordinatorAddress(t *testing.T) {
+	frame := appendInt32(nil, 3)
+	frame = appendInt32(frame, 0)  // throttle time
+	frame = appendInt16(frame, 0)  // error code
+	frame = appendInt16(frame, -1) // error message
+	frame = appendInt32(frame, 2)  // node id
+	frame = appendString(frame, "kafka-2")
+	frame = appendInt32(frame, 9092)
+
+	out, err := rewriteResponse(request{key: findCoordinatorKey, version: 1}, frame, localRewriter)
+
+	require.NoError(t, err)
+	expected := append(append([]byte{}, frame[:16]...), appendInt32(appendString(nil, "127.0.0.1"), 10092)...)
+	assert.Equal(t, expected, out)
+}
+
+func TestShouldFailTruncatedResponse(t *testing.T) {
+	frame := metadataResponse(7, map[int32]string{0: "kafka-0"}, 9092)
+
+	_, err := rewriteResponse(request{key: metadataKey, version: 1}, frame[:12], localRewriter)
+
+	assert.Equal(t, errTruncated, err)
+}
+
+func TestShouldOnlyRewriteNonFlexibleVersions(t *testing.T) {
+	assert.True(t, request{key: metadataKey, version: 4}.rewritten())
+	assert.False(t, request{key: metadataKey, version: 9}.rewritten())
+	assert.False(t, request{key: 1, version: 4}.rewritten())
+}
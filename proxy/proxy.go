@@ -0,0 +1,236 @@
+package proxy
+
+import (
+	"fmt"
+	"math/rand"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gojek/kafqa/config"
+	"github.com/gojek/kafqa/logger"
+	"github.com/gojek/kafqa/reporter/metrics"
+)
+
+const (
+	resetFault     = "reset"
+	partitionFault = "partition"
+)
+
+var connected = func() chan struct{} {
+	ch := make(chan struct{})
+	close(ch)
+	return ch
+}()
+
+// Proxy forwards the kafka connections through local listeners, one per broker, degrading
+// the network in between. Broker addresses in metadata responses are rewritten to the listeners.
+type Proxy struct {
+	cfg       config.Proxy
+	mu        sync.Mutex
+	listeners map[string]net.Listener
+	conns     map[*connection]struct{}
+	// closed once a scheduled partition heals, nil while connected
+	partitionMu sync.RWMutex
+	heal        chan struct{}
+	exit        chan struct{}
+	wg          sync.WaitGroup
+}
+
+// Bootstrap returns the listener addresses of the comma separated brokers
+func (p *Proxy) Bootstrap(brokers string) (string, error) {
+	var addrs []string
+	for _, broker := range strings.Split(brokers, ",") {
+		if broker = strings.TrimSpace(broker); broker == "" {
+			continue
+		}
+		addr, err := p.listen(broker)
+		if err != nil {
+			return "", err
+		}
+		addrs = append(addrs, addr)
+	}
+	return strings.Join(addrs, ","), nil
+}
+
+// address is the listener address of an advertised broker
+func (p *Proxy) address(host string, port int32) (string, int32, error) {
+	addr, err := p.listen(net.JoinHostPort(host, strconv.Itoa(int(port))))
+	if err != nil {
+		return "", 0, err
+	}
+	lhost, lport, err := net.SplitHostPort(addr)
+	if err != nil {
+		return "", 0, err
+	}
+	n, err := strconv.Atoi(lport)
+	return lhost, int32(n), err
+}
+
+func (p *Proxy) listen(broker string) (string, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if l, ok := p.listeners[broker]; ok {
+		return l.Addr().String(), nil
+	}
+	select {
+	case <-p.exit:
+		return "", fmt.Errorf("proxy closed")
+	default:
+	}
+	l, err := net.Listen("tcp", net.JoinHostPort(p.cfg.Host, "0"))
+	if err != nil {
+		return "", fmt.Errorf("error listening for broker %s: %v", broker, err)
+	}
+	logger.Infof("proxying broker %s on %s", broker, l.Addr())
+	p.listeners[broker] = l
+	p.wg.Add(1)
+	go p.accept(l, broker)
+	return l.Addr().String(), nil
+}
+
+func (p *Proxy) accept(l net.Listener, broker string) {
+	defer p.wg.Done()
+	for {
+		client, err := l.Accept()
+		if err != nil {
+			return
+		}
+		p.wg.Add(1)
+		go p.forward(client, broker)
+	}
+}
+
+// forward connects the client to the broker, connecting hangs while the network is partitioned
+func (p *Proxy) forward(client net.Conn, broker string) {
+	defer p.wg.Done()
+	select {
+	case <-p.healed():
+	case <-p.exit:
+		client.Close()
+		return
+	}
+	upstream, err := net.DialTimeout("tcp", broker, p.cfg.DialTimeout())
+	if err != nil {
+		logger.Errorf("proxy error connecting to broker %s: %v", broker, err)
+		client.Close()
+		return
+	}
+	c := newConnection(p, client, upstream)
+	p.mu.Lock()
+	select {
+	case <-p.exit:
+		p.mu.Unlock()
+		c.close()
+		return
+	default:
+		p.conns[c] = struct{}{}
+	}
+	p.mu.Unlock()
+
+	c.run()
+
+	p.mu.Lock()
+	delete(p.conns, c)
+	p.mu.Unlock()
+}
+
+func (p *Proxy) delay() time.Duration {
+	d := p.cfg.Latency()
+	if jitter := p.cfg.Jitter(); jitter > 0 {
+		d += time.Duration(rand.Int63n(int64(2*jitter)+1)) - jitter
+	}
+	if d < 0 {
+		return 0
+	}
+	return d
+}
+
+func (p *Proxy) resetDue() bool {
+	return p.cfg.ResetRate > 0 && rand.Float64() < p.cfg.ResetRate
+}
+
+// healed is closed while the network isn't partitioned
+func (p *Proxy) healed() <-chan struct{} {
+	p.partitionMu.RLock()
+	defer p.partitionMu.RUnlock()
+	if p.heal == nil {
+		return connected
+	}
+	return p.heal
+}
+
+func (p *Proxy) partition() {
+	p.partitionMu.Lock()
+	defer p.partitionMu.Unlock()
+	if p.heal == nil {
+		p.heal = make(chan struct{})
+	}
+}
+
+func (p *Proxy) healPartition() {
+	p.partitionMu.Lock()
+	defer p.partitionMu.Unlock()
+	if p.heal != nil {
+		close(p.heal)
+		p.heal = nil
+	}
+}
+
+// schedule partitions the network for the duration every interval
+func (p *Proxy) schedule() {
+	defer p.wg.Done()
+	ticker := time.NewTicker(p.cfg.PartitionInterval())
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			logger.Infof("proxy partitioning brokers for %v", p.cfg.PartitionDuration())
+			metrics.ProxyFault(partitionFault)
+			p.partition()
+			select {
+			case <-time.After(p.cfg.PartitionDuration()):
+				logger.Infof("proxy partition healed")
+				p.healPartition()
+			case <-p.exit:
+				p.healPartition()
+				return
+			}
+		case <-p.exit:
+			return
+		}
+	}
+}
+
+// Close stops the listeners and closes the forwarded connections
+func (p *Proxy) Close() {
+	p.mu.Lock()
+	close(p.exit)
+	for _, l := range p.listeners {
+		l.Close()
+	}
+	for c := range p.conns {
+		c.close()
+	}
+	p.mu.Unlock()
+	p.wg.Wait()
+}
+
+func New(cfg config.Proxy) (*Proxy, error) {
+	if cfg.ResetRate < 0 || cfg.ResetRate > 1 {
+		return nil, fmt.Errorf("invalid proxy reset rate %v, expected between 0 and 1", cfg.ResetRate)
+	}
+	p := &Proxy{
+		cfg:       cfg,
+		listeners: make(map[string]net.Listener),
+		conns:     make(map[*connection]struct{}),
+		exit:      make(chan struct{}),
+	}
+	if cfg.PartitionInterval() > 0 && cfg.PartitionDuration() > 0 {
+		p.wg.Add(1)
+		go p.schedule()
+	}
+	return p, nil
+}
@@ -0,0 +1,131 @@
+package proxy
+
+import (
+	"net"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/gojek/kafqa/config"
+	"github.com/gojek/kafqa/logger"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeBroker answers metadata requests advertising itself and echoes other requests
+func fakeBroker(t *testing.T) net.Listener {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	host, port, _ := net.SplitHostPort(l.Addr().String())
+	p, _ := strconv.Atoi(port)
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				for {
+					data, err := readFrame(conn)
+					if err != nil {
+						return
+					}
+					req, id, _ := requestHeader(data)
+					resp := appendInt32(nil, id)
+					if req.key == metadataKey {
+						resp = metadataResponse(id, map[int32]string{0: host}, int32(p))
+					}
+					if writeFrame(conn, resp) != nil {
+						return
+					}
+				}
+			}()
+		}
+	}()
+	return l
+}
+
+func roundTrip(t *testing.T, conn net.Conn, key int16, id int32) []byte {
+	req := appendInt32(appendInt16(appendInt16(nil, key), 1), id)
+	require.NoError(t, writeFrame(conn, req))
+	resp, err := readFrame(conn)
+	require.NoError(t, err)
+	return resp
+}
+
+func newTestProxy(t *testing.T, cfg config.Proxy) (*Proxy, net.Conn, func()) {
+	logger.Setup("")
+	broker := fakeBroker(t)
+	cfg.Host, cfg.DialTimeoutMs = "127.0.0.1", 1000
+	p, err := New(cfg)
+	require.NoError(t, err)
+	addr, err := p.Bootstrap(broker.Addr().String())
+	require.NoError(t, err)
+	conn, err := net.Dial("tcp", addr)
+	require.NoError(t, err)
+	return p, conn, func() {
+		conn.Close()
+		p.Close()
+		broker.Close()
+	}
+}
+
+func TestShouldRouteAdvertisedBrokersThroughProxy(t *testing.T) {
+	p, conn, closeAll := newTestProxy(t, config.Proxy{})
+	defer closeAll()
+
+	resp := roundTrip(t, conn, metadataKey, 5)
+
+	r := &reader{buf: resp, off: 8}
+	r.next(4)
+	host, port := r.string(), r.int32()
+	require.NoError(t, r.err)
+	assert.Equal(t, conn.RemoteAddr().String(), net.JoinHostPort(host, strconv.Itoa(int(port))))
+	assert.Len(t, p.listeners, 1)
+}
+
+func TestShouldDelayFramesByLatency(t *testing.T) {
+	_, conn, closeAll := newTestProxy(t, config.Proxy{LatencyMs: 50})
+	defer closeAll()
+
+	start := time.Now()
+	resp := roundTrip(t, conn, 18, 9)
+
+	assert.Equal(t, appendInt32(nil, 9), resp)
+	assert.True(t, time.Since(start) >= 100*time.Millisecond, "round trip took %v", time.Since(start))
+}
+
+func TestShouldResetConnections(t *testing.T) {
+	_, conn, closeAll := newTestProxy(t, config.Proxy{ResetRate: 1})
+	defer closeAll()
+
+	require.NoError(t, writeFrame(conn, appendInt32(appendInt32(nil, 18), 1)))
+	_, err := readFrame(conn)
+
+	assert.Error(t, err)
+}
+
+func TestShouldHoldFramesWhilePartitioned(t *testing.T) {
+	p, conn, closeAll := newTestProxy(t, config.Proxy{})
+	defer closeAll()
+	roundTrip(t, conn, 18, 1)
+
+	p.partition()
+	require.NoError(t, writeFrame(conn, appendInt32(appendInt32(nil, 18), 2)))
+	conn.SetReadDeadline(time.Now().Add(50 * time.Millisecond))
+	_, err := readFrame(conn)
+	require.Error(t, err)
+
+	p.healPartition()
+	conn.SetReadDeadline(time.Now().Add(time.Second))
+	resp, err := readFrame(conn)
+	require.NoError(t, err)
+	assert.Equal(t, appendInt32(nil, 2), resp)
+}
+
+func TestShouldFailInvalidResetRate(t *testing.T) {
+	_, err := New(config.Proxy{ResetRate: 1.5})
+
+	assert.Error(t, err)
+}
@@ -0,0 +1,122 @@
+package reconcile
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/gojek/kafqa/logger"
+	"github.com/gojek/kafqa/serde"
+	"github.com/gojek/kafqa/store"
+	"gopkg.in/confluentinc/confluent-kafka-go.v1/kafka"
+)
+
+type Status string
+
+const (
+	// message is in the log, consumer didn't receive it
+	Present Status = "present_not_consumed"
+	// offset is in range but message isn't there
+	Missing Status = "missing_from_log"
+	// offset is below the low watermark or beyond the high watermark, retention or truncation
+	OutOfRange Status = "offset_out_of_range"
+	// offset couldn't be read back
+	Unknown Status = "unknown"
+)
+
+type reader interface {
+	Assign([]kafka.TopicPartition) error
+	ReadMessage(time.Duration) (*kafka.Message, error)
+	QueryWatermarkOffsets(string, int32, int) (int64, int64, error)
+	Close() error
+}
+
+type watermark struct {
+	low, high int64
+}
+
+type Reconciler struct {
+	reader     reader
+	decoder    serde.Decoder
+	timeout    time.Duration
+	limit      int
+	watermarks map[string]watermark
+}
+
+// Reconcile reads back the unacknowledged traces at their delivered offsets and classifies them by message id
+func (r *Reconciler) Reconcile(traces []store.Trace) map[string]Status {
+	if r.limit >= 0 && len(traces) > r.limit {
+		logger.Infof("reconciling %d of %d unacknowledged messages", r.limit, len(traces))
+		traces = traces[:r.limit]
+	}
+	statuses := make(map[string]Status, len(traces))
+	for _, t := range traces {
+		status, err := r.status(t)
+		if err != nil {
+			logger.Errorf("error reconciling message %s at %v: %v", t.Message.ID, t.TopicPartition, err)
+		}
+		statuses[t.Message.ID] = status
+	}
+	return statuses
+}
+
+func (r *Reconciler) status(t store.Trace) (Status, error) {
+	topic, partition, offset := t.TopicName(), t.Partition, int64(t.Offset)
+	if topic == "" || offset < 0 {
+		return Unknown, fmt.Errorf("message wasn't delivered to an offset")
+	}
+	wm, err := r.watermark(topic, partition)
+	if err != nil {
+		return Unknown, err
+	}
+	if offset < wm.low || offset >= wm.high {
+		return OutOfRange, nil
+	}
+	tp := kafka.TopicPartition{Topic: &topic, Partition: partition, Offset: kafka.Offset(offset)}
+	if err := r.reader.Assign([]kafka.TopicPartition{tp}); err != nil {
+		return Unknown, err
+	}
+	msg, err := r.reader.ReadMessage(r.timeout)
+	if err != nil {
+		return Unknown, err
+	}
+	if int64(msg.TopicPartition.Offset) != offset {
+		return Missing, nil
+	}
+	m, err := r.decoder.FromBytes(msg.Value)
+	if err != nil || m.ID != t.Message.ID {
+		return Missing, nil
+	}
+	return Present, nil
+}
+
+func (r *Reconciler) watermark(topic string, partition int32) (watermark, error) {
+	key := fmt.Sprintf("%s[%d]", topic, partition)
+	if wm, ok := r.watermarks[key]; ok {
+		return wm, nil
+	}
+	low, high, err := r.reader.QueryWatermarkOffsets(topic, partition, int(r.timeout/time.Millisecond))
+	if err != nil {
+		return watermark{}, err
+	}
+	wm := watermark{low: low, high: high}
+	r.watermarks[key] = wm
+	return wm, nil
+}
+
+func (r *Reconciler) Close() error {
+	return r.reader.Close()
+}
+
+func New(kafkaCfg *kafka.ConfigMap, decoder serde.Decoder, timeout time.Duration, limit int) (*Reconciler, error) {
+	cons, err := kafka.NewConsumer(kafkaCfg)
+	if err != nil {
+		return nil, fmt.Errorf("error creating reconcile consumer: %v", err)
+	}
+	return &Reconciler{
+		reader:     cons,
+		decoder:    decoder,
+		timeout:    timeout,
+		limit:      limit,
+		watermarks: make(map[string]watermark),
+	}, nil
+}
@@ -0,0 +1,110 @@
+package reconcile
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/gojek/kafqa/creator"
+	"github.com/gojek/kafqa/logger"
+	"github.com/gojek/kafqa/serde"
+	"github.com/gojek/kafqa/store"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"gopkg.in/confluentinc/confluent-kafka-go.v1/kafka"
+)
+
+func init() {
+	logger.Setup("none")
+}
+
+var topic = "kafqa"
+
+func trace(id string, offset int64) store.Trace {
+	return store.Trace{Message: creator.Message{ID: id},
+		TopicPartition: kafka.TopicPartition{Topic: &topic, Partition: 1, Offset: kafka.Offset(offset)}}
+}
+
+func message(t *testing.T, id string, offset int64) *kafka.Message {
+	value, err := serde.KafqaParser{}.Bytes(creator.Message{ID: id, CreatedTime: time.Now()})
+	require.NoError(t, err)
+	return &kafka.Message{Value: value, TopicPartition: kafka.TopicPartition{Topic: &topic, Partition: 1, Offset: kafka.Offset(offset)}}
+}
+
+func assignment(offset int64) []kafka.TopicPartition {
+	return []kafka.TopicPartition{{Topic: &topic, Partition: 1, Offset: kafka.Offset(offset)}}
+}
+
+func TestShouldClassifyUnacknowledgedMessages(t *testing.T) {
+	r := new(readerMock)
+	rec := &Reconciler{reader: r, decoder: serde.KafqaParser{}, timeout: time.Second, limit: 10, watermarks: map[string]watermark{}}
+	r.On("QueryWatermarkOffsets", topic, int32(1)).Return(int64(100), int64(200), nil).Once()
+	r.On("Assign", assignment(150)).Return(nil)
+	r.On("ReadMessage").Return(message(t, "present", 150), nil).Once()
+	r.On("Assign", assignment(160)).Return(nil)
+	r.On("ReadMessage").Return(message(t, "other", 160), nil).Once()
+	r.On("Assign", assignment(170)).Return(nil)
+	r.On("ReadMessage").Return(message(t, "skipped", 171), nil).Once()
+	r.On("Assign", assignment(180)).Return(nil)
+	r.On("ReadMessage").Return((*kafka.Message)(nil), errors.New("timed out")).Once()
+
+	statuses := rec.Reconcile([]store.Trace{
+		trace("present", 150),
+		trace("different", 160),
+		trace("compacted", 170),
+		trace("timeout", 180),
+		trace("retention", 50),
+		trace("truncated", 200),
+		trace("undelivered", int64(kafka.OffsetInvalid)),
+	})
+
+	assert.Equal(t, map[string]Status{
+		"present":     Present,
+		"different":   Missing,
+		"compacted":   Missing,
+		"timeout":     Unknown,
+		"retention":   OutOfRange,
+		"truncated":   OutOfRange,
+		"undelivered": Unknown,
+	}, statuses)
+	r.AssertExpectations(t)
+}
+
+func TestShouldReconcileOnlyUptoLimit(t *testing.T) {
+	r := new(readerMock)
+	rec := &Reconciler{reader: r, decoder: serde.KafqaParser{}, timeout: time.Second, limit: 1, watermarks: map[string]watermark{}}
+	r.On("QueryWatermarkOffsets", topic, int32(1)).Return(int64(100), int64(200), nil)
+
+	statuses := rec.Reconcile([]store.Trace{trace("a", 10), trace("b", 20)})
+
+	assert.Equal(t, map[string]Status{"a": OutOfRange}, statuses)
+}
+
+func TestShouldReconcileAllWithNegativeLimit(t *testing.T) {
+	r := new(readerMock)
+	rec := &Reconciler{reader: r, decoder: serde.KafqaParser{}, timeout: time.Second, limit: -1, watermarks: map[string]watermark{}}
+	r.On("QueryWatermarkOffsets", topic, int32(1)).Return(int64(100), int64(200), nil)
+
+	statuses := rec.Reconcile([]store.Trace{trace("a", 10), trace("b", 20)})
+
+	assert.Equal(t, map[string]Status{"a": OutOfRange, "b": OutOfRange}, statuses)
+}
+
+type readerMock struct{ mock.Mock }
+
+func (m *readerMock) Assign(tps []kafka.TopicPartition) error {
+	return m.Called(tps).Error(0)
+}
+
+func (m *readerMock) ReadMessage(timeout time.Duration) (*kafka.Message, error) {
+	args := m.Called()
+	return args.Get(0).(*kafka.Message), args.Error(1)
+}
+
+func (m *readerMock) QueryWatermarkOffsets(topic string, partition int32, timeoutMs int) (int64, int64, error) {
+	args := m.Called(topic, partition)
+	return args.Get(0).(int64), args.Get(1).(int64), args.Error(2)
+}
+
+func (m *readerMock) Close() error { return m.Called().Error(0) }
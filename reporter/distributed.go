@@ -0,0 +1,134 @@
+package reporter
+
+import (
+	"strconv"
+	"strings"
+	"sync/atomic"
+)
+
+// InstanceResult is what an instance of a distributed run keeps locally, the messages sent and received
+// are counted by the shared store
+type InstanceResult struct {
+	ID             string                      `json:"id"`
+	Corrupted      int64                       `json:"corrupted"`
+	HeaderMismatch int64                       `json:"header_mismatch"`
+	Dropped        int64                       `json:"dropped_by_store,omitempty"`
+	Latency        *Histogram                  `json:"latency"`
+	TopicLatency   map[string]*Histogram       `json:"topic_latency,omitempty"`
+	Rebalances     []RebalanceWindow           `json:"rebalances,omitempty"`
+	ProduceErrors  map[string]map[string]int64 `json:"producer_errors,omitempty"`
+}
+
+// DistributedReport lists the instances of the run, the ones missing didn't push their results in time
+type DistributedReport struct {
+	Instances []string `json:"instances"`
+	Missing   []string `json:"missing,omitempty"`
+	P50       uint32   `json:"p50_consumption_ms"`
+	P95       uint32   `json:"p95_consumption_ms"`
+	P99       uint32   `json:"p99_consumption_ms"`
+}
+
+func (d *DistributedReport) rows() [][]string {
+	return [][]string{
+		{"10", "Instances Reported", strconv.Itoa(len(d.Instances))},
+		{"10", "Instances Missing", strings.Join(d.Missing, ",")},
+		{"10", "P50 Consumption Latency Millis", strconv.FormatUint(uint64(d.P50), 10)},
+		{"10", "P95 Consumption Latency Millis", strconv.FormatUint(uint64(d.P95), 10)},
+		{"10", "P99 Consumption Latency Millis", strconv.FormatUint(uint64(d.P99), 10)},
+	}
+}
+
+// Result returns the results kept by this instance, to be pushed to the shared store
+func Result(id string) InstanceResult {
+	rep := current()
+	result := InstanceResult{
+		ID:             id,
+		Corrupted:      atomic.LoadInt64(&rep.corrupted),
+		HeaderMismatch: atomic.LoadInt64(&rep.headerMismatch),
+		Latency:        NewHistogram(),
+		TopicLatency:   make(map[string]*Histogram),
+	}
+	if dc, ok := rep.srep.(dropCounter); ok {
+		result.Dropped = dc.Dropped()
+	}
+	rep.latencyMu.Lock()
+	result.Latency.Merge(rep.histogram)
+	for topic, h := range rep.topicHistogram {
+		result.TopicLatency[topic] = NewHistogram()
+		result.TopicLatency[topic].Merge(h)
+	}
+	rep.latencyMu.Unlock()
+	rep.rebalanceMu.Lock()
+	result.Rebalances = append(result.Rebalances, rep.rebalances...)
+	rep.rebalanceMu.Unlock()
+	rep.produceErrMu.Lock()
+	if len(rep.produceErrors) > 0 {
+		result.ProduceErrors = make(map[string]map[string]int64)
+		for fault, errs := range rep.produceErrors {
+			result.ProduceErrors[fault] = make(map[string]int64)
+			for e, n := range errs {
+				result.ProduceErrors[fault][e] = n
+			}
+		}
+	}
+	rep.produceErrMu.Unlock()
+	return result
+}
+
+// GenerateDistributedReport reports the run from the shared store and the results pushed by its instances
+func GenerateDistributedReport(results []InstanceResult, missing []string) {
+	report := build()
+	listLost(&report)
+	aggregate(&report, results, missing)
+	output(report)
+}
+
+// aggregate replaces the results local to this instance with the ones of all the instances
+func aggregate(report *Report, results []InstanceResult, missing []string) {
+	latency := NewHistogram()
+	topicLatency := make(map[string]*Histogram)
+	distributed := &DistributedReport{Missing: missing}
+	report.Messages.Corrupted, report.Messages.HeaderMismatch, report.Messages.Dropped = 0, 0, 0
+	report.Rebalances, report.ProduceErrors = nil, nil
+	for _, res := range results {
+		distributed.Instances = append(distributed.Instances, res.ID)
+		report.Messages.Corrupted += res.Corrupted
+		report.Messages.HeaderMismatch += res.HeaderMismatch
+		report.Messages.Dropped += res.Dropped
+		latency.Merge(res.Latency)
+		for topic, h := range res.TopicLatency {
+			if topicLatency[topic] == nil {
+				topicLatency[topic] = NewHistogram()
+			}
+			topicLatency[topic].Merge(h)
+		}
+		if len(res.Rebalances) > 0 {
+			if report.Rebalances == nil {
+				report.Rebalances = &RebalanceReport{}
+			}
+			report.Rebalances.Windows = append(report.Rebalances.Windows, res.Rebalances...)
+		}
+		for fault, errs := range res.ProduceErrors {
+			if report.ProduceErrors == nil {
+				report.ProduceErrors = &ProduceErrorReport{Errors: make(map[string]map[string]int64)}
+			}
+			if report.ProduceErrors.Errors[fault] == nil {
+				report.ProduceErrors.Errors[fault] = make(map[string]int64)
+			}
+			for e, n := range errs {
+				report.ProduceErrors.Errors[fault][e] += n
+			}
+		}
+	}
+	report.Time.MinConsumption, report.Time.MaxConsumption = latency.MinMs(), latency.Max
+	for topic, h := range topicLatency {
+		tr := report.Topics[topic]
+		tr.MinConsumption, tr.MaxConsumption = h.MinMs(), h.Max
+		if report.Topics == nil {
+			report.Topics = make(map[string]TopicReport)
+		}
+		report.Topics[topic] = tr
+	}
+	distributed.P50, distributed.P95, distributed.P99 = latency.Percentile(50), latency.Percentile(95), latency.Percentile(99)
+	report.Distributed = distributed
+}
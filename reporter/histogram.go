@@ -0,0 +1,80 @@
+package reporter
+
+import "math"
+
+// upper bounds of the latency buckets in millis, fixed so histograms of different instances can be merged
+var latencyBuckets = []uint32{1, 2, 5, 10, 25, 50, 100, 250, 500, 1000, 2500, 5000, 10000, 30000, 60000}
+
+// Histogram counts the consumption latencies by bucket, the last count is beyond the largest bucket
+type Histogram struct {
+	Counts []int64 `json:"counts"`
+	Count  int64   `json:"count"`
+	Min    uint32  `json:"min_ms"`
+	Max    uint32  `json:"max_ms"`
+}
+
+func (h *Histogram) Observe(ms uint32) {
+	i := 0
+	for i < len(latencyBuckets) && ms > latencyBuckets[i] {
+		i++
+	}
+	h.Counts[i]++
+	h.Count++
+	if ms < h.Min {
+		h.Min = ms
+	}
+	if ms > h.Max {
+		h.Max = ms
+	}
+}
+
+// Merge adds the latencies of the other histogram
+func (h *Histogram) Merge(other *Histogram) {
+	if other == nil {
+		return
+	}
+	for i := range h.Counts {
+		if i < len(other.Counts) {
+			h.Counts[i] += other.Counts[i]
+		}
+	}
+	h.Count += other.Count
+	if other.Count > 0 && other.Min < h.Min {
+		h.Min = other.Min
+	}
+	if other.Max > h.Max {
+		h.Max = other.Max
+	}
+}
+
+// MinMs is the lowest latency observed, 0 when none was
+func (h *Histogram) MinMs() uint32 {
+	if h.Count == 0 {
+		return 0
+	}
+	return h.Min
+}
+
+// Percentile is the upper bound of the bucket holding the percentile, bounded by the max latency
+func (h *Histogram) Percentile(p float64) uint32 {
+	if h.Count == 0 {
+		return 0
+	}
+	rank := int64(math.Ceil(p / 100 * float64(h.Count)))
+	var seen int64
+	for i, n := range h.Counts {
+		seen += n
+		if seen < rank {
+			continue
+		}
+		if i < len(latencyBuckets) && latencyBuckets[i] < h.Max {
+			return latencyBuckets[i]
+		}
+		break
+	}
+	return h.Max
+}
+
+func NewHistogram() *Histogram {
+	return &Histogram{Counts: make([]int64, len(latencyBuckets)+1), Min: math.MaxUint32}
+}
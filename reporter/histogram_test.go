@@ -0,0 +1,35 @@
+package reporter
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestShouldMergeHistogramsOfInstances(t *testing.T) {
+	first, second := NewHistogram(), NewHistogram()
+	for _, ms := range []uint32{3, 8, 40} {
+		first.Observe(ms)
+	}
+	second.Observe(700)
+
+	first.Merge(second)
+
+	assert.Equal(t, int64(4), first.Count)
+	assert.Equal(t, uint32(3), first.Min)
+	assert.Equal(t, uint32(700), first.Max)
+}
+
+func TestShouldReportPercentileAsBucketBoundedByMax(t *testing.T) {
+	h := NewHistogram()
+	for i := 0; i < 98; i++ {
+		h.Observe(4)
+	}
+	h.Observe(90)
+	h.Observe(120)
+
+	assert.Equal(t, uint32(5), h.Percentile(50))
+	assert.Equal(t, uint32(100), h.Percentile(99))
+	assert.Equal(t, uint32(120), h.Percentile(100))
+	assert.Equal(t, uint32(0), NewHistogram().Percentile(99))
+}
@@ -0,0 +1,150 @@
+package reporter
+
+import (
+	"bytes"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/gojek/kafqa/reconcile"
+	"github.com/gojek/kafqa/store"
+	"github.com/olekukonko/tablewriter"
+)
+
+type traceLister interface {
+	UnacknowledgedTraces() ([]store.Trace, error)
+}
+
+// metadataKeeper is a store keeping the offsets of the traces only when asked to, eg: the redis store
+type metadataKeeper interface {
+	KeepsMetadata() bool
+}
+
+type LostMessage struct {
+	ID        string    `json:"id"`
+	Sequence  uint64    `json:"sequence"`
+	Topic     string    `json:"topic"`
+	Partition int32     `json:"partition"`
+	Offset    int64     `json:"offset"`
+	Produced  time.Time `json:"produced"`
+	// set when the lost messages are reconciled with the broker
+	Status reconcile.Status `json:"status,omitempty"`
+}
+
+// LostRange is a contiguous run of lost offsets in a partition
+type LostRange struct {
+	Topic         string           `json:"topic"`
+	Partition     int32            `json:"partition"`
+	FromOffset    int64            `json:"from_offset"`
+	ToOffset      int64            `json:"to_offset"`
+	Count         int              `json:"count"`
+	FirstProduced time.Time        `json:"first_produced"`
+	LastProduced  time.Time        `json:"last_produced"`
+	Status        reconcile.Status `json:"status,omitempty"`
+}
+
+type LostReport struct {
+	Ranges     []LostRange              `json:"ranges"`
+	Reconciled map[reconcile.Status]int `json:"reconciled,omitempty"`
+	// limited to the configured number of messages
+	Messages []LostMessage `json:"messages"`
+}
+
+func lostReport(traces []store.Trace, limit int, statuses map[string]reconcile.Status) *LostReport {
+	msgs := make([]LostMessage, 0, len(traces))
+	for _, t := range traces {
+		msgs = append(msgs, LostMessage{
+			ID:        t.Message.ID,
+			Sequence:  t.Sequence,
+			Topic:     t.TopicName(),
+			Partition: t.Partition,
+			Offset:    int64(t.Offset),
+			Produced:  t.CreatedTime,
+			Status:    statuses[t.Message.ID],
+		})
+	}
+	sort.Slice(msgs, func(i, j int) bool {
+		a, b := msgs[i], msgs[j]
+		if a.Topic != b.Topic {
+			return a.Topic < b.Topic
+		}
+		if a.Partition != b.Partition {
+			return a.Partition < b.Partition
+		}
+		return a.Offset < b.Offset
+	})
+
+	report := &LostReport{}
+	if len(statuses) > 0 {
+		report.Reconciled = make(map[reconcile.Status]int)
+		for _, status := range statuses {
+			report.Reconciled[status]++
+		}
+	}
+	for _, m := range msgs {
+		n := len(report.Ranges)
+		if n > 0 {
+			last := &report.Ranges[n-1]
+			if last.Topic == m.Topic && last.Partition == m.Partition && last.ToOffset+1 == m.Offset && last.Status == m.Status {
+				last.ToOffset = m.Offset
+				last.Count++
+				if m.Produced.Before(last.FirstProduced) {
+					last.FirstProduced = m.Produced
+				}
+				if m.Produced.After(last.LastProduced) {
+					last.LastProduced = m.Produced
+				}
+				continue
+			}
+		}
+		report.Ranges = append(report.Ranges, LostRange{Topic: m.Topic, Partition: m.Partition,
+			FromOffset: m.Offset, ToOffset: m.Offset, Count: 1, FirstProduced: m.Produced, LastProduced: m.Produced,
+			Status: m.Status})
+	}
+	if limit >= 0 && len(msgs) > limit {
+		msgs = msgs[:limit]
+	}
+	report.Messages = msgs
+	return report
+}
+
+func (l *LostReport) String() string {
+	buf := bytes.NewBufferString("")
+	table := tablewriter.NewWriter(buf)
+	table.SetHeader([]string{"Topic", "Partition", "Offsets", "Count", "Produced", "Status"})
+	for _, r := range l.Ranges {
+		offsets := strconv.FormatInt(r.FromOffset, 10)
+		if r.ToOffset != r.FromOffset {
+			offsets += "-" + strconv.FormatInt(r.ToOffset, 10)
+		}
+		produced := r.FirstProduced.Format("15:04:05.000")
+		if !r.LastProduced.Equal(r.FirstProduced) {
+			produced += " - " + r.LastProduced.Format("15:04:05.000")
+		}
+		table.Append([]string{r.Topic, strconv.Itoa(int(r.Partition)), offsets, strconv.Itoa(r.Count), produced, string(r.Status)})
+	}
+	table.Render()
+
+	if len(l.Messages) > 0 {
+		table = tablewriter.NewWriter(buf)
+		table.SetHeader([]string{"ID", "Sequence", "Topic", "Partition", "Offset", "Produced", "Status"})
+		for _, m := range l.Messages {
+			table.Append([]string{m.ID, strconv.FormatUint(m.Sequence, 10), m.Topic, strconv.Itoa(int(m.Partition)),
+				strconv.FormatInt(m.Offset, 10), m.Produced.Format(time.RFC3339Nano), string(m.Status)})
+		}
+		table.Render()
+	}
+	return buf.String()
+}
+
+func (l *LostReport) rows() [][]string {
+	if l.Reconciled == nil {
+		return nil
+	}
+	return [][]string{
+		{"6", "Lost Present Not Consumed", strconv.Itoa(l.Reconciled[reconcile.Present])},
+		{"6", "Lost Missing From Log", strconv.Itoa(l.Reconciled[reconcile.Missing])},
+		{"6", "Lost Offset Out Of Range", strconv.Itoa(l.Reconciled[reconcile.OutOfRange])},
+		{"6", "Lost Unknown", strconv.Itoa(l.Reconciled[reconcile.Unknown])},
+	}
+}
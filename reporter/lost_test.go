@@ -0,0 +1,101 @@
+package reporter
+
+import (
+	"testing"
+	"time"
+
+	"github.com/gojek/kafqa/creator"
+	"github.com/gojek/kafqa/reconcile"
+	"github.com/gojek/kafqa/store"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gopkg.in/confluentinc/confluent-kafka-go.v1/kafka"
+)
+
+func lostTrace(topic string, partition int32, offset int64, produced time.Time) store.Trace {
+	return store.Trace{
+		Message:        creator.Message{ID: topic + string(rune('a'+offset)), Sequence: uint64(offset), CreatedTime: produced},
+		TopicPartition: kafka.TopicPartition{Topic: &topic, Partition: partition, Offset: kafka.Offset(offset)},
+	}
+}
+
+func TestShouldGroupLostMessagesIntoContiguousOffsetRanges(t *testing.T) {
+	start := time.Date(2019, 8, 1, 14, 2, 0, 0, time.UTC)
+	traces := []store.Trace{
+		lostTrace("a", 7, 12, start.Add(2*time.Second)),
+		lostTrace("a", 7, 10, start),
+		lostTrace("a", 7, 11, start.Add(time.Second)),
+		lostTrace("a", 7, 15, start.Add(5*time.Second)),
+		lostTrace("a", 3, 11, start),
+		lostTrace("b", 7, 13, start),
+	}
+
+	report := lostReport(traces, 2, nil)
+
+	assert.Equal(t, []LostRange{
+		{Topic: "a", Partition: 3, FromOffset: 11, ToOffset: 11, Count: 1, FirstProduced: start, LastProduced: start},
+		{Topic: "a", Partition: 7, FromOffset: 10, ToOffset: 12, Count: 3, FirstProduced: start, LastProduced: start.Add(2 * time.Second)},
+		{Topic: "a", Partition: 7, FromOffset: 15, ToOffset: 15, Count: 1, FirstProduced: start.Add(5 * time.Second),
+			LastProduced: start.Add(5 * time.Second)},
+		{Topic: "b", Partition: 7, FromOffset: 13, ToOffset: 13, Count: 1, FirstProduced: start, LastProduced: start},
+	}, report.Ranges)
+	require.Len(t, report.Messages, 2, "messages should be limited")
+	assert.Equal(t, LostMessage{ID: "al", Sequence: 11, Topic: "a", Partition: 3, Offset: 11, Produced: start}, report.Messages[0])
+	assert.Len(t, lostReport(traces, -1, nil).Messages, len(traces), "negative limit should list all messages")
+}
+
+func TestShouldRenderLostRangesInReport(t *testing.T) {
+	start := time.Date(2019, 8, 1, 14, 2, 0, 0, time.UTC)
+	report := Report{Lost: lostReport([]store.Trace{
+		lostTrace("a", 7, 10, start),
+		lostTrace("a", 7, 11, start.Add(time.Second)),
+	}, 0, nil)}
+
+	out := report.String()
+
+	assert.Contains(t, out, "Lost Messages:")
+	assert.Contains(t, out, "10-11")
+	assert.Contains(t, out, "14:02:00.000 - 14:02:01.000")
+	assert.NotContains(t, out, "SEQUENCE")
+}
+
+func TestShouldSplitLostRangesByReconciledStatus(t *testing.T) {
+	start := time.Date(2019, 8, 1, 14, 2, 0, 0, time.UTC)
+	traces := []store.Trace{lostTrace("a", 7, 10, start), lostTrace("a", 7, 11, start), lostTrace("a", 7, 12, start)}
+	statuses := map[string]reconcile.Status{"ak": reconcile.Present, "al": reconcile.Present, "am": reconcile.Missing}
+
+	report := lostReport(traces, 10, statuses)
+
+	require.Len(t, report.Ranges, 2)
+	assert.Equal(t, 2, report.Ranges[0].Count)
+	assert.Equal(t, reconcile.Present, report.Ranges[0].Status)
+	assert.Equal(t, reconcile.Missing, report.Ranges[1].Status)
+	assert.Equal(t, map[reconcile.Status]int{reconcile.Present: 2, reconcile.Missing: 1}, report.Reconciled)
+	assert.Contains(t, (&Report{Lost: report}).String(), "Lost Missing From Log")
+}
+
+type metadataStore struct {
+	closingStore
+	keeps bool
+}
+
+func (ms *metadataStore) UnacknowledgedTraces() ([]store.Trace, error) {
+	return []store.Trace{lostTrace("a", 7, 10, time.Now())}, nil
+}
+
+func (ms *metadataStore) KeepsMetadata() bool {
+	return ms.keeps
+}
+
+func TestShouldNotListLostTracesWhenStoreDoesNotKeepTheirMetadata(t *testing.T) {
+	active = &reporter{srep: &metadataStore{}}
+	_, ok, err := LostTraces()
+	require.NoError(t, err)
+	assert.False(t, ok)
+
+	active = &reporter{srep: &metadataStore{keeps: true}}
+	traces, ok, err := LostTraces()
+	require.NoError(t, err)
+	assert.True(t, ok)
+	assert.Len(t, traces, 1)
+}
@@ -3,6 +3,7 @@ package metrics
 import (
 	"net/http"
 	"strconv"
+	"sync"
 	"time"
 
 	"github.com/gojek/kafqa/config"
@@ -13,7 +14,13 @@ import (
 )
 
 var (
-	tags = []string{"topic", "pod_name", "deployment", "kafka_cluster", "ack"}
+	tags           = []string{"topic", "pod_name", "deployment", "kafka_cluster", "ack"}
+	partitionTags  = append(append([]string{}, tags...), "partition")
+	rebalanceTags  = append(append([]string{}, tags...), "event")
+	consumerTags   = append(append([]string{}, tags...), "consumer")
+	commitTags     = append(append([]string{}, tags...), "strategy")
+	faultTags      = append(append([]string{}, tags...), "fault")
+	produceErrTags = append(append([]string{}, tags...), "fault", "error")
 
 	//TODO: could add to []metrics in prom{} so we can register all
 	messagesSent = prometheus.NewCounterVec(prometheus.CounterOpts{
@@ -24,6 +31,22 @@ var (
 		Namespace: "kafqa_messages",
 		Name:      "received",
 	}, tags)
+	messagesCorrupted = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "kafqa_messages",
+		Name:      "corrupted",
+	}, tags)
+	messagesHeaderMismatch = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "kafqa_messages",
+		Name:      "header_mismatch",
+	}, tags)
+	messagesLost = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "kafqa_messages",
+		Name:      "lost",
+	}, tags)
+	messagesLossRatio = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: "kafqa_messages",
+		Name:      "loss_ratio",
+	}, tags)
 	produceLatency = prometheus.NewSummaryVec(prometheus.SummaryOpts{
 		Namespace:  "kafqa_latency_ms",
 		Name:       "produce",
@@ -60,6 +83,65 @@ var (
 		Namespace: "kafqa_consumer_channel",
 		Name:      "messages_queued",
 	}, tags)
+	consumerCallbackQueueLength = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: "kafqa_consumer_callback",
+		Name:      "messages_queued",
+	}, tags)
+	consumerCommitLatency = prometheus.NewSummaryVec(prometheus.SummaryOpts{
+		Namespace:  "kafqa_latency_ms",
+		Name:       "consumer_commit",
+		Objectives: map[float64]float64{0.9: 0.01, 0.99: 0.001},
+	}, commitTags)
+	consumerCommitFailures = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "kafqa_consumer",
+		Name:      "commit_failures",
+	}, commitTags)
+	consumerInjectedFaults = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "kafqa_consumer",
+		Name:      "injected_faults",
+	}, faultTags)
+	producerErrors = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "kafqa_producer",
+		Name:      "errors",
+	}, produceErrTags)
+	proxyInjectedFaults = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "kafqa_proxy",
+		Name:      "injected_faults",
+	}, faultTags)
+	mirrorReplicationLag = prometheus.NewSummaryVec(prometheus.SummaryOpts{
+		Namespace:  "kafqa_latency_ms",
+		Name:       "mirror_replication",
+		Objectives: map[float64]float64{0.5: 0.05, 0.9: 0.01, 0.99: 0.001},
+	}, partitionTags)
+	consumerRebalances = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "kafqa_consumer",
+		Name:      "rebalances",
+	}, rebalanceTags)
+	consumerRebalanceDuration = prometheus.NewSummaryVec(prometheus.SummaryOpts{
+		Namespace:  "kafqa_latency_ms",
+		Name:       "consumer_rebalance",
+		Objectives: map[float64]float64{0.5: 0.05, 0.9: 0.01, 0.99: 0.001},
+	}, tags)
+	consumerAssignedPartitions = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: "kafqa_consumer",
+		Name:      "assigned_partitions",
+	}, consumerTags)
+	partitionISRSize = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: "kafqa_partition",
+		Name:      "isr_size",
+	}, partitionTags)
+	partitionLeader = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: "kafqa_partition",
+		Name:      "leader",
+	}, partitionTags)
+	partitionUnderReplicated = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: "kafqa_partition",
+		Name:      "under_replicated",
+	}, partitionTags)
+	partitionOffline = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: "kafqa_partition",
+		Name:      "offline",
+	}, partitionTags)
 )
 
 type promClient struct {
@@ -80,22 +162,50 @@ var promtags promTags
 
 func AcknowledgedMessage(msg creator.Message, topic string) {
 	if prom.enabled {
-		messagesReceived.WithLabelValues(promtags.topic, promtags.podName, promtags.deployment,
+		messagesReceived.WithLabelValues(topic, promtags.podName, promtags.deployment,
+			promtags.kafkaCluster, promtags.ack).Inc()
+	}
+}
+
+func CorruptedMessage(topic string) {
+	if prom.enabled {
+		messagesCorrupted.WithLabelValues(topic, promtags.podName, promtags.deployment,
 			promtags.kafkaCluster, promtags.ack).Inc()
 	}
 }
 
-func SentMessage(msg creator.Message) {
+func HeaderMismatch(topic string) {
 	if prom.enabled {
-		messagesSent.WithLabelValues(promtags.topic, promtags.podName, promtags.deployment,
+		messagesHeaderMismatch.WithLabelValues(topic, promtags.podName, promtags.deployment,
 			promtags.kafkaCluster, promtags.ack).Inc()
 	}
 }
 
-func ConsumerLatency(dur time.Duration) {
+func LostMessage(topic string) {
+	if prom.enabled {
+		messagesLost.WithLabelValues(topic, promtags.podName, promtags.deployment,
+			promtags.kafkaCluster, promtags.ack).Inc()
+	}
+}
+
+func LossRatio(topic string, ratio float64) {
+	if prom.enabled {
+		messagesLossRatio.WithLabelValues(topic, promtags.podName, promtags.deployment,
+			promtags.kafkaCluster, promtags.ack).Set(ratio)
+	}
+}
+
+func SentMessage(msg creator.Message, topic string) {
+	if prom.enabled {
+		messagesSent.WithLabelValues(topic, promtags.podName, promtags.deployment,
+			promtags.kafkaCluster, promtags.ack).Inc()
+	}
+}
+
+func ConsumerLatency(dur time.Duration, topic string) {
 	if prom.enabled {
 		ms := dur / time.Millisecond
-		consumeLatency.WithLabelValues(promtags.topic, promtags.podName, promtags.deployment,
+		consumeLatency.WithLabelValues(topic, promtags.podName, promtags.deployment,
 			promtags.kafkaCluster, promtags.ack).Observe(float64(ms))
 	}
 }
@@ -116,10 +226,10 @@ func ConsumerMessageReadTime(dur time.Duration) {
 	}
 }
 
-func ProduceLatency(dur time.Duration) {
+func ProduceLatency(dur time.Duration, topic string) {
 	if prom.enabled {
 		ms := dur / time.Millisecond
-		produceLatency.WithLabelValues(promtags.topic, promtags.podName, promtags.deployment,
+		produceLatency.WithLabelValues(topic, promtags.podName, promtags.deployment,
 			promtags.kafkaCluster, promtags.ack).Observe(float64(ms))
 	}
 }
@@ -152,6 +262,104 @@ func ConsumerChannelLength(count int) {
 	}
 }
 
+func CallbackQueueLength(count int) {
+	if prom.enabled {
+		consumerCallbackQueueLength.WithLabelValues(promtags.topic, promtags.podName, promtags.deployment,
+			promtags.kafkaCluster, promtags.ack).Set(float64(count))
+	}
+}
+
+func CommitLatency(strategy string, dur time.Duration) {
+	if prom.enabled {
+		ms := dur / time.Millisecond
+		consumerCommitLatency.WithLabelValues(promtags.topic, promtags.podName, promtags.deployment,
+			promtags.kafkaCluster, promtags.ack, strategy).Observe(float64(ms))
+	}
+}
+
+func CommitFailure(strategy string) {
+	if prom.enabled {
+		consumerCommitFailures.WithLabelValues(promtags.topic, promtags.podName, promtags.deployment,
+			promtags.kafkaCluster, promtags.ack, strategy).Inc()
+	}
+}
+
+// InjectedFault counts the faults injected in the consumers by kind
+func InjectedFault(fault string) {
+	if prom.enabled {
+		consumerInjectedFaults.WithLabelValues(promtags.topic, promtags.podName, promtags.deployment,
+			promtags.kafkaCluster, promtags.ack, fault).Inc()
+	}
+}
+
+// ProduceError counts the errors surfaced to the producer, labelled by the fault injected in the message
+func ProduceError(fault, err string) {
+	if prom.enabled {
+		producerErrors.WithLabelValues(promtags.topic, promtags.podName, promtags.deployment,
+			promtags.kafkaCluster, promtags.ack, fault, err).Inc()
+	}
+}
+
+// ProxyFault counts the connection resets and partitions injected by the proxy
+func ProxyFault(fault string) {
+	if prom.enabled {
+		proxyInjectedFaults.WithLabelValues(promtags.topic, promtags.podName, promtags.deployment,
+			promtags.kafkaCluster, promtags.ack, fault).Inc()
+	}
+}
+
+// MirrorLag observes the time from the append to the source until the message is consumed from the mirror
+func MirrorLag(topic string, partition int32, dur time.Duration) {
+	if prom.enabled {
+		ms := dur / time.Millisecond
+		mirrorReplicationLag.WithLabelValues(topic, promtags.podName, promtags.deployment, promtags.kafkaCluster,
+			promtags.ack, strconv.Itoa(int(partition))).Observe(float64(ms))
+	}
+}
+
+// Rebalance counts the assignment and revocation events of the consumers
+func Rebalance(event string) {
+	if prom.enabled {
+		consumerRebalances.WithLabelValues(promtags.topic, promtags.podName, promtags.deployment,
+			promtags.kafkaCluster, promtags.ack, event).Inc()
+	}
+}
+
+func RebalanceDuration(dur time.Duration) {
+	if prom.enabled {
+		ms := dur / time.Millisecond
+		consumerRebalanceDuration.WithLabelValues(promtags.topic, promtags.podName, promtags.deployment,
+			promtags.kafkaCluster, promtags.ack).Observe(float64(ms))
+	}
+}
+
+func AssignedPartitions(consumer int, count int) {
+	if prom.enabled {
+		consumerAssignedPartitions.WithLabelValues(promtags.topic, promtags.podName, promtags.deployment,
+			promtags.kafkaCluster, promtags.ack, strconv.Itoa(consumer)).Set(float64(count))
+	}
+}
+
+func PartitionState(topic string, partition int32, leader int32, isrSize int, underReplicated, offline bool) {
+	if prom.enabled {
+		labels := []string{topic, promtags.podName, promtags.deployment, promtags.kafkaCluster, promtags.ack,
+			strconv.Itoa(int(partition))}
+		partitionISRSize.WithLabelValues(labels...).Set(float64(isrSize))
+		partitionLeader.WithLabelValues(labels...).Set(float64(leader))
+		partitionUnderReplicated.WithLabelValues(labels...).Set(flag(underReplicated))
+		partitionOffline.WithLabelValues(labels...).Set(flag(offline))
+	}
+}
+
+func flag(b bool) float64 {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+var setupOnce sync.Once
+
 func Setup(cfg config.Prometheus, producerCfg config.Producer) {
 	defer func() {
 		if err := recover(); err != nil {
@@ -162,27 +370,47 @@ func Setup(cfg config.Prometheus, producerCfg config.Producer) {
 	promtags = promTags{topic: producerCfg.Topic, ack: strconv.Itoa(producerCfg.Acks),
 		kafkaCluster: producerCfg.ClusterName, podName: cfg.PodName, deployment: cfg.Deployment}
 	prom = promClient{enabled: cfg.Enabled, port: cfg.Port}
+	// runs started through the control api set up the tags again, metrics are served once per process
 	if cfg.Enabled {
+		setupOnce.Do(func() {
+			prometheus.MustRegister(messagesSent)
+			prometheus.MustRegister(messagesReceived)
+			prometheus.MustRegister(messagesCorrupted)
+			prometheus.MustRegister(messagesHeaderMismatch)
+			prometheus.MustRegister(messagesLost)
+			prometheus.MustRegister(messagesLossRatio)
+			prometheus.MustRegister(consumeLatency)
+			prometheus.MustRegister(produceLatency)
+			prometheus.MustRegister(producerCount)
+			prometheus.MustRegister(consumerCount)
+			prometheus.MustRegister(producerChannelCount)
+			prometheus.MustRegister(consumerMessageProcessingTime)
+			prometheus.MustRegister(consumerMessageReadTime)
+			prometheus.MustRegister(consumerProcessingChannelLength)
+			prometheus.MustRegister(consumerCallbackQueueLength)
+			prometheus.MustRegister(consumerCommitLatency)
+			prometheus.MustRegister(consumerCommitFailures)
+			prometheus.MustRegister(consumerInjectedFaults)
+			prometheus.MustRegister(producerErrors)
+			prometheus.MustRegister(proxyInjectedFaults)
+			prometheus.MustRegister(mirrorReplicationLag)
+			prometheus.MustRegister(consumerRebalances)
+			prometheus.MustRegister(consumerRebalanceDuration)
+			prometheus.MustRegister(consumerAssignedPartitions)
+			prometheus.MustRegister(partitionISRSize)
+			prometheus.MustRegister(partitionLeader)
+			prometheus.MustRegister(partitionUnderReplicated)
+			prometheus.MustRegister(partitionOffline)
 
-		prometheus.MustRegister(messagesSent)
-		prometheus.MustRegister(messagesReceived)
-		prometheus.MustRegister(consumeLatency)
-		prometheus.MustRegister(produceLatency)
-		prometheus.MustRegister(producerCount)
-		prometheus.MustRegister(consumerCount)
-		prometheus.MustRegister(producerChannelCount)
-		prometheus.MustRegister(consumerMessageProcessingTime)
-		prometheus.MustRegister(consumerMessageReadTime)
-		prometheus.MustRegister(consumerProcessingChannelLength)
-
-		mux := http.NewServeMux()
-		mux.Handle("/metrics", promhttp.Handler())
-		go func() {
-			err := http.ListenAndServe(cfg.BindPort(), mux)
-			if err != nil {
-				logger.Errorf("Error while binding to %s port, %v", cfg.BindPort(), err)
-			}
-		}()
-		logger.Debugf("Enabled prometheus at /metris port: %s", cfg.BindPort())
+			mux := http.NewServeMux()
+			mux.Handle("/metrics", promhttp.Handler())
+			go func() {
+				err := http.ListenAndServe(cfg.BindPort(), mux)
+				if err != nil {
+					logger.Errorf("Error while binding to %s port, %v", cfg.BindPort(), err)
+				}
+			}()
+			logger.Debugf("Enabled prometheus at /metris port: %s", cfg.BindPort())
+		})
 	}
 }
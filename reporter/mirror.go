@@ -0,0 +1,56 @@
+package reporter
+
+import (
+	"bytes"
+	"strconv"
+
+	"github.com/olekukonko/tablewriter"
+)
+
+// MirrorPartition is the replication of a source partition to its mirrored topic, messages
+// delivered to the source and not consumed from the mirror by the end of the run are lost,
+// the ones consumed without being delivered by the run are duplicates
+type MirrorPartition struct {
+	SourceTopic string `json:"source_topic"`
+	TargetTopic string `json:"target_topic"`
+	Partition   int32  `json:"partition"`
+	Delivered   int64  `json:"delivered"`
+	Mirrored    int64  `json:"mirrored"`
+	Lost        int64  `json:"lost"`
+	Duplicates  int64  `json:"duplicates"`
+	MaxLagMs    int64  `json:"max_lag_ms"`
+	AvgLagMs    int64  `json:"avg_lag_ms"`
+}
+
+type MirrorReport struct {
+	Partitions []MirrorPartition `json:"partitions"`
+}
+
+func (r *MirrorReport) rows() [][]string {
+	var lost, duplicates, maxLag int64
+	for _, p := range r.Partitions {
+		lost += p.Lost
+		duplicates += p.Duplicates
+		if p.MaxLagMs > maxLag {
+			maxLag = p.MaxLagMs
+		}
+	}
+	return [][]string{
+		{"9", "Mirror Messages Lost", strconv.FormatInt(lost, 10)},
+		{"9", "Mirror Messages Duplicated", strconv.FormatInt(duplicates, 10)},
+		{"9", "Max Replication Lag Millis", strconv.FormatInt(maxLag, 10)},
+	}
+}
+
+func (r *MirrorReport) String() string {
+	buf := bytes.NewBufferString("")
+	table := tablewriter.NewWriter(buf)
+	table.SetHeader([]string{"Source", "Target", "Partition", "Delivered", "Mirrored", "Lost", "Duplicates", "Max Lag Ms", "Avg Lag Ms"})
+	for _, p := range r.Partitions {
+		table.Append([]string{p.SourceTopic, p.TargetTopic, strconv.Itoa(int(p.Partition)),
+			strconv.FormatInt(p.Delivered, 10), strconv.FormatInt(p.Mirrored, 10), strconv.FormatInt(p.Lost, 10), strconv.FormatInt(p.Duplicates, 10),
+			strconv.FormatInt(p.MaxLagMs, 10), strconv.FormatInt(p.AvgLagMs, 10)})
+	}
+	table.Render()
+	return buf.String()
+}
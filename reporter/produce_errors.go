@@ -0,0 +1,54 @@
+package reporter
+
+import (
+	"bytes"
+	"sort"
+	"strconv"
+
+	"github.com/olekukonko/tablewriter"
+)
+
+// NoFault labels the produce errors of messages without an injected fault
+const NoFault = "none"
+
+// ProduceErrorReport counts the errors surfaced to the producer by the fault injected and error
+type ProduceErrorReport struct {
+	Errors map[string]map[string]int64 `json:"errors"`
+}
+
+func (r *ProduceErrorReport) total() int64 {
+	var total int64
+	for _, errs := range r.Errors {
+		for _, n := range errs {
+			total += n
+		}
+	}
+	return total
+}
+
+func (r *ProduceErrorReport) rows() [][]string {
+	return [][]string{{"8", "Producer Errors", strconv.FormatInt(r.total(), 10)}}
+}
+
+func (r *ProduceErrorReport) String() string {
+	buf := bytes.NewBufferString("")
+	table := tablewriter.NewWriter(buf)
+	table.SetHeader([]string{"Fault", "Error", "Count"})
+	faults := make([]string, 0, len(r.Errors))
+	for fault := range r.Errors {
+		faults = append(faults, fault)
+	}
+	sort.Strings(faults)
+	for _, fault := range faults {
+		errs := make([]string, 0, len(r.Errors[fault]))
+		for e := range r.Errors[fault] {
+			errs = append(errs, e)
+		}
+		sort.Strings(errs)
+		for _, e := range errs {
+			table.Append([]string{fault, e, strconv.FormatInt(r.Errors[fault][e], 10)})
+		}
+	}
+	table.Render()
+	return buf.String()
+}
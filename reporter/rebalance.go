@@ -0,0 +1,56 @@
+package reporter
+
+import (
+	"bytes"
+	"strconv"
+	"time"
+
+	"github.com/olekukonko/tablewriter"
+)
+
+// RebalanceWindow is the period a consumer had no partitions assigned,
+// from the revocation (or subscription) until the next assignment
+type RebalanceWindow struct {
+	Consumer int       `json:"consumer"`
+	Start    time.Time `json:"start"`
+	End      time.Time `json:"end"`
+	Revoked  int       `json:"revoked"`
+	Assigned int       `json:"assigned"`
+}
+
+func (w RebalanceWindow) Duration() time.Duration {
+	return w.End.Sub(w.Start)
+}
+
+type RebalanceReport struct {
+	Windows []RebalanceWindow `json:"windows"`
+}
+
+func (r *RebalanceReport) maxDuration() time.Duration {
+	var max time.Duration
+	for _, w := range r.Windows {
+		if d := w.Duration(); d > max {
+			max = d
+		}
+	}
+	return max
+}
+
+func (r *RebalanceReport) rows() [][]string {
+	return [][]string{
+		{"7", "Consumer Rebalances", strconv.Itoa(len(r.Windows))},
+		{"7", "Max Rebalance Duration", r.maxDuration().String()},
+	}
+}
+
+func (r *RebalanceReport) String() string {
+	buf := bytes.NewBufferString("")
+	table := tablewriter.NewWriter(buf)
+	table.SetHeader([]string{"Consumer", "Start", "End", "Duration", "Revoked", "Assigned"})
+	for _, w := range r.Windows {
+		table.Append([]string{strconv.Itoa(w.Consumer), w.Start.Format("15:04:05.000"), w.End.Format("15:04:05.000"),
+			w.Duration().String(), strconv.Itoa(w.Revoked), strconv.Itoa(w.Assigned)})
+	}
+	table.Render()
+	return buf.String()
+}
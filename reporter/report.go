@@ -2,15 +2,35 @@ package reporter
 
 import (
 	"bytes"
+	"fmt"
+	"sort"
 	"strconv"
 	"time"
 
+	"github.com/gojek/kafqa/cluster"
 	"github.com/olekukonko/tablewriter"
 )
 
 type Report struct {
-	Messages
-	Time
+	Messages `json:"messages"`
+	Time     `json:"time"`
+	Topics   map[string]TopicReport `json:"topics,omitempty"`
+	Cluster  *ClusterReport         `json:"cluster,omitempty"`
+	Lost     *LostReport            `json:"lost,omitempty"`
+	// consumer rebalances, used to correlate latency spikes and duplicates
+	Rebalances *RebalanceReport `json:"rebalances,omitempty"`
+	// errors surfaced to the producer, by the fault injected
+	ProduceErrors *ProduceErrorReport `json:"producer_errors,omitempty"`
+	// replication lag and loss by source partition in mirror mode
+	Mirror *MirrorReport `json:"mirror,omitempty"`
+	// instances and latency percentiles of a distributed run
+	Distributed *DistributedReport `json:"distributed,omitempty"`
+}
+
+type TopicReport struct {
+	Messages       `json:"messages"`
+	MinConsumption uint32 `json:"min_consumption_ms"`
+	MaxConsumption uint32 `json:"max_consumption_ms"`
 }
 
 func (r *Report) String() string {
@@ -18,10 +38,37 @@ func (r *Report) String() string {
 		{"1", "Messages Lost", strconv.FormatInt(r.Messages.Lost, 10)},
 		{"2", "Messages Sent", strconv.FormatInt(r.Messages.Sent, 10)},
 		{"3", "Messages Received", strconv.FormatInt(r.Messages.Received, 10)},
+		{"3", "Messages Corrupted", strconv.FormatInt(r.Messages.Corrupted, 10)},
+		{"3", "Messages Header Mismatch", strconv.FormatInt(r.Messages.HeaderMismatch, 10)},
 		{"3", "Min Consumption Latency Millis", strconv.FormatUint(uint64(r.Time.MinConsumption), 10)},
 		{"3", "Max Consumption Latency Millis", strconv.FormatUint(uint64(r.Time.MaxConsumption), 10)},
 		{"3", "App Run Time", r.Time.AppRun.String()},
 	}
+	if r.Messages.Dropped > 0 {
+		data = append(data, []string{"3", "Messages Dropped By Store", strconv.FormatInt(r.Messages.Dropped, 10)})
+	}
+	// breakdown is only useful when running against multiple topics
+	if len(r.Topics) > 1 {
+		data = append(data, r.topicRows()...)
+	}
+	if r.Cluster != nil {
+		data = append(data, r.Cluster.rows()...)
+	}
+	if r.Lost != nil {
+		data = append(data, r.Lost.rows()...)
+	}
+	if r.Rebalances != nil {
+		data = append(data, r.Rebalances.rows()...)
+	}
+	if r.ProduceErrors != nil {
+		data = append(data, r.ProduceErrors.rows()...)
+	}
+	if r.Mirror != nil {
+		data = append(data, r.Mirror.rows()...)
+	}
+	if r.Distributed != nil {
+		data = append(data, r.Distributed.rows()...)
+	}
 	buf := bytes.NewBufferString("")
 	table := tablewriter.NewWriter(buf)
 	table.SetHeader([]string{"", "  Description    ", "Value"})
@@ -29,17 +76,96 @@ func (r *Report) String() string {
 		table.Append(v)
 	}
 	table.Render()
+	if r.Cluster != nil && len(r.Cluster.Changes) > 0 {
+		buf.WriteString("Cluster Changes:\n")
+		buf.WriteString(r.Cluster.String())
+	}
+	if r.Lost != nil && len(r.Lost.Ranges) > 0 {
+		buf.WriteString("Lost Messages:\n")
+		buf.WriteString(r.Lost.String())
+	}
+	if r.Rebalances != nil && len(r.Rebalances.Windows) > 0 {
+		buf.WriteString("Rebalance Windows:\n")
+		buf.WriteString(r.Rebalances.String())
+	}
+	if r.ProduceErrors != nil && len(r.ProduceErrors.Errors) > 0 {
+		buf.WriteString("Producer Errors:\n")
+		buf.WriteString(r.ProduceErrors.String())
+	}
+	if r.Mirror != nil && len(r.Mirror.Partitions) > 0 {
+		buf.WriteString("Mirrored Partitions:\n")
+		buf.WriteString(r.Mirror.String())
+	}
 	return buf.String()
 }
 
+func (r *Report) topicRows() [][]string {
+	var topics []string
+	for t := range r.Topics {
+		topics = append(topics, t)
+	}
+	sort.Strings(topics)
+	var data [][]string
+	for _, t := range topics {
+		tr := r.Topics[t]
+		data = append(data,
+			[]string{"4", fmt.Sprintf("[%s] Messages Lost", t), strconv.FormatInt(tr.Lost, 10)},
+			[]string{"4", fmt.Sprintf("[%s] Messages Sent", t), strconv.FormatInt(tr.Sent, 10)},
+			[]string{"4", fmt.Sprintf("[%s] Messages Received", t), strconv.FormatInt(tr.Received, 10)},
+			[]string{"4", fmt.Sprintf("[%s] Min Consumption Latency Millis", t), strconv.FormatUint(uint64(tr.MinConsumption), 10)},
+			[]string{"4", fmt.Sprintf("[%s] Max Consumption Latency Millis", t), strconv.FormatUint(uint64(tr.MaxConsumption), 10)},
+		)
+	}
+	return data
+}
+
 type Messages struct {
-	Lost     int64
-	Sent     int64
-	Received int64
+	Lost           int64 `json:"lost"`
+	Sent           int64 `json:"sent"`
+	Received       int64 `json:"received"`
+	Corrupted      int64 `json:"corrupted"`
+	HeaderMismatch int64 `json:"header_mismatch"`
+	// ids the store dropped instead of tracking or acknowledging them, the counts above miss them
+	Dropped int64 `json:"dropped_by_store,omitempty"`
 }
 
 type Time struct {
-	MinConsumption uint32
-	MaxConsumption uint32
-	AppRun         time.Duration
+	MinConsumption uint32        `json:"min_consumption_ms"`
+	MaxConsumption uint32        `json:"max_consumption_ms"`
+	AppRun         time.Duration `json:"app_run_ns"`
+}
+
+type ClusterReport struct {
+	Changes         []cluster.Change `json:"changes"`
+	OfflineReplicas int              `json:"offline_replicas"`
+}
+
+func (c *ClusterReport) count(kind cluster.ChangeKind) int {
+	var n int
+	for _, ch := range c.Changes {
+		if ch.Kind == kind {
+			n++
+		}
+	}
+	return n
+}
+
+func (c *ClusterReport) rows() [][]string {
+	return [][]string{
+		{"5", "Leadership Changes", strconv.Itoa(c.count(cluster.LeaderChange))},
+		{"5", "ISR Changes", strconv.Itoa(c.count(cluster.ISRChange))},
+		{"5", "Broker Changes", strconv.Itoa(c.count(cluster.BrokerChange))},
+		{"5", "Offline Replicas", strconv.Itoa(c.OfflineReplicas)},
+	}
+}
+
+func (c *ClusterReport) String() string {
+	buf := bytes.NewBufferString("")
+	table := tablewriter.NewWriter(buf)
+	table.SetHeader([]string{"Change", "Subject", "Before", "After"})
+	for _, ch := range c.Changes {
+		table.Append([]string{string(ch.Kind), ch.Subject(), ch.Before, ch.After})
+	}
+	table.Render()
+	return buf.String()
 }
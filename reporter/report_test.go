@@ -0,0 +1,191 @@
+package reporter
+
+import (
+	"testing"
+	"time"
+
+	"github.com/gojek/kafqa/config"
+	"github.com/gojek/kafqa/store"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestShouldReportTopicBreakdownForMultipleTopics(t *testing.T) {
+	latency := NewLatencyReporter(5)
+	latency.Push(20)
+	report := Report{Topics: topicReports(
+		map[string]store.Result{"topic_a": {Tracked: 10, Acknowledged: 8}, "topic_b": {Tracked: 5, Acknowledged: 5}},
+		map[string]*Latency{"topic_a": latency},
+	)}
+
+	out := report.String()
+
+	assert.Contains(t, out, "[topic_a] Messages Lost")
+	assert.Contains(t, out, "[topic_b] Messages Received")
+	assert.Equal(t, TopicReport{Messages: Messages{Sent: 10, Received: 8, Lost: 2}, MinConsumption: 20, MaxConsumption: 20},
+		report.Topics["topic_a"])
+}
+
+func TestShouldNotReportTopicBreakdownForSingleTopic(t *testing.T) {
+	report := Report{Topics: topicReports(map[string]store.Result{"topic_a": {Tracked: 10}}, nil)}
+
+	assert.NotContains(t, report.String(), "[topic_a]")
+}
+
+func TestShouldReportRebalanceWindows(t *testing.T) {
+	start := time.Date(2019, 8, 1, 14, 2, 0, 0, time.UTC)
+	report := Report{Rebalances: &RebalanceReport{Windows: []RebalanceWindow{
+		{Consumer: 0, Start: start, End: start.Add(2 * time.Second), Revoked: 3, Assigned: 2},
+		{Consumer: 1, Start: start, End: start.Add(5 * time.Second), Assigned: 1},
+	}}}
+
+	out := report.String()
+
+	assert.Contains(t, out, "Rebalance Windows:")
+	assert.Contains(t, out, "14:02:05.000")
+	assert.Equal(t, 5*time.Second, report.Rebalances.maxDuration())
+}
+
+func TestShouldReportProduceErrorsByFault(t *testing.T) {
+	active = &reporter{}
+	ProduceError("oversized", "Broker: Message size too large")
+	ProduceError("oversized", "Broker: Message size too large")
+	ProduceError("", "Local: Message timed out")
+	report := Report{ProduceErrors: &ProduceErrorReport{Errors: active.produceErrors}}
+
+	out := report.String()
+
+	assert.Contains(t, out, "Producer Errors:")
+	assert.Contains(t, out, "Local: Message timed out")
+	assert.Equal(t, int64(2), report.ProduceErrors.Errors["oversized"]["Broker: Message size too large"])
+	assert.Equal(t, int64(1), report.ProduceErrors.Errors[NoFault]["Local: Message timed out"])
+	assert.Equal(t, int64(3), report.ProduceErrors.total())
+}
+
+func TestShouldReportMirroredPartitions(t *testing.T) {
+	report := Report{Mirror: &MirrorReport{Partitions: []MirrorPartition{
+		{SourceTopic: "orders", TargetTopic: "source.orders", Partition: 0, Delivered: 10, Mirrored: 8, Lost: 2, MaxLagMs: 1200, AvgLagMs: 300},
+		{SourceTopic: "orders", TargetTopic: "source.orders", Partition: 1, Delivered: 5, Mirrored: 5, MaxLagMs: 900, AvgLagMs: 200},
+	}}}
+
+	out := report.String()
+
+	assert.Contains(t, out, "Mirrored Partitions:")
+	assert.Contains(t, out, "source.orders")
+	assert.Contains(t, out, "Mirror Messages Lost")
+	assert.Contains(t, out, "1200")
+}
+
+func TestShouldAggregateResultsOfInstances(t *testing.T) {
+	first, second := NewHistogram(), NewHistogram()
+	first.Observe(10)
+	second.Observe(300)
+	report := Report{Messages: Messages{Sent: 10, Received: 10, Corrupted: 1}}
+	results := []InstanceResult{
+		{ID: "pod-1", Corrupted: 2, Latency: first, TopicLatency: map[string]*Histogram{"orders": first},
+			ProduceErrors: map[string]map[string]int64{NoFault: {"Local: Message timed out": 1}}},
+		{ID: "pod-2", Corrupted: 1, Latency: second, TopicLatency: map[string]*Histogram{"orders": second},
+			ProduceErrors: map[string]map[string]int64{NoFault: {"Local: Message timed out": 2}}},
+	}
+
+	aggregate(&report, results, []string{"pod-3"})
+
+	assert.Equal(t, int64(3), report.Messages.Corrupted)
+	assert.Equal(t, uint32(10), report.Time.MinConsumption)
+	assert.Equal(t, uint32(300), report.Time.MaxConsumption)
+	assert.Equal(t, uint32(300), report.Topics["orders"].MaxConsumption)
+	assert.Equal(t, int64(3), report.ProduceErrors.Errors[NoFault]["Local: Message timed out"])
+	assert.Equal(t, []string{"pod-1", "pod-2"}, report.Distributed.Instances)
+	assert.Contains(t, report.String(), "pod-3")
+}
+
+func TestShouldReportZeroLatencyWhenNoInstanceConsumed(t *testing.T) {
+	report := Report{}
+
+	aggregate(&report, []InstanceResult{{ID: "pod-1", Latency: NewHistogram(),
+		TopicLatency: map[string]*Histogram{"orders": NewHistogram()}}}, nil)
+
+	assert.Equal(t, uint32(0), report.Time.MinConsumption)
+	assert.Equal(t, uint32(0), report.Topics["orders"].MinConsumption)
+}
+
+type closingStore struct {
+	closed bool
+}
+
+func (cs *closingStore) Result() store.Result {
+	if cs.closed {
+		panic("result of a closed store")
+	}
+	return store.Result{Tracked: 3, Acknowledged: 2}
+}
+
+func (cs *closingStore) Close() error {
+	cs.closed = true
+	return nil
+}
+
+func TestShouldNotReportLiveOnceStoreIsClosed(t *testing.T) {
+	cs := &closingStore{}
+	active = &reporter{srep: cs, Latency: NewLatencyReporter(1), topicLatency: make(map[string]*Latency)}
+
+	report, err := Live()
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), report.Messages.Lost)
+
+	require.NoError(t, CloseStore(cs))
+	_, err = Live()
+	assert.Equal(t, ErrStoreClosed, err)
+}
+
+type windowedStore struct {
+	closingStore
+}
+
+func (ws *windowedStore) Lost() int64 {
+	return 0
+}
+
+func TestShouldReportLostMessagesCountedByTheStore(t *testing.T) {
+	active = &reporter{srep: &windowedStore{}, Latency: NewLatencyReporter(1), topicLatency: make(map[string]*Latency)}
+
+	report := build()
+
+	assert.Equal(t, int64(3), report.Messages.Sent)
+	assert.Equal(t, int64(2), report.Messages.Received)
+	assert.Equal(t, int64(0), report.Messages.Lost)
+}
+
+type droppingStore struct {
+	closingStore
+}
+
+func (ds *droppingStore) Dropped() int64 {
+	return 4
+}
+
+func TestShouldReportIDsDroppedByTheStore(t *testing.T) {
+	active = &reporter{srep: &droppingStore{}, Latency: NewLatencyReporter(1), topicLatency: make(map[string]*Latency)}
+
+	report := build()
+
+	assert.Equal(t, int64(4), report.Messages.Dropped)
+	assert.Contains(t, report.String(), "Messages Dropped By Store")
+}
+
+func TestShouldReportLiveWhileNextRunIsSetUp(t *testing.T) {
+	Setup(&closingStore{}, 1, config.Reporter{}, config.Producer{})
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 100; i++ {
+			Setup(&closingStore{}, 1, config.Reporter{}, config.Producer{})
+		}
+	}()
+
+	for i := 0; i < 100; i++ {
+		_, err := Live()
+		require.NoError(t, err)
+	}
+	<-done
+}
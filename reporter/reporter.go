@@ -1,10 +1,18 @@
 package reporter
 
 import (
+	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
+	"sync"
+	"sync/atomic"
 	"time"
 
+	"github.com/gojek/kafqa/cluster"
 	"github.com/gojek/kafqa/config"
+	"github.com/gojek/kafqa/logger"
+	"github.com/gojek/kafqa/reconcile"
 	"github.com/gojek/kafqa/reporter/metrics"
 	"github.com/gojek/kafqa/reporter/pprof"
 	"github.com/gojek/kafqa/store"
@@ -14,43 +22,297 @@ type storeReporter interface {
 	Result() store.Result
 }
 
+// lossCounter is a store deciding itself which messages are lost, eg: the windowed store once past the deadline
+type lossCounter interface {
+	Lost() int64
+}
+
+// dropCounter is a store dropping ids it couldn't write, eg: the redis store over its buffer during an outage
+type dropCounter interface {
+	Dropped() int64
+}
+
 type reporter struct {
 	*Latency
-	srep  storeReporter
-	start time.Time
+	topicLatency   map[string]*Latency
+	histogram      *Histogram
+	topicHistogram map[string]*Histogram
+	latencyMu      sync.Mutex
+	maxNLatency    int
+	srep           storeReporter
+	start          time.Time
+	corrupted      int64
+	headerMismatch int64
+	config         config.Report
+	// guards the reports set at the end of the run, and the store from being read once closed
+	mu            sync.Mutex
+	cluster       *ClusterReport
+	reconciled    map[string]reconcile.Status
+	mirror        *MirrorReport
+	storeClosed   bool
+	rebalanceMu   sync.Mutex
+	rebalances    []RebalanceWindow
+	produceErrMu  sync.Mutex
+	produceErrors map[string]map[string]int64
+}
+
+var (
+	activeMu sync.RWMutex
+	// reporter of the current run, replaced by Setup
+	active = &reporter{}
+)
+
+// current is the reporter of the current run
+func current() *reporter {
+	activeMu.RLock()
+	defer activeMu.RUnlock()
+	return active
 }
 
-var rep reporter
+var pprofOnce sync.Once
+
+// ErrStoreClosed is returned by the live report once the run closed its store
+var ErrStoreClosed = errors.New("store of the run is closed")
 
 func Setup(sr storeReporter, maxNLatency int, cfg config.Reporter, producerCfg config.Producer) {
-	rep = reporter{
-		srep:    sr,
-		Latency: NewLatencyReporter(maxNLatency),
-		start:   time.Now(),
+	rep := &reporter{
+		srep:           sr,
+		Latency:        NewLatencyReporter(maxNLatency),
+		topicLatency:   make(map[string]*Latency),
+		histogram:      NewHistogram(),
+		topicHistogram: make(map[string]*Histogram),
+		maxNLatency:    maxNLatency,
+		start:          time.Now(),
+		config:         cfg.Report,
 	}
+	activeMu.Lock()
+	active = rep
+	activeMu.Unlock()
 	metrics.Setup(cfg.Prometheus, producerCfg)
 	if cfg.PProf.Enabled {
-		pprof.StartServer(cfg.PProf.Port)
+		pprofOnce.Do(func() { pprof.StartServer(cfg.PProf.Port) })
 	}
 }
 
-func ConsumptionDelay(t time.Duration) {
-	tms := t / time.Millisecond
-	rep.Latency.Push(uint32(tms))
+func ConsumptionDelay(t time.Duration, topic string) {
+	rep := current()
+	tms := uint32(t / time.Millisecond)
+	rep.latencyMu.Lock()
+	defer rep.latencyMu.Unlock()
+
+	rep.Latency.Push(tms)
+	lt, ok := rep.topicLatency[topic]
+	if !ok {
+		lt = NewLatencyReporter(rep.maxNLatency)
+		rep.topicLatency[topic] = lt
+	}
+	lt.Push(tms)
+	rep.histogram.Observe(tms)
+	ht, ok := rep.topicHistogram[topic]
+	if !ok {
+		ht = NewHistogram()
+		rep.topicHistogram[topic] = ht
+	}
+	ht.Observe(tms)
+}
+
+func CorruptedMessage() {
+	rep := current()
+	atomic.AddInt64(&rep.corrupted, 1)
+}
+
+func HeaderMismatch() {
+	rep := current()
+	atomic.AddInt64(&rep.headerMismatch, 1)
+}
+
+func ClusterChanges(start, end cluster.Snapshot) {
+	rep := current()
+	report := &ClusterReport{
+		Changes:         cluster.Diff(start, end),
+		OfflineReplicas: end.OfflineReplicas(),
+	}
+	rep.mu.Lock()
+	defer rep.mu.Unlock()
+	rep.cluster = report
+}
+
+// Rebalance records a window in which a consumer was rebalancing
+func Rebalance(w RebalanceWindow) {
+	rep := current()
+	rep.rebalanceMu.Lock()
+	defer rep.rebalanceMu.Unlock()
+	rep.rebalances = append(rep.rebalances, w)
+}
+
+// ProduceError records an error surfaced to the producer for a message, labelled by the fault injected
+func ProduceError(fault, err string) {
+	rep := current()
+	if fault == "" {
+		fault = NoFault
+	}
+	rep.produceErrMu.Lock()
+	defer rep.produceErrMu.Unlock()
+	if rep.produceErrors == nil {
+		rep.produceErrors = make(map[string]map[string]int64)
+	}
+	if rep.produceErrors[fault] == nil {
+		rep.produceErrors[fault] = make(map[string]int64)
+	}
+	rep.produceErrors[fault][err]++
+}
+
+// Mirror sets the replication of the produced topics to their mirrors
+func Mirror(report *MirrorReport) {
+	rep := current()
+	rep.mu.Lock()
+	defer rep.mu.Unlock()
+	rep.mirror = report
+}
+
+// Reconciliation sets the broker side status of the lost messages by message id
+func Reconciliation(statuses map[string]reconcile.Status) {
+	rep := current()
+	rep.mu.Lock()
+	defer rep.mu.Unlock()
+	rep.reconciled = statuses
+}
+
+// CloseStore closes the store of the run once no report reads it, the live report isn't available after
+func CloseStore(closer io.Closer) error {
+	rep := current()
+	rep.mu.Lock()
+	defer rep.mu.Unlock()
+	rep.storeClosed = true
+	return closer.Close()
+}
+
+// LostTraces returns the unacknowledged traces when the store keeps their offsets
+func LostTraces() ([]store.Trace, bool, error) {
+	rep := current()
+	tl, ok := rep.srep.(traceLister)
+	if !ok {
+		return nil, false, nil
+	}
+	if mk, ok := rep.srep.(metadataKeeper); ok && !mk.KeepsMetadata() {
+		return nil, false, nil
+	}
+	traces, err := tl.UnacknowledgedTraces()
+	return traces, true, err
 }
 
 func GenerateReport() {
+	report := build()
+	listLost(&report)
+	output(report)
+}
+
+// Live reports the run in progress, the messages not acknowledged yet aren't listed as they may be in flight
+func Live() (Report, error) {
+	rep := current()
+	rep.mu.Lock()
+	defer rep.mu.Unlock()
+	if rep.storeClosed {
+		return Report{}, ErrStoreClosed
+	}
+	return buildLocked(rep), nil
+}
+
+// build reports the store results along with the ones kept by this instance
+func build() Report {
+	rep := current()
+	rep.mu.Lock()
+	defer rep.mu.Unlock()
+	return buildLocked(rep)
+}
+
+// buildLocked builds the report holding rep.mu
+func buildLocked(rep *reporter) Report {
 	var report Report
 	sres := rep.srep.Result()
 	report.Messages = Messages{
-		Sent:     sres.Tracked,
-		Received: sres.Acknowledged,
-		Lost:     sres.Tracked - sres.Acknowledged,
+		Sent:           sres.Tracked,
+		Received:       sres.Acknowledged,
+		Lost:           sres.Tracked - sres.Acknowledged,
+		Corrupted:      atomic.LoadInt64(&rep.corrupted),
+		HeaderMismatch: atomic.LoadInt64(&rep.headerMismatch),
 	}
+	if lc, ok := rep.srep.(lossCounter); ok {
+		report.Messages.Lost = lc.Lost()
+	}
+	if dc, ok := rep.srep.(dropCounter); ok {
+		report.Messages.Dropped = dc.Dropped()
+	}
+	rep.latencyMu.Lock()
 	report.Time = Time{
 		MinConsumption: rep.Latency.Min(),
 		MaxConsumption: rep.Latency.Max(),
 		AppRun:         time.Since(rep.start),
 	}
+	report.Topics = topicReports(sres.Topics, rep.topicLatency)
+	rep.latencyMu.Unlock()
+	report.Cluster = rep.cluster
+	report.Mirror = rep.mirror
+	rep.rebalanceMu.Lock()
+	if len(rep.rebalances) > 0 {
+		report.Rebalances = &RebalanceReport{Windows: append([]RebalanceWindow{}, rep.rebalances...)}
+	}
+	rep.rebalanceMu.Unlock()
+	rep.produceErrMu.Lock()
+	if len(rep.produceErrors) > 0 {
+		report.ProduceErrors = &ProduceErrorReport{Errors: make(map[string]map[string]int64)}
+		for fault, errs := range rep.produceErrors {
+			report.ProduceErrors.Errors[fault] = make(map[string]int64)
+			for e, n := range errs {
+				report.ProduceErrors.Errors[fault][e] = n
+			}
+		}
+	}
+	rep.produceErrMu.Unlock()
+	return report
+}
+
+func listLost(report *Report) {
+	rep := current()
+	if report.Messages.Lost > 0 {
+		traces, ok, err := LostTraces()
+		if err != nil {
+			logger.Errorf("error fetching lost messages: %v", err)
+		} else if ok {
+			rep.mu.Lock()
+			reconciled := rep.reconciled
+			rep.mu.Unlock()
+			report.Lost = lostReport(traces, rep.config.LostLimit, reconciled)
+		}
+	}
+}
+
+func output(report Report) {
+	rep := current()
+	if rep.config.JSON() {
+		out, err := json.MarshalIndent(report, "", "  ")
+		if err != nil {
+			logger.Errorf("error generating json report: %v", err)
+			return
+		}
+		fmt.Println(string(out))
+		return
+	}
 	fmt.Printf("Report:\n%s\n", report.String())
 }
+
+func topicReports(results map[string]store.Result, latencies map[string]*Latency) map[string]TopicReport {
+	reports := make(map[string]TopicReport)
+	for topic, res := range results {
+		tr := reports[topic]
+		tr.Messages = Messages{Sent: res.Tracked, Received: res.Acknowledged, Lost: res.Tracked - res.Acknowledged}
+		reports[topic] = tr
+	}
+	for topic, lt := range latencies {
+		tr := reports[topic]
+		tr.MinConsumption = lt.Min()
+		tr.MaxConsumption = lt.Max()
+		reports[topic] = tr
+	}
+	return reports
+}
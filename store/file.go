@@ -0,0 +1,316 @@
+package store
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gojek/kafqa/creator"
+	"github.com/gojek/kafqa/logger"
+	"gopkg.in/confluentinc/confluent-kafka-go.v1/kafka"
+)
+
+const (
+	trackRecord = "t"
+	ackRecord   = "a"
+	countRecord = "c"
+)
+
+// File persists tracked and acknowledged ids in an append only journal,
+// the journal is replayed and compacted on open so a restarted run resumes reconciliation.
+// Track records keep the partition, offset, sequence and created time of the message to list lost ranges.
+type File struct {
+	sync.Mutex
+	TraceID
+	path    string
+	file    *os.File
+	writer  *bufio.Writer
+	pending map[string]Trace
+	res     Result
+	topics  map[string]*Result
+
+	exit chan struct{}
+	wg   sync.WaitGroup
+}
+
+func (fs *File) Track(msg Trace) error {
+	fs.Lock()
+	defer fs.Unlock()
+
+	trace := journalTrace(fs.TraceID(msg), msg)
+	if err := fs.write(trackFields(trace)...); err != nil {
+		return err
+	}
+	fs.track(trace)
+	return nil
+}
+
+func (fs *File) Acknowledge(msg Trace) error {
+	fs.Lock()
+	defer fs.Unlock()
+
+	id, topic := fs.TraceID(msg), msg.TopicName()
+	if err := fs.write(ackRecord, topic, id); err != nil {
+		return err
+	}
+	fs.acknowledge(id, topic)
+	return nil
+}
+
+func (fs *File) track(trace Trace) {
+	fs.res.Tracked++
+	fs.topicResult(trace.TopicName()).Tracked++
+	fs.pending[trace.ID] = trace
+}
+
+func (fs *File) acknowledge(id, topic string) {
+	fs.res.Acknowledged++
+	fs.topicResult(topic).Acknowledged++
+	delete(fs.pending, id)
+}
+
+func (fs *File) write(fields ...string) error {
+	_, err := fs.writer.WriteString(strings.Join(fields, "\t") + "\n")
+	return err
+}
+
+func (fs *File) Unacknowledged() ([]string, error) {
+	fs.Lock()
+	defer fs.Unlock()
+
+	msgs := make([]string, 0, len(fs.pending))
+	for id := range fs.pending {
+		msgs = append(msgs, id)
+	}
+	return msgs, nil
+}
+
+// UnacknowledgedTraces returns the pending traces with the topic, partition, offset, sequence and created time
+// of the message, other fields of the message aren't stored
+func (fs *File) UnacknowledgedTraces() ([]Trace, error) {
+	fs.Lock()
+	defer fs.Unlock()
+
+	traces := make([]Trace, 0, len(fs.pending))
+	for _, trace := range fs.pending {
+		traces = append(traces, trace)
+	}
+	return traces, nil
+}
+
+// journalTrace keeps the fields of the message persisted in its track record
+func journalTrace(id string, msg Trace) Trace {
+	topic := msg.TopicName()
+	return Trace{
+		Message:        creator.Message{ID: id, Sequence: msg.Sequence, CreatedTime: msg.CreatedTime},
+		TopicPartition: kafka.TopicPartition{Topic: &topic, Partition: msg.Partition, Offset: msg.Offset},
+	}
+}
+
+func trackFields(trace Trace) []string {
+	return []string{
+		trackRecord, trace.TopicName(), trace.ID,
+		strconv.FormatInt(int64(trace.Partition), 10),
+		strconv.FormatInt(int64(trace.Offset), 10),
+		strconv.FormatUint(trace.Sequence, 10),
+		strconv.FormatInt(unixNano(trace.CreatedTime), 10),
+	}
+}
+
+// unixNano of the zero time is 0 so it's read back as the zero time
+func unixNano(t time.Time) int64 {
+	if t.IsZero() {
+		return 0
+	}
+	return t.UnixNano()
+}
+
+// parseTrack reads a track record, records of journals written before offsets were kept only have the id
+func parseTrack(fields []string) (Trace, error) {
+	var msg Trace
+	msg.TopicPartition.Topic = &fields[1]
+	if len(fields) == 3 {
+		return journalTrace(fields[2], msg), nil
+	}
+	partition, err := strconv.ParseInt(fields[3], 10, 32)
+	if err != nil {
+		return msg, err
+	}
+	offset, err := strconv.ParseInt(fields[4], 10, 64)
+	if err != nil {
+		return msg, err
+	}
+	if msg.Sequence, err = strconv.ParseUint(fields[5], 10, 64); err != nil {
+		return msg, err
+	}
+	created, err := strconv.ParseInt(fields[6], 10, 64)
+	if err != nil {
+		return msg, err
+	}
+	msg.Partition, msg.Offset = int32(partition), kafka.Offset(offset)
+	if created != 0 {
+		msg.CreatedTime = time.Unix(0, created)
+	}
+	return journalTrace(fields[2], msg), nil
+}
+
+func (fs *File) Result() Result {
+	fs.Lock()
+	defer fs.Unlock()
+
+	res := Result{Tracked: fs.res.Tracked, Acknowledged: fs.res.Acknowledged, Topics: make(map[string]Result, len(fs.topics))}
+	for t, r := range fs.topics {
+		res.Topics[t] = *r
+	}
+	return res
+}
+
+// Sync flushes the buffered records and commits the journal to disk
+func (fs *File) Sync() error {
+	fs.Lock()
+	defer fs.Unlock()
+
+	if err := fs.writer.Flush(); err != nil {
+		return err
+	}
+	return fs.file.Sync()
+}
+
+func (fs *File) run(interval time.Duration) {
+	defer fs.wg.Done()
+	ticker := time.NewTicker(interval)
+	for {
+		select {
+		case <-ticker.C:
+			if err := fs.Sync(); err != nil {
+				logger.Errorf("error syncing store file %s: %v", fs.path, err)
+			}
+		case <-fs.exit:
+			ticker.Stop()
+			return
+		}
+	}
+}
+
+func (fs *File) Close() error {
+	close(fs.exit)
+	fs.wg.Wait()
+	if err := fs.Sync(); err != nil {
+		return err
+	}
+	return fs.file.Close()
+}
+
+func (fs *File) topicResult(topic string) *Result {
+	r, ok := fs.topics[topic]
+	if !ok {
+		r = &Result{}
+		fs.topics[topic] = r
+	}
+	return r
+}
+
+// replay applies the journal records, an incomplete last record of a crashed run is skipped
+func (fs *File) replay(r io.Reader) error {
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		fields := strings.Split(scanner.Text(), "\t")
+		switch {
+		case (len(fields) == 3 || len(fields) == 7) && fields[0] == trackRecord:
+			trace, err := parseTrack(fields)
+			if err != nil {
+				logger.Errorf("skipping invalid record in store file %s: %s", fs.path, scanner.Text())
+				continue
+			}
+			fs.track(trace)
+		case len(fields) == 3 && fields[0] == ackRecord:
+			fs.acknowledge(fields[2], fields[1])
+		case len(fields) == 4 && fields[0] == countRecord:
+			tracked, terr := strconv.ParseInt(fields[2], 10, 64)
+			acked, aerr := strconv.ParseInt(fields[3], 10, 64)
+			if terr != nil || aerr != nil {
+				logger.Errorf("skipping invalid record in store file %s: %s", fs.path, scanner.Text())
+				continue
+			}
+			fs.res.Tracked += tracked
+			fs.res.Acknowledged += acked
+			fs.topicResult(fields[1]).Tracked += tracked
+			fs.topicResult(fields[1]).Acknowledged += acked
+		default:
+			logger.Errorf("skipping invalid record in store file %s: %s", fs.path, scanner.Text())
+		}
+	}
+	return scanner.Err()
+}
+
+// compact rewrites the journal with only the counts and pending traces
+func (fs *File) compact() error {
+	tmp := fs.path + ".tmp"
+	f, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+	fs.file, fs.writer = f, bufio.NewWriter(f)
+	// pending ids are counted again when their track records are replayed
+	pending := make(map[string]int64)
+	for _, trace := range fs.pending {
+		pending[trace.TopicName()]++
+	}
+	for topic, r := range fs.topics {
+		err := fs.write(countRecord, topic, strconv.FormatInt(r.Tracked-pending[topic], 10), strconv.FormatInt(r.Acknowledged, 10))
+		if err != nil {
+			f.Close()
+			return err
+		}
+	}
+	for _, trace := range fs.pending {
+		if err := fs.write(trackFields(trace)...); err != nil {
+			f.Close()
+			return err
+		}
+	}
+	if err := fs.writer.Flush(); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	return os.Rename(tmp, fs.path)
+}
+
+// NewFile opens the store at path resuming from the existing journal, records are synced to disk every interval
+func NewFile(path string, ti TraceID, interval time.Duration) (*File, error) {
+	fs := &File{
+		TraceID: ti,
+		path:    path,
+		pending: make(map[string]Trace, 1000),
+		topics:  make(map[string]*Result),
+		exit:    make(chan struct{}),
+	}
+	existing, err := os.Open(path)
+	switch {
+	case err == nil:
+		err = fs.replay(existing)
+		existing.Close()
+		if err != nil {
+			return nil, fmt.Errorf("error reading store file %s: %v", path, err)
+		}
+	case !os.IsNotExist(err):
+		return nil, fmt.Errorf("error opening store file %s: %v", path, err)
+	}
+	if err := fs.compact(); err != nil {
+		return nil, fmt.Errorf("error compacting store file %s: %v", path, err)
+	}
+	logger.Infof("resumed store file %s with %d tracked, %d acknowledged messages", path, fs.res.Tracked, fs.res.Acknowledged)
+
+	fs.wg.Add(1)
+	go fs.run(interval)
+	return fs, nil
+}
@@ -0,0 +1,128 @@
+package store_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/gojek/kafqa/creator"
+	"github.com/gojek/kafqa/logger"
+	"github.com/gojek/kafqa/store"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gopkg.in/confluentinc/confluent-kafka-go.v1/kafka"
+)
+
+func init() {
+	logger.Setup("none")
+}
+
+func fileTrace(topic, id string) store.Trace {
+	return store.Trace{Message: creator.Message{ID: id}, TopicPartition: kafka.TopicPartition{Topic: &topic}}
+}
+
+func tempStorePath(t *testing.T) (string, func()) {
+	dir, err := ioutil.TempDir("", "kafqa-store")
+	require.NoError(t, err)
+	return filepath.Join(dir, "kafqa.store"), func() { os.RemoveAll(dir) }
+}
+
+func TestFileStoreShouldResumeAfterRestart(t *testing.T) {
+	path, cleanup := tempStorePath(t)
+	defer cleanup()
+	msgID := func(t store.Trace) string { return t.Message.ID }
+
+	fs, err := store.NewFile(path, msgID, time.Hour)
+	require.NoError(t, err)
+	require.NoError(t, fs.Track(fileTrace("a", "1")))
+	require.NoError(t, fs.Track(fileTrace("a", "2")))
+	require.NoError(t, fs.Track(fileTrace("b", "3")))
+	require.NoError(t, fs.Acknowledge(fileTrace("a", "1")))
+	require.NoError(t, fs.Close())
+
+	resumed, err := store.NewFile(path, msgID, time.Hour)
+	require.NoError(t, err)
+	defer resumed.Close()
+	require.NoError(t, resumed.Acknowledge(fileTrace("b", "3")))
+
+	pending, err := resumed.Unacknowledged()
+	require.NoError(t, err)
+	assert.Equal(t, []string{"2"}, pending)
+	assert.Equal(t, store.Result{Tracked: 3, Acknowledged: 2, Topics: map[string]store.Result{
+		"a": {Tracked: 2, Acknowledged: 1},
+		"b": {Tracked: 1, Acknowledged: 1},
+	}}, resumed.Result())
+}
+
+func TestFileStoreShouldCompactJournalOnOpen(t *testing.T) {
+	path, cleanup := tempStorePath(t)
+	defer cleanup()
+	msgID := func(t store.Trace) string { return t.Message.ID }
+	fs, err := store.NewFile(path, msgID, time.Hour)
+	require.NoError(t, err)
+	require.NoError(t, fs.Track(fileTrace("a", "1")))
+	require.NoError(t, fs.Track(fileTrace("a", "2")))
+	require.NoError(t, fs.Acknowledge(fileTrace("a", "1")))
+	require.NoError(t, fs.Close())
+
+	resumed, err := store.NewFile(path, msgID, time.Hour)
+	require.NoError(t, err)
+	require.NoError(t, resumed.Close())
+
+	content, err := ioutil.ReadFile(path)
+	require.NoError(t, err)
+	assert.Equal(t, "c\ta\t1\t1\nt\ta\t2\t0\t0\t0\t0\n", string(content))
+}
+
+func TestFileStoreShouldSkipIncompleteRecords(t *testing.T) {
+	path, cleanup := tempStorePath(t)
+	defer cleanup()
+	require.NoError(t, ioutil.WriteFile(path, []byte("t\ta\t1\nt\ta\t2\na\ta"), 0644))
+
+	fs, err := store.NewFile(path, func(t store.Trace) string { return t.Message.ID }, time.Hour)
+	require.NoError(t, err)
+	defer fs.Close()
+
+	pending, err := fs.Unacknowledged()
+	require.NoError(t, err)
+	sort.Strings(pending)
+	assert.Equal(t, []string{"1", "2"}, pending)
+	assert.Equal(t, int64(2), fs.Result().Tracked)
+}
+
+func TestFileStoreShouldListUnacknowledgedTracesAfterRestart(t *testing.T) {
+	path, cleanup := tempStorePath(t)
+	defer cleanup()
+	msgID := func(t store.Trace) string { return t.Message.ID }
+	created := time.Unix(1570000000, 42)
+	topic := "a"
+	msg := store.Trace{
+		Message:        creator.Message{ID: "1", Sequence: 7, CreatedTime: created, Data: []byte("data")},
+		TopicPartition: kafka.TopicPartition{Topic: &topic, Partition: 2, Offset: 15},
+	}
+
+	fs, err := store.NewFile(path, msgID, time.Hour)
+	require.NoError(t, err)
+	require.NoError(t, fs.Track(msg))
+	require.NoError(t, fs.Track(fileTrace("a", "2")))
+	require.NoError(t, fs.Acknowledge(fileTrace("a", "2")))
+	require.NoError(t, fs.Close())
+
+	resumed, err := store.NewFile(path, msgID, time.Hour)
+	require.NoError(t, err)
+	defer resumed.Close()
+
+	traces, err := resumed.UnacknowledgedTraces()
+	require.NoError(t, err)
+	require.Len(t, traces, 1)
+	assert.Equal(t, "1", traces[0].ID)
+	assert.Equal(t, uint64(7), traces[0].Sequence)
+	assert.True(t, created.Equal(traces[0].CreatedTime))
+	assert.Equal(t, "a", traces[0].TopicName())
+	assert.Equal(t, int32(2), traces[0].Partition)
+	assert.Equal(t, kafka.Offset(15), traces[0].Offset)
+	assert.Nil(t, traces[0].Data)
+}
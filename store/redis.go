@@ -1,64 +1,574 @@
 package store
 
 import (
+	"crypto/tls"
 	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
 
 	"github.com/go-redis/redis"
+	"github.com/gojek/kafqa/creator"
+	"github.com/gojek/kafqa/logger"
+	"gopkg.in/confluentinc/confluent-kafka-go.v1/kafka"
+)
+
+const (
+	tracked = "tracked"
+	acked   = "acked"
+)
+
+// addIDs adds the ids in ARGV to the set, counting the newly added ones by the topic following each id,
+// so that a batch written again after a failure doesn't count an id twice or skip its count
+var addIDs = redis.NewScript(`
+local added = 0
+for i = 1, #ARGV, 2 do
+	if redis.call('SADD', KEYS[1], ARGV[i]) == 1 then
+		redis.call('HINCRBY', KEYS[2], ARGV[i+1], 1)
+		added = added + 1
+	end
+end
+return added
+`)
+
+const (
+	RedisSingle   = "single"
+	RedisSentinel = "sentinel"
+	RedisCluster  = "cluster"
 )
 
 type Redis struct {
 	TraceID
 	namespace string
-	redisdb   *redis.Client
+	redisdb   redis.UniversalClient
+	conn      connection
+
+	batchSize     int
+	flushInterval time.Duration
+	ttl           time.Duration
+	expireAfter   time.Duration
+	cleanup       bool
+	maxPending    int
+	metadata      bool
+
+	mu      sync.Mutex
+	pending []entry
+	// ids dropped from pending once over maxPending, while redis couldn't be written to
+	dropped int64
+	exit    chan struct{}
+	wg      sync.WaitGroup
+}
+
+type connection struct {
+	mode     string
+	addrs    []string
+	master   string
+	user     string
+	password string
+	db       int
+	tls      *tls.Config
+}
+
+type entry struct {
+	kind  string
+	id    string
+	topic string
+	at    time.Time
+	trace Trace
+}
+
+type RedisOption func(*Redis)
+
+// Batch buffers writes and flushes them in a pipeline when size is reached or every interval
+func Batch(size int, interval time.Duration) RedisOption {
+	return func(rs *Redis) {
+		rs.batchSize = size
+		rs.flushInterval = interval
+	}
+}
+
+// TTL expires the keys of the run when they aren't written to for ttl
+func TTL(ttl time.Duration) RedisOption {
+	return func(rs *Redis) { rs.ttl = ttl }
+}
+
+// ExpireAfter removes ids tracked before the window, they're only counted in the result from then on
+func ExpireAfter(window time.Duration) RedisOption {
+	return func(rs *Redis) { rs.expireAfter = window }
+}
+
+// CleanupOnClose deletes the keys of the run on Close
+func CleanupOnClose() RedisOption {
+	return func(rs *Redis) { rs.cleanup = true }
+}
+
+// Metadata keeps the topic, partition, offset, sequence and created time of the tracked ids, to list the lost messages
+func Metadata() RedisOption {
+	return func(rs *Redis) { rs.metadata = true }
+}
+
+// MaxPending bounds the ids buffered while redis can't be written to, the oldest are dropped beyond it
+func MaxPending(n int) RedisOption {
+	return func(rs *Redis) { rs.maxPending = n }
+}
+
+// Auth authenticates with the password, and the ACL user when given
+func Auth(user, password string) RedisOption {
+	return func(rs *Redis) {
+		rs.conn.user = user
+		rs.conn.password = password
+	}
+}
+
+func DB(db int) RedisOption {
+	return func(rs *Redis) { rs.conn.db = db }
+}
+
+func TLS(cfg *tls.Config) RedisOption {
+	return func(rs *Redis) { rs.conn.tls = cfg }
+}
+
+// Sentinel connects to the master through the sentinels at addrs
+func Sentinel(master string, addrs ...string) RedisOption {
+	return func(rs *Redis) {
+		rs.conn.mode = RedisSentinel
+		rs.conn.master = master
+		rs.conn.addrs = addrs
+	}
+}
+
+// Cluster connects to a redis cluster seeded by addrs, keys of the run share a hash slot
+func Cluster(addrs ...string) RedisOption {
+	return func(rs *Redis) {
+		rs.conn.mode = RedisCluster
+		rs.conn.addrs = addrs
+	}
+}
+
+// onConnect authenticates the ACL user then selects the db, the client would select it before OnConnect
+func (c connection) onConnect(conn *redis.Conn) error {
+	if err := conn.Process(redis.NewStatusCmd("auth", c.user, c.password)); err != nil {
+		return err
+	}
+	if c.db == 0 {
+		return nil
+	}
+	return conn.Process(redis.NewStatusCmd("select", c.db))
+}
+
+func (c connection) client() redis.UniversalClient {
+	password, db := c.password, c.db
+	var onConnect func(*redis.Conn) error
+	// AUTH with only password is sent by the client, ACL user needs both
+	if c.user != "" {
+		password, db = "", 0
+		onConnect = c.onConnect
+	}
+	switch c.mode {
+	case RedisSentinel:
+		return redis.NewFailoverClient(&redis.FailoverOptions{
+			MasterName:    c.master,
+			SentinelAddrs: c.addrs,
+			OnConnect:     onConnect,
+			Password:      password,
+			DB:            db,
+			TLSConfig:     c.tls,
+		})
+	case RedisCluster:
+		return redis.NewClusterClient(&redis.ClusterOptions{
+			Addrs:     c.addrs,
+			OnConnect: onConnect,
+			Password:  password,
+			TLSConfig: c.tls,
+		})
+	}
+	return redis.NewClient(&redis.Options{
+		Addr:      c.addrs[0],
+		OnConnect: onConnect,
+		Password:  password,
+		DB:        db,
+		TLSConfig: c.tls,
+	})
+}
+
+// Client is the connection to redis, shared by the instances coordinating the run
+func (rs *Redis) Client() redis.UniversalClient {
+	return rs.redisdb
+}
+
+// Namespace prefixes the keys of the run
+func (rs *Redis) Namespace() string {
+	return rs.namespace
+}
+
+// KeyTTL expires the keys of the run, 0 keeps them
+func (rs *Redis) KeyTTL() time.Duration {
+	return rs.ttl
+}
+
+// CleansUp is whether the keys of the run are deleted on Close
+func (rs *Redis) CleansUp() bool {
+	return rs.cleanup
+}
+
+// KeepsMetadata is whether the lost messages can be listed with their offsets
+func (rs *Redis) KeepsMetadata() bool {
+	return rs.metadata
+}
+
+// KeepOnClose leaves the keys of the run on Close, for the instance reporting a distributed run to delete them
+func (rs *Redis) KeepOnClose() {
+	rs.cleanup = false
 }
 
 func (rs *Redis) keyFor(kind string) string {
 	return fmt.Sprintf("%s:%s:ids", rs.namespace, kind)
 }
 
+func (rs *Redis) topicsKeyFor(kind string) string {
+	return fmt.Sprintf("%s:%s:topics", rs.namespace, kind)
+}
+
+func (rs *Redis) timesKey() string {
+	return fmt.Sprintf("%s:tracked:times", rs.namespace)
+}
+
+func (rs *Redis) metaKey() string {
+	return fmt.Sprintf("%s:tracked:meta", rs.namespace)
+}
+
+func (rs *Redis) expiredKey() string {
+	return fmt.Sprintf("%s:expired", rs.namespace)
+}
+
+// expiredIDsKey keeps the ids expired in the last loss window by expiry time, so their late acks aren't counted
+func (rs *Redis) expiredIDsKey() string {
+	return fmt.Sprintf("%s:expired:ids", rs.namespace)
+}
+
+func (rs *Redis) keys() []string {
+	return []string{rs.keyFor(tracked), rs.keyFor(acked), rs.topicsKeyFor(tracked), rs.topicsKeyFor(acked),
+		rs.timesKey(), rs.metaKey(), rs.expiredKey(), rs.expiredIDsKey()}
+}
+
 func (rs *Redis) Acknowledge(msg Trace) error {
-	cmd := rs.redisdb.SAdd(rs.keyFor("acked"), rs.TraceID(msg))
-	return cmd.Err()
+	return rs.add(acked, msg)
 }
 
 func (rs *Redis) Track(msg Trace) error {
-	cmd := rs.redisdb.SAdd(rs.keyFor("tracked"), rs.TraceID(msg))
-	return cmd.Err()
+	return rs.add(tracked, msg)
+}
+
+func (rs *Redis) add(kind string, msg Trace) error {
+	rs.mu.Lock()
+	rs.pending = append(rs.pending, entry{kind: kind, id: rs.TraceID(msg), topic: msg.TopicName(), at: time.Now(), trace: msg})
+	if len(rs.pending) < rs.batchSize {
+		rs.mu.Unlock()
+		return nil
+	}
+	batch := rs.pending
+	rs.pending = nil
+	rs.mu.Unlock()
+	return rs.write(batch)
+}
+
+// Flush writes the buffered ids to redis
+func (rs *Redis) Flush() error {
+	rs.mu.Lock()
+	batch := rs.pending
+	rs.pending = nil
+	rs.mu.Unlock()
+	return rs.write(batch)
+}
+
+// requeue buffers a batch which failed to be written again, to be retried on the next flush.
+// The oldest ids are dropped beyond maxPending, so an outage doesn't grow the buffer unbounded
+func (rs *Redis) requeue(batch []entry) {
+	rs.mu.Lock()
+	defer rs.mu.Unlock()
+	rs.pending = append(batch, rs.pending...)
+	if rs.maxPending <= 0 || len(rs.pending) <= rs.maxPending {
+		return
+	}
+	n := len(rs.pending) - rs.maxPending
+	rs.pending = append([]entry{}, rs.pending[n:]...)
+	rs.dropped += int64(n)
+	logger.Errorf("dropped %d ids buffered over the max of %d, %d dropped in total", n, rs.maxPending, rs.dropped)
+}
+
+// Dropped is the number of ids dropped while redis couldn't be written to, they aren't counted in the result
+func (rs *Redis) Dropped() int64 {
+	rs.mu.Lock()
+	defer rs.mu.Unlock()
+	return rs.dropped
+}
+
+func (rs *Redis) write(batch []entry) error {
+	batch, err := rs.withoutExpired(batch)
+	if err != nil {
+		rs.requeue(batch)
+		return fmt.Errorf("error checking expired ids, %d ids requeued: %v", len(batch), err)
+	}
+	if len(batch) == 0 {
+		return nil
+	}
+	pipe := rs.redisdb.Pipeline()
+	ids := make(map[string][]interface{})
+	for _, e := range batch {
+		ids[e.kind] = append(ids[e.kind], e.id, e.topic)
+		if e.kind == tracked && rs.metadata {
+			pipe.HSet(rs.metaKey(), e.id, encodeMeta(e))
+		}
+		if e.kind == tracked && rs.expireAfter > 0 {
+			pipe.ZAdd(rs.timesKey(), redis.Z{Score: float64(e.at.UnixNano() / int64(time.Millisecond)), Member: e.id})
+		}
+	}
+	for kind, args := range ids {
+		addIDs.Eval(pipe, []string{rs.keyFor(kind), rs.topicsKeyFor(kind)}, args...)
+	}
+	if rs.ttl > 0 {
+		for _, key := range rs.keys() {
+			pipe.Expire(key, rs.ttl)
+		}
+	}
+	if _, err := pipe.Exec(); err != nil {
+		rs.requeue(batch)
+		return fmt.Errorf("error writing ids, %d ids requeued: %v", len(batch), err)
+	}
+	return nil
+}
+
+// withoutExpired drops the acks of ids already expired, they're counted as lost and
+// acking them again would count them as acknowledged too
+func (rs *Redis) withoutExpired(batch []entry) ([]entry, error) {
+	if rs.expireAfter <= 0 {
+		return batch, nil
+	}
+	pipe := rs.redisdb.Pipeline()
+	scores := make(map[int]*redis.FloatCmd)
+	for i, e := range batch {
+		if e.kind == acked {
+			scores[i] = pipe.ZScore(rs.expiredIDsKey(), e.id)
+		}
+	}
+	if len(scores) == 0 {
+		return batch, nil
+	}
+	if _, err := pipe.Exec(); err != nil && err != redis.Nil {
+		return batch, err
+	}
+	kept := batch[:0:0]
+	for i, e := range batch {
+		if cmd, ok := scores[i]; ok && cmd.Err() == nil {
+			logger.Debugf("skipping ack of expired id %s", e.id)
+			continue
+		}
+		kept = append(kept, e)
+	}
+	return kept, nil
+}
+
+// expire removes the ids tracked before the loss window from both sets and counts them as expired
+func (rs *Redis) expire(now time.Time) error {
+	cutoff := (now.Add(-rs.expireAfter)).UnixNano() / int64(time.Millisecond)
+	ids, err := rs.redisdb.ZRangeByScore(rs.timesKey(), redis.ZRangeBy{Min: "-inf", Max: strconv.FormatInt(cutoff, 10)}).Result()
+	if err != nil || len(ids) == 0 {
+		return err
+	}
+	members := make([]interface{}, len(ids))
+	for i, id := range ids {
+		members[i] = id
+	}
+	pipe := rs.redisdb.TxPipeline()
+	removedTracked := pipe.SRem(rs.keyFor(tracked), members...)
+	removedAcked := pipe.SRem(rs.keyFor(acked), members...)
+	pipe.ZRem(rs.timesKey(), members...)
+	pipe.HDel(rs.metaKey(), ids...)
+	expiredAt := make([]redis.Z, len(ids))
+	for i, id := range ids {
+		expiredAt[i] = redis.Z{Score: float64(now.UnixNano() / int64(time.Millisecond)), Member: id}
+	}
+	pipe.ZAdd(rs.expiredIDsKey(), expiredAt...)
+	pipe.ZRemRangeByScore(rs.expiredIDsKey(), "-inf", strconv.FormatInt(cutoff, 10))
+	if _, err := pipe.Exec(); err != nil {
+		return err
+	}
+	pipe = rs.redisdb.Pipeline()
+	pipe.HIncrBy(rs.expiredKey(), tracked, removedTracked.Val())
+	pipe.HIncrBy(rs.expiredKey(), acked, removedAcked.Val())
+	_, err = pipe.Exec()
+	return err
+}
+
+func (rs *Redis) run() {
+	defer rs.wg.Done()
+	ticker := time.NewTicker(rs.flushInterval)
+	for {
+		select {
+		case now := <-ticker.C:
+			if err := rs.Flush(); err != nil {
+				logger.Errorf("error flushing ids to redis: %v", err)
+			}
+			if rs.expireAfter > 0 {
+				if err := rs.expire(now); err != nil {
+					logger.Errorf("error expiring ids from redis: %v", err)
+				}
+			}
+		case <-rs.exit:
+			ticker.Stop()
+			return
+		}
+	}
 }
 
 func (rs *Redis) Unacknowledged() ([]string, error) {
-	cmd := rs.redisdb.SDiff(rs.keyFor("tracked"), rs.keyFor("acked"))
+	if err := rs.Flush(); err != nil {
+		return nil, err
+	}
+	cmd := rs.redisdb.SDiff(rs.keyFor(tracked), rs.keyFor(acked))
 	return cmd.Val(), cmd.Err()
 }
 
+// UnacknowledgedTraces returns the pending traces with the topic, partition, offset, sequence and created time
+// of the message, other fields of the message aren't stored
+func (rs *Redis) UnacknowledgedTraces() ([]Trace, error) {
+	ids, err := rs.Unacknowledged()
+	if err != nil || len(ids) == 0 {
+		return nil, err
+	}
+	metas, err := rs.redisdb.HMGet(rs.metaKey(), ids...).Result()
+	if err != nil {
+		return nil, err
+	}
+	traces := make([]Trace, len(ids))
+	for i, id := range ids {
+		meta, _ := metas[i].(string)
+		traces[i] = decodeMeta(id, meta)
+	}
+	return traces, nil
+}
+
+func encodeMeta(e entry) string {
+	return strings.Join([]string{
+		strconv.FormatInt(int64(e.trace.Partition), 10),
+		strconv.FormatInt(int64(e.trace.Offset), 10),
+		strconv.FormatUint(e.trace.Sequence, 10),
+		strconv.FormatInt(e.trace.CreatedTime.UnixNano(), 10),
+		e.topic,
+	}, ":")
+}
+
+func decodeMeta(id, meta string) Trace {
+	trace := Trace{Message: creator.Message{ID: id}}
+	fields := strings.SplitN(meta, ":", 5)
+	if len(fields) != 5 {
+		return trace
+	}
+	partition, _ := strconv.ParseInt(fields[0], 10, 32)
+	offset, _ := strconv.ParseInt(fields[1], 10, 64)
+	created, _ := strconv.ParseInt(fields[3], 10, 64)
+	trace.Sequence, _ = strconv.ParseUint(fields[2], 10, 64)
+	trace.CreatedTime = time.Unix(0, created)
+	trace.TopicPartition = kafka.TopicPartition{Topic: &fields[4], Partition: int32(partition), Offset: kafka.Offset(offset)}
+	return trace
+}
+
 func (rs *Redis) Result() Result {
-	cmd := rs.redisdb.SCard(rs.keyFor("tracked"))
+	if err := rs.Flush(); err != nil {
+		logger.Errorf("error flushing ids to redis: %v", err)
+	}
+	cmd := rs.redisdb.SCard(rs.keyFor(tracked))
 	if cmd.Err() != nil {
 		return Result{}
 	}
 	numTracked := cmd.Val()
-	cmd = rs.redisdb.SCard(rs.keyFor("acked"))
+	cmd = rs.redisdb.SCard(rs.keyFor(acked))
 	if cmd.Err() != nil {
 		return Result{}
 	}
 	numAcked := cmd.Val()
-	return Result{Tracked: numTracked, Acknowledged: numAcked}
+	expired, err := rs.redisdb.HGetAll(rs.expiredKey()).Result()
+	if err != nil {
+		return Result{}
+	}
+	expiredTracked, _ := strconv.ParseInt(expired[tracked], 10, 64)
+	expiredAcked, _ := strconv.ParseInt(expired[acked], 10, 64)
+	return Result{Tracked: numTracked + expiredTracked, Acknowledged: numAcked + expiredAcked, Topics: rs.topicResults()}
 }
 
-func NewRedis(redisaddr, namespace string, ti TraceID) (*Redis, error) {
-	cli := redis.NewClient(&redis.Options{
-		Addr:     redisaddr,
-		Password: "",
-		DB:       0,
-	})
+func (rs *Redis) topicResults() map[string]Result {
+	trackedTopics, err := rs.redisdb.HGetAll(rs.topicsKeyFor(tracked)).Result()
+	if err != nil {
+		return nil
+	}
+	ackedTopics, err := rs.redisdb.HGetAll(rs.topicsKeyFor(acked)).Result()
+	if err != nil {
+		return nil
+	}
+	results := make(map[string]Result, len(trackedTopics))
+	for topic, count := range trackedTopics {
+		r := results[topic]
+		r.Tracked, _ = strconv.ParseInt(count, 10, 64)
+		results[topic] = r
+	}
+	for topic, count := range ackedTopics {
+		r := results[topic]
+		r.Acknowledged, _ = strconv.ParseInt(count, 10, 64)
+		results[topic] = r
+	}
+	return results
+}
+
+// Close flushes the buffered ids and deletes the keys of the run when cleanup is enabled
+func (rs *Redis) Close() error {
+	if rs.exit != nil {
+		close(rs.exit)
+		rs.wg.Wait()
+	}
+	defer rs.redisdb.Close()
+	if err := rs.Flush(); err != nil {
+		return err
+	}
+	if rs.cleanup {
+		return rs.Clear()
+	}
+	return nil
+}
+
+// Clear deletes the ids and counts of the run, eg: left by an earlier run with the same id
+func (rs *Redis) Clear() error {
+	return rs.redisdb.Del(rs.keys()...).Err()
+}
+
+func NewRedis(redisaddr, namespace string, ti TraceID, opts ...RedisOption) (*Redis, error) {
 	redisCli := &Redis{
 		namespace: namespace,
-		redisdb:   cli,
 		TraceID:   ti,
+		batchSize: 1,
+		conn:      connection{mode: RedisSingle, addrs: []string{redisaddr}},
+	}
+	for _, opt := range opts {
+		opt(redisCli)
 	}
+	if redisCli.conn.mode == RedisCluster {
+		// multi key commands in cluster need all the keys in the same slot
+		redisCli.namespace = fmt.Sprintf("{%s}", namespace)
+	}
+	cli := redisCli.conn.client()
+	redisCli.redisdb = cli
 	_, err := cli.Ping().Result()
 	if err != nil {
+		cli.Close()
 		return nil, err
 	}
+	if redisCli.batchSize > 1 || redisCli.expireAfter > 0 {
+		if redisCli.flushInterval <= 0 {
+			redisCli.flushInterval = time.Second
+		}
+		redisCli.exit = make(chan struct{})
+		redisCli.wg.Add(1)
+		go redisCli.run()
+	}
 	return redisCli, nil
 }
@@ -1,9 +1,12 @@
 package store_test
 
 import (
+	"sync"
 	"testing"
+	"time"
 
 	"github.com/alicebob/miniredis"
+	"github.com/alicebob/miniredis/server"
 	"github.com/go-redis/redis"
 	"github.com/gojek/kafqa/creator"
 	"github.com/gojek/kafqa/store"
@@ -98,6 +101,53 @@ func (s *RedisSuite) TestRedisShouldRemoveAcknowledgedMessages() {
 	}
 }
 
+func (s *RedisSuite) TestShouldReturnUnacknowledgedTracesWithMetadata() {
+	t := s.T()
+	topic := "kafkqa_redis_store"
+	created := time.Unix(1564668120, 0)
+	trace := store.Trace{Message: creator.Message{ID: "5", Sequence: 42, CreatedTime: created},
+		TopicPartition: kafka.TopicPartition{Topic: &topic, Partition: 7, Offset: 10234}}
+	rs := s.newStore(store.Metadata())
+	defer rs.Close()
+	require.NoError(t, rs.Track(trace))
+	for _, m := range s.messages {
+		require.NoError(t, rs.Track(m))
+		require.NoError(t, rs.Acknowledge(m))
+	}
+
+	traces, err := rs.UnacknowledgedTraces()
+
+	require.NoError(t, err)
+	require.Len(t, traces, 1)
+	assert.Equal(t, "5", traces[0].Message.ID)
+	assert.Equal(t, uint64(42), traces[0].Sequence)
+	assert.True(t, created.Equal(traces[0].CreatedTime))
+	assert.Equal(t, topic, traces[0].TopicName())
+	assert.Equal(t, int32(7), traces[0].Partition)
+	assert.Equal(t, kafka.Offset(10234), traces[0].Offset)
+}
+
+func (s *RedisSuite) TestShouldNotKeepMetadataUnlessAsked() {
+	t := s.T()
+	rs := s.newStore()
+	defer rs.Close()
+
+	require.NoError(t, rs.Track(s.messages[0]))
+
+	assert.False(t, rs.KeepsMetadata())
+	assert.True(t, s.mr.Exists("batched:tracked:ids"))
+	assert.False(t, s.mr.Exists("batched:tracked:meta"))
+}
+
+func (s *RedisSuite) TestShouldExpireMetadataWithTheIDs() {
+	t := s.T()
+	rs := s.newStore(store.Metadata(), store.TTL(time.Minute))
+	defer rs.Close()
+
+	require.NoError(t, rs.Track(s.messages[0]))
+	assert.Equal(t, time.Minute, s.mr.TTL("batched:tracked:meta"))
+}
+
 func (s *RedisSuite) TestFetchFromRedisShouldBeSourceForResult() {
 	t := s.T()
 	result := s.store.Result()
@@ -105,6 +155,260 @@ func (s *RedisSuite) TestFetchFromRedisShouldBeSourceForResult() {
 	require.Equal(t, int64(0), result.Acknowledged)
 }
 
+func (s *RedisSuite) TestShouldReturnResultByTopic() {
+	t := s.T()
+	other := "kafkqa_redis_store_other"
+	trace := store.Trace{Message: creator.Message{ID: "5"}, TopicPartition: kafka.TopicPartition{Topic: &other}}
+	require.NoError(t, s.store.Track(trace))
+	require.NoError(t, s.store.Acknowledge(trace))
+	require.NoError(t, s.store.Acknowledge(s.messages[0]))
+	require.NoError(t, s.store.Acknowledge(s.messages[0]))
+
+	result := s.store.Result()
+
+	assert.Equal(t, map[string]store.Result{
+		"kafkqa_redis_store":       {Tracked: 4, Acknowledged: 1},
+		"kafkqa_redis_store_other": {Tracked: 1, Acknowledged: 1},
+	}, result.Topics)
+}
+
+func (s *RedisSuite) newStore(opts ...store.RedisOption) *store.Redis {
+	msgID := func(t store.Trace) string { return t.Message.ID }
+	rs, err := store.NewRedis(s.mr.Addr(), "batched", msgID, opts...)
+	require.NoError(s.T(), err)
+	return rs
+}
+
+func (s *RedisSuite) TestShouldBufferWritesUntilBatchIsFull() {
+	t := s.T()
+	rs := s.newStore(store.Batch(3, time.Hour))
+	defer rs.Close()
+
+	require.NoError(t, rs.Track(s.messages[0]))
+	require.NoError(t, rs.Track(s.messages[1]))
+	assert.Equal(t, int64(0), s.testClient.SCard("batched:tracked:ids").Val())
+
+	require.NoError(t, rs.Track(s.messages[2]))
+	assert.Equal(t, int64(3), s.testClient.SCard("batched:tracked:ids").Val())
+
+	require.NoError(t, rs.Acknowledge(s.messages[0]))
+	result := rs.Result()
+	assert.Equal(t, int64(3), result.Tracked)
+	assert.Equal(t, int64(1), result.Acknowledged)
+	assert.Equal(t, store.Result{Tracked: 3, Acknowledged: 1}, result.Topics["kafkqa_redis_store"])
+}
+
+func (s *RedisSuite) TestShouldFlushBufferedWritesPeriodically() {
+	t := s.T()
+	rs := s.newStore(store.Batch(100, 10*time.Millisecond))
+	defer rs.Close()
+
+	require.NoError(t, rs.Track(s.messages[0]))
+
+	assert.Eventually(t, func() bool {
+		return s.testClient.SCard("batched:tracked:ids").Val() == 1
+	}, time.Second, 10*time.Millisecond)
+}
+
+func (s *RedisSuite) TestShouldExpireKeysAfterTTL() {
+	t := s.T()
+	rs := s.newStore(store.TTL(time.Minute))
+	defer rs.Close()
+
+	require.NoError(t, rs.Track(s.messages[0]))
+
+	assert.Equal(t, time.Minute, s.mr.TTL("batched:tracked:ids"))
+	assert.Equal(t, time.Minute, s.mr.TTL("batched:tracked:topics"))
+	s.mr.FastForward(time.Minute)
+	assert.False(t, s.mr.Exists("batched:tracked:ids"))
+}
+
+func (s *RedisSuite) TestShouldExpireIDsOlderThanWindowAndKeepCounting() {
+	t := s.T()
+	rs := s.newStore(store.Batch(1, 10*time.Millisecond), store.ExpireAfter(time.Millisecond))
+	defer rs.Close()
+
+	require.NoError(t, rs.Track(s.messages[0]))
+	require.NoError(t, rs.Track(s.messages[1]))
+	require.NoError(t, rs.Acknowledge(s.messages[0]))
+
+	assert.Eventually(t, func() bool {
+		return s.testClient.SCard("batched:tracked:ids").Val() == 0
+	}, time.Second, 10*time.Millisecond)
+	assert.Equal(t, int64(0), s.testClient.SCard("batched:acked:ids").Val())
+	result := rs.Result()
+	assert.Equal(t, int64(2), result.Tracked)
+	assert.Equal(t, int64(1), result.Acknowledged)
+}
+
+func (s *RedisSuite) TestShouldNotCountAcksOfExpiredIDs() {
+	t := s.T()
+	rs := s.newStore(store.Batch(1, 10*time.Millisecond), store.ExpireAfter(50*time.Millisecond))
+	defer rs.Close()
+
+	require.NoError(t, rs.Track(s.messages[0]))
+	assert.Eventually(t, func() bool {
+		return s.testClient.SCard("batched:tracked:ids").Val() == 0
+	}, time.Second, 10*time.Millisecond)
+	require.NoError(t, rs.Acknowledge(s.messages[0]))
+
+	assert.Equal(t, int64(0), s.testClient.SCard("batched:acked:ids").Val())
+	result := rs.Result()
+	assert.Equal(t, int64(1), result.Tracked)
+	assert.Equal(t, int64(0), result.Acknowledged)
+}
+
+func (s *RedisSuite) TestShouldRequeueBatchWhenWriteFails() {
+	t := s.T()
+	rs := s.newStore(store.Batch(1, time.Hour))
+	defer rs.Close()
+	s.mr.Close()
+
+	assert.Error(t, rs.Track(s.messages[0]))
+
+	require.NoError(t, s.mr.Restart())
+	require.NoError(t, rs.Flush())
+	assert.Equal(t, []string{"1"}, s.testClient.SMembers("batched:tracked:ids").Val())
+	assert.Equal(t, int64(1), rs.Result().Tracked)
+}
+
+func (s *RedisSuite) TestShouldDropOldestIDsBeyondMaxPendingWhileWritesFail() {
+	t := s.T()
+	rs := s.newStore(store.Batch(1, time.Hour), store.MaxPending(2))
+	defer rs.Close()
+	s.mr.Close()
+
+	for _, m := range s.messages {
+		assert.Error(t, rs.Track(m))
+	}
+	assert.Equal(t, int64(2), rs.Dropped())
+
+	require.NoError(t, s.mr.Restart())
+	require.NoError(t, rs.Flush())
+	assert.ElementsMatch(t, []string{"3", "4"}, s.testClient.SMembers("batched:tracked:ids").Val())
+}
+
+func (s *RedisSuite) TestShouldCountTopicsOnceWhenBatchIsWrittenAgain() {
+	t := s.T()
+	rs := s.newStore(store.Batch(2, time.Hour))
+	defer rs.Close()
+
+	for i := 0; i < 2; i++ {
+		require.NoError(t, rs.Track(s.messages[0]))
+		require.NoError(t, rs.Track(s.messages[1]))
+	}
+	require.NoError(t, rs.Acknowledge(s.messages[0]))
+	require.NoError(t, rs.Flush())
+
+	result := rs.Result()
+	assert.Equal(t, int64(2), result.Tracked)
+	assert.Equal(t, map[string]store.Result{"kafkqa_redis_store": {Tracked: 2, Acknowledged: 1}}, result.Topics)
+}
+
+func (s *RedisSuite) TestShouldDeleteRunKeysOnCloseWhenCleanupIsEnabled() {
+	t := s.T()
+	rs := s.newStore(store.Batch(10, time.Hour), store.CleanupOnClose())
+	require.NoError(t, rs.Track(s.messages[0]))
+
+	require.NoError(t, rs.Close())
+
+	assert.False(t, s.mr.Exists("batched:tracked:ids"))
+	assert.False(t, s.mr.Exists("batched:tracked:topics"))
+	assert.True(t, s.mr.Exists("test_namespace:tracked:ids"))
+}
+
+func (s *RedisSuite) TestShouldAuthenticateAndSelectDB() {
+	t := s.T()
+	s.mr.RequireAuth("secret")
+	msgID := func(t store.Trace) string { return t.Message.ID }
+
+	_, err := store.NewRedis(s.mr.Addr(), "authed", msgID)
+	require.Error(t, err)
+
+	rs, err := store.NewRedis(s.mr.Addr(), "authed", msgID, store.Auth("", "secret"), store.DB(2), store.Metadata())
+	require.NoError(t, err)
+	defer rs.Close()
+	require.NoError(t, rs.Track(s.messages[0]))
+
+	// miniredis runs scripts against db 0, the ids are added by a script so the metadata written along is checked
+	ids, err := s.mr.DB(2).HKeys("authed:tracked:meta")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"1"}, ids)
+	assert.False(t, s.mr.DB(0).Exists("authed:tracked:meta"))
+}
+
+// aclServer accepts AUTH with an ACL user, commands before it fail with NOAUTH like redis does
+type aclServer struct {
+	*server.Server
+	mu       sync.Mutex
+	selected []string
+}
+
+func newACLServer(t *testing.T, user, password string) *aclServer {
+	srv, err := server.NewServer("127.0.0.1:0")
+	require.NoError(t, err)
+	acl := &aclServer{Server: srv}
+	authed := func(c *server.Peer) bool {
+		if c.Ctx != true {
+			c.WriteError("NOAUTH Authentication required.")
+			return false
+		}
+		return true
+	}
+	require.NoError(t, srv.Register("AUTH", func(c *server.Peer, cmd string, args []string) {
+		if len(args) != 2 || args[0] != user || args[1] != password {
+			c.WriteError("WRONGPASS invalid username-password pair")
+			return
+		}
+		c.Ctx = true
+		c.WriteOK()
+	}))
+	require.NoError(t, srv.Register("SELECT", func(c *server.Peer, cmd string, args []string) {
+		if authed(c) {
+			acl.mu.Lock()
+			acl.selected = append(acl.selected, args[0])
+			acl.mu.Unlock()
+			c.WriteOK()
+		}
+	}))
+	require.NoError(t, srv.Register("PING", func(c *server.Peer, cmd string, args []string) {
+		if authed(c) {
+			c.WriteInline("PONG")
+		}
+	}))
+	return acl
+}
+
+func TestShouldAuthenticateACLUserBeforeSelectingDB(t *testing.T) {
+	acl := newACLServer(t, "kafqa", "secret")
+	defer acl.Close()
+	msgID := func(t store.Trace) string { return t.Message.ID }
+
+	rs, err := store.NewRedis(acl.Addr().String(), "acl", msgID, store.Auth("kafqa", "secret"), store.DB(2))
+
+	require.NoError(t, err)
+	defer rs.Close()
+	acl.mu.Lock()
+	defer acl.mu.Unlock()
+	assert.Equal(t, []string{"2"}, acl.selected)
+}
+
+func TestShouldAuthenticateACLUserWithDefaultDB(t *testing.T) {
+	acl := newACLServer(t, "kafqa", "secret")
+	defer acl.Close()
+	msgID := func(t store.Trace) string { return t.Message.ID }
+
+	_, err := store.NewRedis(acl.Addr().String(), "acl", msgID, store.Auth("kafqa", "wrong"))
+	require.Error(t, err)
+
+	rs, err := store.NewRedis(acl.Addr().String(), "acl", msgID, store.Auth("kafqa", "secret"))
+	require.NoError(t, err)
+	defer rs.Close()
+	acl.mu.Lock()
+	defer acl.mu.Unlock()
+	assert.Empty(t, acl.selected)
+}
+
 func TestRedisStore(t *testing.T) {
 	suite.Run(t, new(RedisSuite))
 }
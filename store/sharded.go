@@ -0,0 +1,116 @@
+package store
+
+import (
+	"hash/fnv"
+	"sync"
+	"sync/atomic"
+)
+
+type shard struct {
+	sync.Mutex
+	pending map[string]Trace
+	topics  map[string]*Result
+}
+
+func (s *shard) topicResult(topic string) *Result {
+	r, ok := s.topics[topic]
+	if !ok {
+		r = &Result{}
+		s.topics[topic] = r
+	}
+	return r
+}
+
+// Sharded is an in-memory store which spreads traces across shards by trace id,
+// so that delivery reports and consumed messages don't contend on a single lock
+type Sharded struct {
+	// accessed atomically, kept first for 64 bit alignment
+	tracked      int64
+	acknowledged int64
+	TraceID
+	shards []*shard
+}
+
+func (ss *Sharded) shardFor(id string) *shard {
+	h := fnv.New32a()
+	h.Write([]byte(id))
+	return ss.shards[h.Sum32()%uint32(len(ss.shards))]
+}
+
+func (ss *Sharded) Acknowledge(msg Trace) error {
+	atomic.AddInt64(&ss.acknowledged, 1)
+	id := ss.TraceID(msg)
+	s := ss.shardFor(id)
+	s.Lock()
+	defer s.Unlock()
+
+	s.topicResult(msg.TopicName()).Acknowledged++
+	delete(s.pending, id)
+	return nil
+}
+
+func (ss *Sharded) Track(msg Trace) error {
+	atomic.AddInt64(&ss.tracked, 1)
+	id := ss.TraceID(msg)
+	s := ss.shardFor(id)
+	s.Lock()
+	defer s.Unlock()
+
+	s.topicResult(msg.TopicName()).Tracked++
+	s.pending[id] = msg
+	return nil
+}
+
+func (ss *Sharded) Unacknowledged() ([]string, error) {
+	var msgs []string
+	for _, s := range ss.shards {
+		s.Lock()
+		for id := range s.pending {
+			msgs = append(msgs, id)
+		}
+		s.Unlock()
+	}
+	return msgs, nil
+}
+
+func (ss *Sharded) UnacknowledgedTraces() ([]Trace, error) {
+	var traces []Trace
+	for _, s := range ss.shards {
+		s.Lock()
+		for _, t := range s.pending {
+			traces = append(traces, t)
+		}
+		s.Unlock()
+	}
+	return traces, nil
+}
+
+func (ss *Sharded) Result() Result {
+	res := Result{
+		Tracked:      atomic.LoadInt64(&ss.tracked),
+		Acknowledged: atomic.LoadInt64(&ss.acknowledged),
+		Topics:       make(map[string]Result),
+	}
+	for _, s := range ss.shards {
+		s.Lock()
+		for t, r := range s.topics {
+			tr := res.Topics[t]
+			tr.Tracked += r.Tracked
+			tr.Acknowledged += r.Acknowledged
+			res.Topics[t] = tr
+		}
+		s.Unlock()
+	}
+	return res
+}
+
+func NewSharded(ti TraceID, shards int) *Sharded {
+	if shards < 1 {
+		shards = 1
+	}
+	ss := &Sharded{TraceID: ti, shards: make([]*shard, shards)}
+	for i := range ss.shards {
+		ss.shards[i] = &shard{pending: make(map[string]Trace), topics: make(map[string]*Result)}
+	}
+	return ss
+}
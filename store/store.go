@@ -1,6 +1,10 @@
 package store
 
 import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io/ioutil"
 	"sync"
 
 	"github.com/gojek/kafqa/config"
@@ -13,6 +17,13 @@ type Trace struct {
 	kafka.TopicPartition
 }
 
+func (t Trace) TopicName() string {
+	if t.TopicPartition.Topic == nil {
+		return ""
+	}
+	return *t.TopicPartition.Topic
+}
+
 type TraceID func(Trace) string
 
 type MsgStore interface {
@@ -26,7 +37,8 @@ type InMemory struct {
 	pending map[string]Trace
 	sync.Mutex
 	TraceID
-	res Result
+	res    Result
+	topics map[string]*Result
 }
 
 func (ms *InMemory) Acknowledge(msg Trace) error {
@@ -34,6 +46,7 @@ func (ms *InMemory) Acknowledge(msg Trace) error {
 	defer ms.Unlock()
 
 	ms.res.Acknowledged++
+	ms.topicResult(msg.TopicName()).Acknowledged++
 	delete(ms.pending, ms.TraceID(msg))
 	return nil
 }
@@ -43,6 +56,7 @@ func (ms *InMemory) Track(msg Trace) error {
 	defer ms.Unlock()
 
 	ms.res.Tracked++
+	ms.topicResult(msg.TopicName()).Tracked++
 	ms.pending[ms.TraceID(msg)] = msg
 	return nil
 }
@@ -58,13 +72,42 @@ func (ms *InMemory) Unacknowledged() ([]string, error) {
 	return msgs, nil
 }
 
+// UnacknowledgedTraces returns the pending traces with their delivered partition and offset
+func (ms *InMemory) UnacknowledgedTraces() ([]Trace, error) {
+	ms.Lock()
+	defer ms.Unlock()
+
+	traces := make([]Trace, 0, len(ms.pending))
+	for _, v := range ms.pending {
+		traces = append(traces, v)
+	}
+	return traces, nil
+}
+
 type Result struct {
 	Tracked      int64
 	Acknowledged int64
+	Topics       map[string]Result
 }
 
 func (ms *InMemory) Result() Result {
-	return ms.res
+	ms.Lock()
+	defer ms.Unlock()
+
+	res := Result{Tracked: ms.res.Tracked, Acknowledged: ms.res.Acknowledged, Topics: make(map[string]Result, len(ms.topics))}
+	for t, r := range ms.topics {
+		res.Topics[t] = *r
+	}
+	return res
+}
+
+func (ms *InMemory) topicResult(topic string) *Result {
+	r, ok := ms.topics[topic]
+	if !ok {
+		r = &Result{}
+		ms.topics[topic] = r
+	}
+	return r
 }
 
 func NewInMemory(ti TraceID) *InMemory {
@@ -72,19 +115,99 @@ func NewInMemory(ti TraceID) *InMemory {
 		pending: make(map[string]Trace, 1000),
 		Mutex:   sync.Mutex{},
 		TraceID: ti,
+		topics:  make(map[string]*Result),
 	}
 }
 
 func New(appCfg config.Application, traceID TraceID) (MsgStore, error) {
 	if appCfg.Store.Type == "redis" {
-		ms, err := NewRedis(appCfg.Store.RedisHost, appCfg.Store.RunID, traceID)
+		opts, err := redisOptions(appCfg.Store)
+		if err != nil {
+			return nil, err
+		}
+		// the offsets of lost messages are only read to list or reconcile them
+		if appCfg.Reporter.Report.LostLimit != 0 || appCfg.Reconcile.Enabled {
+			opts = append(opts, Metadata())
+		}
+		ms, err := NewRedis(appCfg.Store.RedisHost, appCfg.Store.RunID, traceID, opts...)
 		if err != nil {
 			return nil, err
 		}
 		return ms, nil
+	} else if appCfg.Store.Type == "file" {
+		return NewFile(appCfg.Store.FilePath, traceID, appCfg.Store.FileSyncInterval())
+	} else if appCfg.Store.Type == "windowed" {
+		return NewWindowed(traceID, appCfg.Store.LossDeadline(), appCfg.Store.SweepInterval()), nil
 	} else if appCfg.Producer.TotalMessages != -1 && appCfg.Producer.Enabled && appCfg.Consumer.Enabled {
 		// only enable in-memory calculation, when the infinite producer is not set and both producer and consumer is enabled.
+		if appCfg.Store.Shards > 1 {
+			return NewSharded(traceID, appCfg.Store.Shards), nil
+		}
 		return NewInMemory(traceID), nil
 	}
 	return NewNoOp(), nil
 }
+
+func redisOptions(cfg config.Store) ([]RedisOption, error) {
+	opts := []RedisOption{Batch(cfg.RedisBatchSize, cfg.RedisFlushInterval())}
+	if cfg.RedisMaxPending > 0 {
+		opts = append(opts, MaxPending(cfg.RedisMaxPending))
+	}
+	if cfg.RedisKeyTTLMs > 0 {
+		opts = append(opts, TTL(cfg.RedisKeyTTL()))
+	}
+	if cfg.RedisExpireAfterMs > 0 {
+		opts = append(opts, ExpireAfter(cfg.RedisExpireAfter()))
+	}
+	if cfg.RedisCleanup {
+		opts = append(opts, CleanupOnClose())
+	}
+	if cfg.RedisUser != "" || cfg.RedisPassword != "" {
+		opts = append(opts, Auth(cfg.RedisUser, cfg.RedisPassword))
+	}
+	if cfg.RedisDB != 0 {
+		opts = append(opts, DB(cfg.RedisDB))
+	}
+	if cfg.RedisTLSEnabled {
+		tlsCfg, err := redisTLSConfig(cfg)
+		if err != nil {
+			return nil, err
+		}
+		opts = append(opts, TLS(tlsCfg))
+	}
+	switch cfg.RedisMode {
+	case "", RedisSingle:
+	case RedisSentinel:
+		if cfg.RedisSentinelMaster == "" {
+			return nil, fmt.Errorf("sentinel master is required for redis sentinel mode")
+		}
+		opts = append(opts, Sentinel(cfg.RedisSentinelMaster, cfg.RedisAddrs()...))
+	case RedisCluster:
+		opts = append(opts, Cluster(cfg.RedisAddrs()...))
+	default:
+		return nil, fmt.Errorf("unknown redis mode: %s", cfg.RedisMode)
+	}
+	return opts, nil
+}
+
+func redisTLSConfig(cfg config.Store) (*tls.Config, error) {
+	tlsCfg := &tls.Config{InsecureSkipVerify: cfg.RedisTLSSkipVerify}
+	if cfg.RedisCALocation != "" {
+		ca, err := ioutil.ReadFile(cfg.RedisCALocation)
+		if err != nil {
+			return nil, fmt.Errorf("error reading redis ca: %v", err)
+		}
+		tlsCfg.RootCAs = x509.NewCertPool()
+		if !tlsCfg.RootCAs.AppendCertsFromPEM(ca) {
+			return nil, fmt.Errorf("no certificates found in redis ca %s", cfg.RedisCALocation)
+		}
+	}
+	if cfg.RedisCertLocation != "" {
+		cert, err := tls.LoadX509KeyPair(cfg.RedisCertLocation, cfg.RedisKeyLocation)
+		if err != nil {
+			return nil, fmt.Errorf("error loading redis client certificate: %v", err)
+		}
+		tlsCfg.Certificates = []tls.Certificate{cert}
+	}
+	return tlsCfg, nil
+}
@@ -0,0 +1,38 @@
+package store_test
+
+import (
+	"strconv"
+	"sync/atomic"
+	"testing"
+
+	"github.com/gojek/kafqa/creator"
+	"github.com/gojek/kafqa/store"
+	"gopkg.in/confluentinc/confluent-kafka-go.v1/kafka"
+)
+
+func benchmarkTrackAndAcknowledge(b *testing.B, ms store.MsgStore) {
+	topic := "kafqa_bench"
+	var seq int64
+	b.ReportAllocs()
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			id := strconv.FormatInt(atomic.AddInt64(&seq, 1), 10)
+			trace := store.Trace{Message: creator.Message{ID: id}, TopicPartition: kafka.TopicPartition{Topic: &topic}}
+			ms.Track(trace)
+			ms.Acknowledge(trace)
+		}
+	})
+}
+
+func BenchmarkInMemoryTrackAndAcknowledge(b *testing.B) {
+	benchmarkTrackAndAcknowledge(b, store.NewInMemory(func(t store.Trace) string { return t.Message.ID }))
+}
+
+func BenchmarkShardedTrackAndAcknowledge(b *testing.B) {
+	for _, shards := range []int{4, 16, 64} {
+		b.Run(strconv.Itoa(shards), func(b *testing.B) {
+			benchmarkTrackAndAcknowledge(b, store.NewSharded(func(t store.Trace) string { return t.Message.ID }, shards))
+		})
+	}
+}
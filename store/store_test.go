@@ -16,13 +16,14 @@ import (
 
 type InmemorySuite struct {
 	suite.Suite
-	store    *store.InMemory
+	newStore func(store.TraceID) store.MsgStore
+	store    store.MsgStore
 	messages []store.Trace
 }
 
 func (s *InmemorySuite) SetupTest() {
 	msgID := func(t store.Trace) string { return t.Message.ID }
-	s.store = store.NewInMemory(msgID)
+	s.store = s.newStore(msgID)
 	topic := "kafkqa_mem_store"
 	tp := kafka.TopicPartition{Topic: &topic, Partition: 1}
 	s.messages = []store.Trace{
@@ -77,6 +78,44 @@ func (s *InmemorySuite) TestShouldRemoveAcknowledgedMessages() {
 	}
 }
 
+func (s *InmemorySuite) TestShouldReturnResultByTopic() {
+	t := s.T()
+	other := "kafkqa_mem_store_other"
+	trace := store.Trace{Message: creator.Message{ID: "5"}, TopicPartition: kafka.TopicPartition{Topic: &other}}
+	require.NoError(t, s.store.Track(trace))
+	require.NoError(t, s.store.Acknowledge(trace))
+	require.NoError(t, s.store.Acknowledge(s.messages[0]))
+
+	result := s.store.Result()
+
+	assert.Equal(t, int64(5), result.Tracked)
+	assert.Equal(t, int64(2), result.Acknowledged)
+	assert.Equal(t, map[string]store.Result{
+		"kafkqa_mem_store":       {Tracked: 4, Acknowledged: 1},
+		"kafkqa_mem_store_other": {Tracked: 1, Acknowledged: 1},
+	}, result.Topics)
+}
+
+func (s *InmemorySuite) TestShouldReturnUnacknowledgedTraces() {
+	t := s.T()
+	require.NoError(t, s.store.Acknowledge(s.messages[0]))
+
+	traces, err := s.store.(interface {
+		UnacknowledgedTraces() ([]store.Trace, error)
+	}).UnacknowledgedTraces()
+
+	require.NoError(t, err)
+	assert.ElementsMatch(t, s.messages[1:], traces)
+}
+
+func TestInMemoryStore(t *testing.T) {
+	suite.Run(t, &InmemorySuite{newStore: func(ti store.TraceID) store.MsgStore { return store.NewInMemory(ti) }})
+}
+
+func TestShardedStore(t *testing.T) {
+	suite.Run(t, &InmemorySuite{newStore: func(ti store.TraceID) store.MsgStore { return store.NewSharded(ti, 4) }})
+}
+
 func TestValidatesStoreCreated(t *testing.T) {
 	producer := config.Producer{TotalMessages: 100, Enabled: true}
 	consumer := config.Consumer{Enabled: true}
@@ -102,6 +141,22 @@ func TestValidatesStoreCreated(t *testing.T) {
 				Consumer: consumer,
 			},
 		},
+		{
+			"*store.Sharded",
+			config.Application{
+				Producer: producer,
+				Consumer: consumer,
+				Store:    config.Store{Shards: 16},
+			},
+		},
+		{
+			"*store.Windowed",
+			config.Application{
+				Producer: config.Producer{TotalMessages: -1},
+				Consumer: consumer,
+				Store:    config.Store{Type: "windowed", LossDeadlineMs: 1000, SweepIntervalMs: 100},
+			},
+		},
 		{
 			"store.NoOp",
 			config.Application{
@@ -120,3 +175,25 @@ func TestValidatesStoreCreated(t *testing.T) {
 		})
 	}
 }
+
+func TestNewShouldFailOnInvalidRedisConfig(t *testing.T) {
+	traceID := func(t store.Trace) string { return t.Message.ID }
+	testCases := []struct {
+		name  string
+		store config.Store
+		err   string
+	}{
+		{"unknown mode", config.Store{Type: "redis", RedisMode: "standalone"}, "unknown redis mode: standalone"},
+		{"sentinel without master", config.Store{Type: "redis", RedisMode: "sentinel"},
+			"sentinel master is required for redis sentinel mode"},
+		{"missing ca", config.Store{Type: "redis", RedisTLSEnabled: true, RedisCALocation: "/nonexistent/ca.crt"},
+			"error reading redis ca: open /nonexistent/ca.crt: no such file or directory"},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			_, err := store.New(config.Application{Store: testCase.store}, traceID)
+			assert.EqualError(t, err, testCase.err)
+		})
+	}
+}
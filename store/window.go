@@ -0,0 +1,186 @@
+package store
+
+import (
+	"sync"
+	"time"
+
+	"github.com/gojek/kafqa/reporter/metrics"
+)
+
+type pendingTrace struct {
+	topic string
+	at    time.Time
+}
+
+type windowCount struct {
+	lost         int64
+	acknowledged int64
+}
+
+// Windowed treats a tracked message as lost when it isn't acknowledged within the deadline,
+// resolved messages are evicted so memory is bounded by the throughput in the deadline
+type Windowed struct {
+	sync.Mutex
+	TraceID
+	deadline time.Duration
+	interval time.Duration
+
+	pending map[string]pendingTrace
+	// acks received before the delivery report tracked the message
+	early  map[string]pendingTrace
+	res    Result
+	topics map[string]*Result
+	lost   int64
+	counts map[string]*windowCount
+
+	exit chan struct{}
+	wg   sync.WaitGroup
+}
+
+func (w *Windowed) Track(msg Trace) error {
+	w.Lock()
+	defer w.Unlock()
+
+	id, topic := w.TraceID(msg), msg.TopicName()
+	w.res.Tracked++
+	w.topicResult(topic).Tracked++
+	if _, ok := w.early[id]; ok {
+		delete(w.early, id)
+		w.acknowledged(topic)
+		return nil
+	}
+	w.pending[id] = pendingTrace{topic: topic, at: time.Now()}
+	return nil
+}
+
+func (w *Windowed) Acknowledge(msg Trace) error {
+	w.Lock()
+	defer w.Unlock()
+
+	id, topic := w.TraceID(msg), msg.TopicName()
+	if _, ok := w.pending[id]; ok {
+		delete(w.pending, id)
+		w.acknowledged(topic)
+		return nil
+	}
+	w.early[id] = pendingTrace{topic: topic, at: time.Now()}
+	return nil
+}
+
+func (w *Windowed) acknowledged(topic string) {
+	w.res.Acknowledged++
+	w.topicResult(topic).Acknowledged++
+	w.windowCount(topic).acknowledged++
+}
+
+func (w *Windowed) Unacknowledged() ([]string, error) {
+	w.Lock()
+	defer w.Unlock()
+
+	msgs := make([]string, 0, len(w.pending))
+	for id := range w.pending {
+		msgs = append(msgs, id)
+	}
+	return msgs, nil
+}
+
+func (w *Windowed) Result() Result {
+	w.Lock()
+	defer w.Unlock()
+
+	res := Result{Tracked: w.res.Tracked, Acknowledged: w.res.Acknowledged, Topics: make(map[string]Result, len(w.topics))}
+	for t, r := range w.topics {
+		res.Topics[t] = *r
+	}
+	return res
+}
+
+// Lost returns the messages which weren't acknowledged within the deadline
+func (w *Windowed) Lost() int64 {
+	w.Lock()
+	defer w.Unlock()
+	return w.lost
+}
+
+// Sweep marks the messages pending beyond the deadline as lost and exports the loss ratio since the last sweep
+func (w *Windowed) Sweep() {
+	w.Lock()
+	defer w.Unlock()
+
+	cutoff := time.Now().Add(-w.deadline)
+	for id, p := range w.pending {
+		if p.at.Before(cutoff) {
+			delete(w.pending, id)
+			w.lost++
+			w.windowCount(p.topic).lost++
+			metrics.LostMessage(p.topic)
+		}
+	}
+	// duplicates or acks of messages already counted as lost
+	for id, p := range w.early {
+		if p.at.Before(cutoff) {
+			delete(w.early, id)
+		}
+	}
+	for topic, c := range w.counts {
+		if resolved := c.lost + c.acknowledged; resolved > 0 {
+			metrics.LossRatio(topic, float64(c.lost)/float64(resolved))
+		}
+	}
+	w.counts = make(map[string]*windowCount)
+}
+
+func (w *Windowed) run() {
+	defer w.wg.Done()
+	ticker := time.NewTicker(w.interval)
+	for {
+		select {
+		case <-ticker.C:
+			w.Sweep()
+		case <-w.exit:
+			ticker.Stop()
+			return
+		}
+	}
+}
+
+func (w *Windowed) Close() error {
+	close(w.exit)
+	w.wg.Wait()
+	return nil
+}
+
+func (w *Windowed) topicResult(topic string) *Result {
+	r, ok := w.topics[topic]
+	if !ok {
+		r = &Result{}
+		w.topics[topic] = r
+	}
+	return r
+}
+
+func (w *Windowed) windowCount(topic string) *windowCount {
+	c, ok := w.counts[topic]
+	if !ok {
+		c = &windowCount{}
+		w.counts[topic] = c
+	}
+	return c
+}
+
+// NewWindowed creates the store and sweeps the pending messages every interval until closed
+func NewWindowed(ti TraceID, deadline, interval time.Duration) *Windowed {
+	w := &Windowed{
+		TraceID:  ti,
+		deadline: deadline,
+		interval: interval,
+		pending:  make(map[string]pendingTrace, 1000),
+		early:    make(map[string]pendingTrace),
+		topics:   make(map[string]*Result),
+		counts:   make(map[string]*windowCount),
+		exit:     make(chan struct{}),
+	}
+	w.wg.Add(1)
+	go w.run()
+	return w
+}
@@ -0,0 +1,60 @@
+package store_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/gojek/kafqa/creator"
+	"github.com/gojek/kafqa/store"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gopkg.in/confluentinc/confluent-kafka-go.v1/kafka"
+)
+
+func windowTrace(id string) store.Trace {
+	topic := "kafqa_window"
+	return store.Trace{Message: creator.Message{ID: id}, TopicPartition: kafka.TopicPartition{Topic: &topic}}
+}
+
+func TestWindowedShouldCountMessagesNotAckedWithinDeadlineAsLost(t *testing.T) {
+	w := store.NewWindowed(func(t store.Trace) string { return t.Message.ID }, 10*time.Millisecond, time.Hour)
+	defer w.Close()
+
+	require.NoError(t, w.Track(windowTrace("1")))
+	require.NoError(t, w.Track(windowTrace("2")))
+	require.NoError(t, w.Acknowledge(windowTrace("1")))
+	w.Sweep()
+	assert.Equal(t, int64(0), w.Lost(), "pending message within deadline shouldn't be lost")
+
+	time.Sleep(20 * time.Millisecond)
+	w.Sweep()
+
+	assert.Equal(t, int64(1), w.Lost())
+	pending, err := w.Unacknowledged()
+	require.NoError(t, err)
+	assert.Empty(t, pending, "lost messages should be evicted")
+	assert.Equal(t, store.Result{Tracked: 2, Acknowledged: 1,
+		Topics: map[string]store.Result{"kafqa_window": {Tracked: 2, Acknowledged: 1}}}, w.Result())
+}
+
+func TestWindowedShouldResolveAcksReceivedBeforeTracking(t *testing.T) {
+	w := store.NewWindowed(func(t store.Trace) string { return t.Message.ID }, 10*time.Millisecond, time.Hour)
+	defer w.Close()
+
+	require.NoError(t, w.Acknowledge(windowTrace("1")))
+	require.NoError(t, w.Track(windowTrace("1")))
+	time.Sleep(20 * time.Millisecond)
+	w.Sweep()
+
+	assert.Equal(t, int64(0), w.Lost())
+	assert.Equal(t, int64(1), w.Result().Acknowledged)
+}
+
+func TestWindowedShouldSweepPeriodically(t *testing.T) {
+	w := store.NewWindowed(func(t store.Trace) string { return t.Message.ID }, time.Millisecond, 5*time.Millisecond)
+	defer w.Close()
+
+	require.NoError(t, w.Track(windowTrace("1")))
+
+	assert.Eventually(t, func() bool { return w.Lost() == 1 }, time.Second, 5*time.Millisecond)
+}